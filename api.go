@@ -2,18 +2,23 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type APIResp struct {
-	Success bool   `json:"success"`
-	Msg     string `json:"msg,omitempty"`
-	Data    any    `json:"data,omitempty"`
+	Success bool      `json:"success"`
+	Msg     string    `json:"msg,omitempty"`
+	Data    any       `json:"data,omitempty"`
+	Error   *APIError `json:"error,omitempty"`
 }
 
 func newAPIResp(success bool, msg string, data any) *APIResp {
@@ -25,40 +30,188 @@ func newAPIResp(success bool, msg string, data any) *APIResp {
 }
 
 type API struct {
-	listenAddr string
-	authToken  string
-	handler    http.Handler
-	router     *mux.Router
-	client     *TwitterClient
+	listenAddr  string
+	authToken   string
+	handler     http.Handler
+	router      *mux.Router
+	rawRouter   *mux.Router
+	client      *TwitterClient
+	scheduler   *Scheduler
+	recurring   *RecurringJobRunner
+	templates   *TweetTemplates
+	idempotency *IdempotencyKeys
+	queue       *PublishQueue
+	media       *MediaStore
 	*Logger
 }
 
-func newAPI(listenAddr string, authToken string, creds ...TwitterAPICreds) (*API, error) {
+func newAPI(listenAddr string, authToken string, strategy ClientSelectionStrategy, creds ...TwitterAPICreds) (*API, error) {
 	la := ensurePrefix(listenAddr, ":")
 	if !allCharsNumeric(la[1:]) {
 		return nil, fmt.Errorf("invalid listen address: %s", listenAddr)
 	}
 
-	client, err := newTwitterClient(creds)
+	client, err := newTwitterClient(creds, strategy)
 	if err != nil {
 		return nil, err
 	}
 
+	dataDir := os.Getenv(EnvDataDir)
+	if dataDir == "" {
+		dataDir = defaultDataDir
+	}
+
+	client.published, err = newStore[PublishedTweet](storePath(dataDir, "published_tweets.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading published tweets: %w", err)
+	}
+
+	client.dedupeWindow, err = parseDedupeWindow(os.Getenv(EnvDedupeWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	client.contentHashes, err = newStore[ContentHash](storePath(dataDir, "content_hashes.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading published content hashes: %w", err)
+	}
+
+	stores, err := loadAPIStores(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := parseIdempotencyTTL(os.Getenv(EnvIdempotencyTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	queueSize, err := parsePositiveInt(EnvPublishQueueSize, os.Getenv(EnvPublishQueueSize), defaultPublishQueueSize)
+	if err != nil {
+		return nil, err
+	}
+
+	queueWorkers, err := parsePositiveInt(EnvPublishQueueWorkers, os.Getenv(EnvPublishQueueWorkers), defaultPublishQueueWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookSubscriptions, err := newStore[WebhookSubscription](storePath(dataDir, "webhooks.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhooks: %w", err)
+	}
+
+	webhookDeliveries, err := newStore[WebhookDelivery](storePath(dataDir, "webhook_deliveries.json"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhook deliveries: %w", err)
+	}
+
+	fetchConfig, err := loadFetchConfig(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+	client.fetcher = newFetcher(fetchConfig)
+
+	webhookSecret, err := loadWebhookSecret(os.Getenv(EnvWebhookSecret), storePath(dataDir, "webhook_secret"))
+	if err != nil {
+		return nil, fmt.Errorf("error loading webhook secret: %w", err)
+	}
+
+	logger := newLogger()
+	client.webhooks = newWebhooks(webhookSubscriptions, webhookDeliveries, webhookSecret, client.fetcher, logger)
+
+	return buildAPI(client, stores, APIConfig{
+		ListenAddr:     la,
+		AuthToken:      authToken,
+		IdempotencyTTL: idempotencyTTL,
+		QueueSize:      queueSize,
+		QueueWorkers:   queueWorkers,
+	}, logger), nil
+}
+
+// APIStores are the stores of the components built by buildAPI.
+type APIStores struct {
+	Scheduled          *Store[ScheduledTweet]
+	RecurringJobs      *Store[RecurringJob]
+	RecurringJobRuns   *Store[RecurringJobRun]
+	Templates          *Store[TweetTemplate]
+	TemplateVersions   *Store[TweetTemplateVersion]
+	IdempotencyRecords *Store[IdempotencyRecord]
+	PublishJobs        *Store[PublishJob]
+	Media              *MediaStore
+}
+
+// loadAPIStores loads the stores from their files in dataDir, or creates in-memory stores if dataDir is empty.
+func loadAPIStores(dataDir string) (APIStores, error) {
+	var (
+		stores APIStores
+		err    error
+	)
+
+	if stores.Scheduled, err = newStore[ScheduledTweet](storePath(dataDir, "scheduled_tweets.json")); err != nil {
+		return stores, fmt.Errorf("error loading scheduled tweets: %w", err)
+	}
+	if stores.RecurringJobs, err = newStore[RecurringJob](storePath(dataDir, "recurring_jobs.json")); err != nil {
+		return stores, fmt.Errorf("error loading recurring jobs: %w", err)
+	}
+	if stores.RecurringJobRuns, err = newStore[RecurringJobRun](storePath(dataDir, "recurring_job_runs.json")); err != nil {
+		return stores, fmt.Errorf("error loading recurring job runs: %w", err)
+	}
+	if stores.Templates, err = newStore[TweetTemplate](storePath(dataDir, "templates.json")); err != nil {
+		return stores, fmt.Errorf("error loading templates: %w", err)
+	}
+	if stores.TemplateVersions, err = newStore[TweetTemplateVersion](storePath(dataDir, "template_versions.json")); err != nil {
+		return stores, fmt.Errorf("error loading template versions: %w", err)
+	}
+	if stores.IdempotencyRecords, err = newStore[IdempotencyRecord](storePath(dataDir, "idempotency_keys.json")); err != nil {
+		return stores, fmt.Errorf("error loading idempotency keys: %w", err)
+	}
+	if stores.PublishJobs, err = newStore[PublishJob](storePath(dataDir, "publish_jobs.json")); err != nil {
+		return stores, fmt.Errorf("error loading publish jobs: %w", err)
+	}
+	stores.Media = newMediaStore(storePath(dataDir, "media"))
+
+	return stores, nil
+}
+
+// APIConfig is the configuration of the API, as loaded from the environment by newAPI.
+type APIConfig struct {
+	ListenAddr     string
+	AuthToken      string
+	IdempotencyTTL time.Duration
+	QueueSize      int
+	QueueWorkers   int
+}
+
+// buildAPI wires the API and its components around client, whose own stores must already be set.
+func buildAPI(client *TwitterClient, stores APIStores, config APIConfig, logger *Logger) *API {
 	api := &API{
-		listenAddr: la,
-		authToken:  authToken,
-		router:     mux.NewRouter(),
-		client:     client,
-		Logger:     newLogger(),
+		listenAddr:  config.ListenAddr,
+		authToken:   config.AuthToken,
+		router:      mux.NewRouter(),
+		client:      client,
+		scheduler:   newScheduler(client, stores.Scheduled, stores.Media, logger),
+		recurring:   newRecurringJobRunner(client, stores.RecurringJobs, stores.RecurringJobRuns, stores.Media, logger),
+		templates:   newTweetTemplates(client, stores.Templates, stores.TemplateVersions, stores.Media),
+		idempotency: newIdempotencyKeys(stores.IdempotencyRecords, config.IdempotencyTTL),
+		queue:       newPublishQueue(client, stores.PublishJobs, stores.Media, config.QueueSize, config.QueueWorkers, logger),
+		media:       stores.Media,
+		Logger:      logger,
 	}
 	api.handler = api
 	api.init()
 
-	return api, nil
+	return api
 }
 
 func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	a.Infof("%s @ %s (%s)\n", r.Method, r.URL.Path, r.RemoteAddr)
+
+	var match mux.RouteMatch
+	if a.rawRouter.Match(r, &match) {
+		a.rawRouter.ServeHTTP(w, r)
+		return
+	}
 	a.router.ServeHTTP(w, r)
 }
 
@@ -79,7 +232,44 @@ func (a *API) auth(h http.HandlerFunc) http.HandlerFunc {
 }
 
 func (a *API) init() {
+	// Tweet urls passed as the tweetID contain slashes, so their paths must not be cleaned before matching
+	a.rawRouter = mux.NewRouter().SkipClean(true)
+	a.rawRouter.HandleFunc("/api/tweet/{tweetID:.+}", a.auth(a.handleDeleteTweet)).Methods(http.MethodDelete)
+
 	a.router.HandleFunc("/api/tweet", a.auth(a.handlePublishTweet)).Methods(http.MethodPost)
+	a.router.HandleFunc("/api/tweet/preview", a.auth(a.handlePreviewTweet)).Methods(http.MethodPost)
+
+	a.router.HandleFunc("/api/jobs/{jobID}", a.auth(a.handleGetPublishJob)).Methods(http.MethodGet)
+
+	a.router.HandleFunc("/api/webhooks", a.auth(a.handleListWebhooks)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/webhooks", a.auth(a.handleCreateWebhook)).Methods(http.MethodPost)
+	a.router.HandleFunc("/api/webhooks/{webhookID}", a.auth(a.handleGetWebhook)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/webhooks/{webhookID}", a.auth(a.handleUpdateWebhook)).Methods(http.MethodPut)
+	a.router.HandleFunc("/api/webhooks/{webhookID}", a.auth(a.handleDeleteWebhook)).Methods(http.MethodDelete)
+	a.router.HandleFunc("/api/webhook-deliveries", a.auth(a.handleListWebhookDeliveries)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/webhook-secret", a.auth(a.handleGetWebhookSecret)).Methods(http.MethodGet)
+
+	a.router.HandleFunc("/api/scheduled", a.auth(a.handleListScheduledTweets)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/scheduled/{scheduledID}", a.auth(a.handleGetScheduledTweet)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/scheduled/{scheduledID}", a.auth(a.handleRescheduleTweet)).Methods(http.MethodPatch)
+	a.router.HandleFunc("/api/scheduled/{scheduledID}", a.auth(a.handleCancelScheduledTweet)).Methods(http.MethodDelete)
+
+	a.router.HandleFunc("/api/recurring", a.auth(a.handleListRecurringJobs)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/recurring", a.auth(a.handleCreateRecurringJob)).Methods(http.MethodPost)
+	a.router.HandleFunc("/api/recurring/{recurringID}", a.auth(a.handleGetRecurringJob)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/recurring/{recurringID}", a.auth(a.handleUpdateRecurringJob)).Methods(http.MethodPut)
+	a.router.HandleFunc("/api/recurring/{recurringID}", a.auth(a.handleDeleteRecurringJob)).Methods(http.MethodDelete)
+	a.router.HandleFunc("/api/recurring/{recurringID}/runs", a.auth(a.handleListRecurringJobRuns)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/recurring/{recurringID}/runs", a.auth(a.handleRunRecurringJob)).Methods(http.MethodPost)
+
+	a.router.HandleFunc("/api/templates", a.auth(a.handleListTemplates)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/templates", a.auth(a.handleCreateTemplate)).Methods(http.MethodPost)
+	a.router.HandleFunc("/api/templates/{templateName}", a.auth(a.handleGetTemplate)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/templates/{templateName}", a.auth(a.handleUpdateTemplate)).Methods(http.MethodPut)
+	a.router.HandleFunc("/api/templates/{templateName}", a.auth(a.handleDeleteTemplate)).Methods(http.MethodDelete)
+	a.router.HandleFunc("/api/templates/{templateName}/publish", a.auth(a.handlePublishTemplate)).Methods(http.MethodPost)
+	a.router.HandleFunc("/api/templates/{templateName}/versions", a.auth(a.handleListTemplateVersions)).Methods(http.MethodGet)
+	a.router.HandleFunc("/api/templates/{templateName}/versions/{templateVersion:[0-9]+}/restore", a.auth(a.handleRestoreTemplateVersion)).Methods(http.MethodPost)
 
 	a.router.HandleFunc("/api/users/by/username/{targetUsername}", a.auth(a.handleGetUserByUsername)).Methods(http.MethodGet)
 	a.router.HandleFunc("/api/users/{targetUserID}", a.auth(a.handleGetUserByID)).Methods(http.MethodGet)
@@ -92,29 +282,535 @@ func (a *API) init() {
 }
 
 func (a *API) run() error {
+	// Media is only referenced by the components' records, so anything else was left by deleted records
+	a.LogErr(a.pruneMedia())
+
+	a.client.webhooks.start()
+	a.LogErr(a.idempotency.start())
+	// Closed last, so the events sent while the others close are still delivered
+	defer a.client.webhooks.close()
+
+	a.scheduler.start()
+	defer a.scheduler.close()
+
+	a.recurring.start()
+	defer a.recurring.close()
+
+	a.queue.start()
+	defer a.queue.close()
+
 	return http.ListenAndServe(a.listenAddr, a)
 }
 
-func (a *API) handlePublishTweet(w http.ResponseWriter, r *http.Request) {
+// pruneMedia removes the stored media that isn't referenced by any scheduled tweet, publish job, recurring job,
+// or template version. It must be called before the components start storing media.
+func (a *API) pruneMedia() error {
+	referenced := map[string]bool{}
+	for _, st := range a.scheduler.store.List() {
+		storedMediaIDs(referenced, st.Opts)
+	}
+	for _, job := range a.queue.store.List() {
+		storedMediaIDs(referenced, job.Opts)
+	}
+	for _, job := range a.recurring.jobs.List() {
+		storedMediaIDs(referenced, job.Opts)
+	}
+	for _, t := range a.templates.templates.List() {
+		storedMediaIDs(referenced, t.Opts)
+	}
+	for _, v := range a.templates.versions.List() {
+		storedMediaIDs(referenced, v.Opts)
+	}
+
+	if err := a.media.prune(referenced); err != nil {
+		return fmt.Errorf("error pruning stored media: %w", err)
+	}
+	return nil
+}
+
+// decodePublishTweetOpts decodes PublishTweetOpts from either a json or a multipart form request body,
+// which can't be larger than maxPublishRequestBytes.
+func decodePublishTweetOpts(w http.ResponseWriter, r *http.Request) (PublishTweetOpts, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPublishRequestBytes)
+
+	if isMultipartForm(r) {
+		return parseMultipartPublishTweetOpts(r)
+	}
+
 	var opts PublishTweetOpts
 	err := json.NewDecoder(r.Body).Decode(&opts)
+	return opts, err
+}
+
+func (a *API) handlePublishTweet(w http.ResponseWriter, r *http.Request) {
+	opts, err := decodePublishTweetOpts(w, r)
 	if err != nil {
-		a.Errorf("error decoding json: %s\n", err.Error())
+		a.Errorf("error decoding request body: %s\n", err.Error())
 		writeBadRequest(w, nil)
 		return
 	}
 
 	a.Infoln(opts.String())
+	a.publish(w, r, opts)
+}
+
+// publish publishes opts, or schedules or queues them, as requested by r.
+func (a *API) publish(w http.ResponseWriter, r *http.Request, opts PublishTweetOpts) {
+	// Set once any part of the tweet was published, so the response is kept even if it's an error
+	var published bool
+	if key := r.Header.Get(HTTPHeaderIdempotencyKey); key != "" {
+		record, err := a.idempotency.begin(key, publishRequestHash(opts), time.Now())
+		if err != nil {
+			a.LogErr(err)
+			writeErr(w, err, nil)
+			return
+		}
+		if record != nil {
+			a.Infof("Replaying response for Idempotency-Key (%s)\n", key)
+			writeReplay(w, record)
+			return
+		}
 
-	output, err := a.client.publishTweet(opts)
+		rec := newResponseRecorder(w)
+		defer func() {
+			a.LogErr(a.idempotency.complete(key, rec.statusCode, rec.body.Bytes(), published))
+		}()
+		w = rec
+	}
+
+	if opts.PublishAt != nil && opts.PublishAt.After(time.Now()) {
+		scheduled, err := a.scheduler.schedule(opts)
+		if err != nil {
+			a.LogErr(err)
+			writeErr(w, err, nil)
+			return
+		}
+
+		a.Infof("Scheduled Tweet (%s) for %s\n", scheduled.ID, scheduled.PublishAt.UTC().Format(time.RFC3339))
+		writeAccepted(w, scheduled)
+		return
+	}
+
+	// A publishAt time that has already passed is published immediately
+	opts.PublishAt = nil
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get(QueryParamAsync)); async {
+		job, err := a.queue.enqueue(opts)
+		if err != nil {
+			a.LogErr(err)
+			writeErr(w, err, nil)
+			return
+		}
+
+		a.Infof("Queued publish job (%s)\n", job.ID)
+		writeAccepted(w, job)
+		return
+	}
+
+	// A request that can't be rendered is only rejected, since nothing was attempted to be published
+	rendered, err := opts.render(a.client.fetcher)
 	if err != nil {
 		a.LogErr(err)
-		writeInternalServerError(w, nil)
+		writeErr(w, err, nil)
 		return
 	}
 
-	a.Infof("Published new Tweet (%s): %s\n", *output.Data.ID, *output.Data.Text)
-	writeOK(w, output)
+	result, err := a.client.publishRendered(opts.Username, rendered)
+	var partialErr *ThreadPartialError
+	published = result != nil || errors.As(err, &partialErr)
+	a.client.notifyPublished(opts.CallbackUrl, result, err)
+	if err != nil {
+		a.LogErr(err)
+		// A partially published thread still reports the parts that were published
+		var data any
+		if result != nil {
+			data = result
+		}
+		writeErr(w, err, data)
+		return
+	}
+
+	a.Infoln(result.String())
+	writeOK(w, result)
+}
+
+func (a *API) handlePreviewTweet(w http.ResponseWriter, r *http.Request) {
+	opts, err := decodePublishTweetOpts(w, r)
+	if err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	a.Infoln(opts.String())
+
+	preview, err := a.client.previewTweet(opts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, preview)
+}
+
+func (a *API) handleDeleteTweet(w http.ResponseWriter, r *http.Request) {
+	tweetID, err := parseTweetID(mux.Vars(r)[MuxVarTweetID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	result, err := a.client.deleteTweet(tweetID)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Deleted Tweet (%s) from (%s)\n", result.TweetID, result.Username)
+	writeOK(w, result)
+}
+
+func (a *API) handleGetPublishJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.queue.get(mux.Vars(r)[MuxVarJobID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, job)
+}
+
+func (a *API) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks := a.client.webhooks.list()
+	for i, webhook := range webhooks {
+		webhooks[i] = webhook.redacted()
+	}
+	writeOK(w, webhooks)
+}
+
+func (a *API) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var opts WebhookSubscriptionOpts
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	webhook, err := a.client.webhooks.create(opts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Created webhook (%s) for %s\n", webhook.ID, webhook.Url)
+	writeOK(w, webhook)
+}
+
+func (a *API) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, err := a.client.webhooks.get(mux.Vars(r)[MuxVarWebhookID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, webhook.redacted())
+}
+
+func (a *API) handleUpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	var opts WebhookSubscriptionOpts
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	webhook, err := a.client.webhooks.update(mux.Vars(r)[MuxVarWebhookID], opts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Updated webhook (%s) for %s\n", webhook.ID, webhook.Url)
+	writeOK(w, webhook.redacted())
+}
+
+func (a *API) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)[MuxVarWebhookID]
+	if err := a.client.webhooks.delete(id); err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Deleted webhook (%s)\n", id)
+	writeOK(w, nil)
+}
+
+func (a *API) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, a.client.webhooks.listDeliveries(r.URL.Query().Get(QueryParamWebhookID)))
+}
+
+func (a *API) handleGetWebhookSecret(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, WebhookCallbackSecret{Secret: a.client.webhooks.callbackSecret})
+}
+
+func (a *API) handleListScheduledTweets(w http.ResponseWriter, r *http.Request) {
+	status := ScheduledTweetStatus(r.URL.Query().Get(QueryParamStatus))
+	writeOK(w, a.scheduler.list(status))
+}
+
+func (a *API) handleGetScheduledTweet(w http.ResponseWriter, r *http.Request) {
+	scheduled, err := a.scheduler.get(mux.Vars(r)[MuxVarScheduledID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, scheduled)
+}
+
+func (a *API) handleRescheduleTweet(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		PublishAt time.Time `json:"publishAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	scheduled, err := a.scheduler.reschedule(mux.Vars(r)[MuxVarScheduledID], body.PublishAt)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Rescheduled Tweet (%s) for %s\n", scheduled.ID, scheduled.PublishAt.UTC().Format(time.RFC3339))
+	writeOK(w, scheduled)
+}
+
+func (a *API) handleCancelScheduledTweet(w http.ResponseWriter, r *http.Request) {
+	scheduled, err := a.scheduler.cancel(mux.Vars(r)[MuxVarScheduledID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Cancelled scheduled Tweet (%s)\n", scheduled.ID)
+	writeOK(w, scheduled)
+}
+
+func (a *API) handleListRecurringJobs(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, a.recurring.list())
+}
+
+func (a *API) handleCreateRecurringJob(w http.ResponseWriter, r *http.Request) {
+	var jobOpts RecurringJobOpts
+	if err := json.NewDecoder(r.Body).Decode(&jobOpts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	job, err := a.recurring.create(jobOpts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Created recurring job (%s) with schedule (%s)\n", job.ID, job.Cron)
+	writeOK(w, job)
+}
+
+func (a *API) handleGetRecurringJob(w http.ResponseWriter, r *http.Request) {
+	job, err := a.recurring.get(mux.Vars(r)[MuxVarRecurringID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, job)
+}
+
+func (a *API) handleUpdateRecurringJob(w http.ResponseWriter, r *http.Request) {
+	var jobOpts RecurringJobOpts
+	if err := json.NewDecoder(r.Body).Decode(&jobOpts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	job, err := a.recurring.update(mux.Vars(r)[MuxVarRecurringID], jobOpts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Updated recurring job (%s) with schedule (%s)\n", job.ID, job.Cron)
+	writeOK(w, job)
+}
+
+func (a *API) handleDeleteRecurringJob(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)[MuxVarRecurringID]
+	if err := a.recurring.delete(id); err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Deleted recurring job (%s)\n", id)
+	writeOK(w, nil)
+}
+
+func (a *API) handleListRecurringJobRuns(w http.ResponseWriter, r *http.Request) {
+	job, err := a.recurring.get(mux.Vars(r)[MuxVarRecurringID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, a.recurring.listRuns(job.ID))
+}
+
+func (a *API) handleRunRecurringJob(w http.ResponseWriter, r *http.Request) {
+	run, err := a.recurring.runNow(mux.Vars(r)[MuxVarRecurringID])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, run)
+}
+
+func (a *API) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	writeOK(w, a.templates.list())
+}
+
+func (a *API) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var templateOpts TweetTemplateOpts
+	if err := json.NewDecoder(r.Body).Decode(&templateOpts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	t, err := a.templates.create(templateOpts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Created template (%s)\n", t.Name)
+	writeOK(w, t)
+}
+
+func (a *API) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := a.templates.get(mux.Vars(r)[MuxVarTemplateName])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, t)
+}
+
+func (a *API) handleUpdateTemplate(w http.ResponseWriter, r *http.Request) {
+	var templateOpts TweetTemplateOpts
+	if err := json.NewDecoder(r.Body).Decode(&templateOpts); err != nil {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	t, err := a.templates.update(mux.Vars(r)[MuxVarTemplateName], templateOpts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Updated template (%s) to version (%d)\n", t.Name, t.Version)
+	writeOK(w, t)
+}
+
+func (a *API) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)[MuxVarTemplateName]
+	if err := a.templates.delete(name); err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Deleted template (%s)\n", name)
+	writeOK(w, nil)
+}
+
+func (a *API) handleListTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	t, err := a.templates.get(mux.Vars(r)[MuxVarTemplateName])
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	writeOK(w, a.templates.listVersions(t.Name))
+}
+
+func (a *API) handleRestoreTemplateVersion(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(mux.Vars(r)[MuxVarTemplateVersion])
+	if err != nil {
+		a.Errorf("invalid path variable (%s): %s\n", MuxVarTemplateVersion, err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	t, err := a.templates.restore(mux.Vars(r)[MuxVarTemplateName], version)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infof("Restored template (%s) to version (%d) as version (%d)\n", t.Name, version, t.Version)
+	writeOK(w, t)
+}
+
+// handlePublishTemplate publishes a template the same way as handlePublishTweet, so it can also be
+// scheduled, queued, and made idempotent. An empty body publishes the template with its default variables.
+func (a *API) handlePublishTemplate(w http.ResponseWriter, r *http.Request) {
+	var publishOpts TweetTemplatePublishOpts
+	if err := json.NewDecoder(r.Body).Decode(&publishOpts); err != nil && !errors.Is(err, io.EOF) {
+		a.Errorf("error decoding request body: %s\n", err.Error())
+		writeBadRequest(w, nil)
+		return
+	}
+
+	opts, err := a.templates.render(mux.Vars(r)[MuxVarTemplateName], publishOpts)
+	if err != nil {
+		a.LogErr(err)
+		writeErr(w, err, nil)
+		return
+	}
+
+	a.Infoln(opts.String())
+	a.publish(w, r, opts)
 }
 
 func (a *API) handleGetUserByUsername(w http.ResponseWriter, r *http.Request) {
@@ -129,7 +825,7 @@ func (a *API) handleGetUserByUsername(w http.ResponseWriter, r *http.Request) {
 	output, err := a.client.getUserByUsername(username, targetUsername)
 	if err != nil {
 		a.LogErr(err)
-		writeInternalServerError(w, nil)
+		writeErr(w, err, nil)
 		return
 	}
 
@@ -149,7 +845,7 @@ func (a *API) handleGetUserByID(w http.ResponseWriter, r *http.Request) {
 	output, err := a.client.getUserByID(username, targetUserID)
 	if err != nil {
 		a.LogErr(err)
-		writeInternalServerError(w, nil)
+		writeErr(w, err, nil)
 		return
 	}
 
@@ -169,7 +865,7 @@ func (a *API) handleGetUserTweets(w http.ResponseWriter, r *http.Request) {
 	output, err := a.client.getUserSingleTweets(username, targetUserID)
 	if err != nil {
 		a.LogErr(err)
-		writeInternalServerError(w, nil)
+		writeErr(w, err, nil)
 		return
 	}
 
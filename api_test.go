@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+)
+
+const testAuthToken = "test-auth-token"
+
+func newTestAPI(client *TwitterClient) *API {
+	stores, _ := loadAPIStores("")
+	return buildAPI(client, stores, APIConfig{
+		AuthToken:      testAuthToken,
+		IdempotencyTTL: defaultIdempotencyTTL,
+		QueueSize:      defaultPublishQueueSize,
+		QueueWorkers:   defaultPublishQueueWorkers,
+	}, newLogger())
+}
+
+func doTestRequest(api *API, method, path string, body any) *httptest.ResponseRecorder {
+	var r *http.Request
+	if body != nil {
+		b, _ := json.Marshal(body)
+		r = httptest.NewRequest(method, path, NewByteReadCloser(b))
+	} else {
+		r = httptest.NewRequest(method, path, nil)
+	}
+	r.Header.Set(HTTPHeaderAuthorization, "Bearer "+testAuthToken)
+
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// credsEnvKeys returns the env variable names holding a credential set.
+// An index of 0 refers to the unsuffixed set (USERNAME, API_KEY, ...),
+// while an index of n refers to the suffixed set (USERNAME_n, API_KEY_n, ...).
+func credsEnvKeys(index int) []string {
+	keys := []string{EnvUsername, EnvAPIKey, EnvAPIKeySecret, EnvOAuthToken, EnvOAuthTokenSecret}
+	if index == 0 {
+		return keys
+	}
+	for i, key := range keys {
+		keys[i] = fmt.Sprintf("%s_%d", key, index)
+	}
+	return keys
+}
+
+func credsWeightEnvKey(index int) string {
+	if index == 0 {
+		return EnvWeight
+	}
+	return fmt.Sprintf("%s_%d", EnvWeight, index)
+}
+
+func credsSetName(index int) string {
+	if index == 0 {
+		return "unsuffixed credential set"
+	}
+	return fmt.Sprintf("credential set (%d)", index)
+}
+
+func credsFromEnv(index int, getenv func(string) string) (creds TwitterAPICreds, found bool, err error) {
+	var (
+		keys    = credsEnvKeys(index)
+		values  = make([]string, len(keys))
+		missing = []string{}
+	)
+
+	for i, key := range keys {
+		values[i] = getenv(key)
+		if values[i] == "" {
+			missing = append(missing, key)
+		} else {
+			found = true
+		}
+	}
+
+	if !found {
+		return creds, false, nil
+	}
+
+	creds = TwitterAPICreds{
+		Username:         values[0],
+		APIKey:           values[1],
+		APIKeySecret:     values[2],
+		OAuthToken:       values[3],
+		OAuthTokenSecret: values[4],
+	}
+	if !creds.isValid() {
+		return creds, true, fmt.Errorf(
+			"%s is missing required variable(s): (%s)",
+			credsSetName(index),
+			strings.Join(missing, "), ("),
+		)
+	}
+
+	if weight := getenv(credsWeightEnvKey(index)); weight != "" {
+		creds.Weight, err = strconv.Atoi(weight)
+		if err != nil || creds.Weight < 1 {
+			return creds, true, fmt.Errorf(
+				"%s has an invalid weight (%s): must be a positive integer",
+				credsSetName(index),
+				weight,
+			)
+		}
+	}
+
+	return creds, true, nil
+}
+
+// credsIndexes returns the indexes of every suffixed credential variable in environ (a list of KEY=value pairs).
+func credsIndexes(environ []string) map[int]bool {
+	indexes := map[int]bool{}
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		if value == "" {
+			continue
+		}
+		for _, prefix := range append(credsEnvKeys(0), EnvWeight) {
+			suffix, ok := strings.CutPrefix(key, prefix+"_")
+			if !ok {
+				continue
+			}
+			if index, err := strconv.Atoi(suffix); err == nil && index > 0 {
+				indexes[index] = true
+			}
+		}
+	}
+	return indexes
+}
+
+// loadTwitterAPICreds collects every credential set declared in environ (a list of KEY=value pairs, as returned by os.Environ).
+// The unsuffixed set is optional, and indexed sets are read starting at 1 until the first index with no variables defined.
+// A set defined after that index is an error, rather than being silently ignored.
+func loadTwitterAPICreds(environ []string) ([]TwitterAPICreds, error) {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		env[key] = value
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+
+	var (
+		allCreds  = []TwitterAPICreds{}
+		usernames = make(map[string]int)
+		indexes   = credsIndexes(environ)
+	)
+
+	for index := 0; ; index++ {
+		creds, found, err := credsFromEnv(index, getenv)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			if index == 0 {
+				continue
+			}
+			for orphan := range indexes {
+				if orphan > index {
+					return nil, fmt.Errorf(
+						"%s is defined, but %s is missing: indexes must be consecutive",
+						credsSetName(orphan),
+						credsSetName(index),
+					)
+				}
+			}
+			break
+		}
+
+		if prev, ok := usernames[creds.Username]; ok {
+			return nil, fmt.Errorf(
+				"%s has the same username (%s) as %s",
+				credsSetName(index),
+				creds.Username,
+				credsSetName(prev),
+			)
+		}
+		usernames[creds.Username] = index
+
+		allCreds = append(allCreds, creds)
+	}
+
+	if len(allCreds) == 0 {
+		return nil, fmt.Errorf(
+			"at least (1) set of Twitter API credentials is required: (%s), (%s), (%s), (%s), (%s)",
+			EnvUsername, EnvAPIKey, EnvAPIKeySecret, EnvOAuthToken, EnvOAuthTokenSecret,
+		)
+	}
+
+	return allCreds, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadTwitterAPICreds(t *testing.T) {
+	type LoadTwitterAPICredsTest struct {
+		env       map[string]string
+		expected  []string
+		shouldErr bool
+	}
+
+	tests := []LoadTwitterAPICredsTest{
+		// No credentials
+		{
+			env:       map[string]string{},
+			expected:  nil,
+			shouldErr: true,
+		},
+
+		// Unsuffixed set only
+		{
+			env: map[string]string{
+				"USERNAME":            "alpha",
+				"API_KEY":             "a",
+				"API_KEY_SECRET":      "b",
+				"O_AUTH_TOKEN":        "c",
+				"O_AUTH_TOKEN_SECRET": "d",
+			},
+			expected:  []string{"alpha"},
+			shouldErr: false,
+		},
+
+		// Unsuffixed and indexed sets
+		{
+			env: map[string]string{
+				"USERNAME":              "alpha",
+				"API_KEY":               "a",
+				"API_KEY_SECRET":        "b",
+				"O_AUTH_TOKEN":          "c",
+				"O_AUTH_TOKEN_SECRET":   "d",
+				"USERNAME_1":            "bravo",
+				"API_KEY_1":             "a",
+				"API_KEY_SECRET_1":      "b",
+				"O_AUTH_TOKEN_1":        "c",
+				"O_AUTH_TOKEN_SECRET_1": "d",
+				"USERNAME_2":            "charlie",
+				"API_KEY_2":             "a",
+				"API_KEY_SECRET_2":      "b",
+				"O_AUTH_TOKEN_2":        "c",
+				"O_AUTH_TOKEN_SECRET_2": "d",
+			},
+			expected:  []string{"alpha", "bravo", "charlie"},
+			shouldErr: false,
+		},
+
+		// Indexed sets only
+		{
+			env: map[string]string{
+				"USERNAME_1":            "bravo",
+				"API_KEY_1":             "a",
+				"API_KEY_SECRET_1":      "b",
+				"O_AUTH_TOKEN_1":        "c",
+				"O_AUTH_TOKEN_SECRET_1": "d",
+			},
+			expected:  []string{"bravo"},
+			shouldErr: false,
+		},
+
+		// Gap in indexes
+		{
+			env: map[string]string{
+				"USERNAME_1":            "bravo",
+				"API_KEY_1":             "a",
+				"API_KEY_SECRET_1":      "b",
+				"O_AUTH_TOKEN_1":        "c",
+				"O_AUTH_TOKEN_SECRET_1": "d",
+				"USERNAME_3":            "delta",
+				"API_KEY_3":             "a",
+				"API_KEY_SECRET_3":      "b",
+				"O_AUTH_TOKEN_3":        "c",
+				"O_AUTH_TOKEN_SECRET_3": "d",
+			},
+			expected:  nil,
+			shouldErr: true,
+		},
+
+		// Gap before a weight only
+		{
+			env: map[string]string{
+				"USERNAME_1":            "bravo",
+				"API_KEY_1":             "a",
+				"API_KEY_SECRET_1":      "b",
+				"O_AUTH_TOKEN_1":        "c",
+				"O_AUTH_TOKEN_SECRET_1": "d",
+				"WEIGHT_4":              "2",
+			},
+			expected:  nil,
+			shouldErr: true,
+		},
+
+		// Partially specified set
+		{
+			env: map[string]string{
+				"USERNAME_1": "bravo",
+				"API_KEY_1":  "a",
+			},
+			expected:  nil,
+			shouldErr: true,
+		},
+
+		// Duplicate usernames
+		{
+			env: map[string]string{
+				"USERNAME_1":            "bravo",
+				"API_KEY_1":             "a",
+				"API_KEY_SECRET_1":      "b",
+				"O_AUTH_TOKEN_1":        "c",
+				"O_AUTH_TOKEN_SECRET_1": "d",
+				"USERNAME_2":            "bravo",
+				"API_KEY_2":             "e",
+				"API_KEY_SECRET_2":      "f",
+				"O_AUTH_TOKEN_2":        "g",
+				"O_AUTH_TOKEN_SECRET_2": "h",
+			},
+			expected:  nil,
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		environ := []string{}
+		for key, value := range test.env {
+			environ = append(environ, key+"="+value)
+		}
+
+		creds, err := loadTwitterAPICreds(environ)
+
+		var usernames []string
+		for _, c := range creds {
+			usernames = append(usernames, c.Username)
+		}
+		assert.Equal(t, test.expected, usernames)
+
+		if test.shouldErr {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
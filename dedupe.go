@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How long published content is remembered when DEDUPE_WINDOW is not set
+const defaultDedupeWindow = 24 * time.Hour
+
+// ContentHash records that an account published content with the hash, so the same content isn't published twice.
+type ContentHash struct {
+	Username    string    `json:"username"`
+	Hash        string    `json:"hash"`
+	TweetID     string    `json:"tweetID"`
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// DuplicateContentError is returned when an account already published the same content within the dedupe window.
+// It is never returned to API callers; the publish is reported as skipped instead.
+type DuplicateContentError struct {
+	Username    string
+	TweetID     string
+	PublishedAt time.Time
+}
+
+func (e *DuplicateContentError) Error() string {
+	return fmt.Sprintf(
+		"(%s) already published the same content as Tweet (%s) at %s",
+		e.Username,
+		e.TweetID,
+		e.PublishedAt.UTC().Format(time.RFC3339),
+	)
+}
+
+// parseDedupeWindow parses the DEDUPE_WINDOW env variable, where 0 disables duplicate suppression.
+func parseDedupeWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultDedupeWindow, nil
+	}
+
+	window, err := time.ParseDuration(s)
+	if err != nil || window < 0 {
+		return 0, fmt.Errorf("invalid dedupe window: %s", s)
+	}
+	return window, nil
+}
+
+// contentHashOf returns the hash identifying the content of the rendered tweet(s),
+// or an empty string if there is no content to compare (ex: a retweet, or a media-only tweet).
+func contentHashOf(rendered *RenderedTweet, dedupeKey string) string {
+	switch rendered.PublishTweetType {
+	case PublishTweetTypeRetweet, PublishTweetTypeUnretweet:
+		return ""
+	}
+
+	key := dedupeKey
+	if key == "" {
+		key = strings.Join(rendered.Texts, "\n")
+	}
+	if strings.TrimSpace(key) == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func contentHashID(username, hash string) string {
+	return username + "/" + hash
+}
+
+func (c *TwitterClient) dedupeEnabled() bool {
+	return c.contentHashes != nil && c.dedupeWindow > 0
+}
+
+// findDuplicate returns the record of username publishing the same content within the dedupe window.
+func (c *TwitterClient) findDuplicate(username, hash string, now time.Time) (*DuplicateContentError, bool) {
+	if !c.dedupeEnabled() || hash == "" {
+		return nil, false
+	}
+
+	record, ok := c.contentHashes.Get(contentHashID(username, hash))
+	if !ok || now.Sub(record.PublishedAt) >= c.dedupeWindow {
+		return nil, false
+	}
+
+	return &DuplicateContentError{
+		Username:    record.Username,
+		TweetID:     record.TweetID,
+		PublishedAt: record.PublishedAt,
+	}, true
+}
+
+// recordContentHash remembers that username published the content, and forgets content older than the dedupe window.
+func (c *TwitterClient) recordContentHash(username, hash, tweetID string, now time.Time) error {
+	if !c.dedupeEnabled() || hash == "" {
+		return nil
+	}
+
+	err := c.contentHashes.Set(contentHashID(username, hash), ContentHash{
+		Username:    username,
+		Hash:        hash,
+		TweetID:     tweetID,
+		PublishedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.contentHashes.DeleteFunc(func(_ string, record ContentHash) bool {
+		return now.Sub(record.PublishedAt) >= c.dedupeWindow
+	})
+}
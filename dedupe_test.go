@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDedupeWindow(t *testing.T) {
+	tests := []struct {
+		value     string
+		expected  time.Duration
+		shouldErr bool
+	}{
+		{"", defaultDedupeWindow, false},
+		{"0", 0, false},
+		{"90m", 90 * time.Minute, false},
+		{"-1h", 0, true},
+		{"a day", 0, true},
+	}
+
+	for _, test := range tests {
+		window, err := parseDedupeWindow(test.value)
+		assert.Equal(t, test.shouldErr, err != nil, test.value)
+		assert.Equal(t, test.expected, window, test.value)
+	}
+}
+
+func TestContentHashOf(t *testing.T) {
+	text := &RenderedTweet{PublishTweetType: PublishTweetTypeText, Texts: []string{"hello"}}
+	fetched := &RenderedTweet{PublishTweetType: PublishTweetTypeFetchJson, Texts: []string{"hello"}}
+
+	assert.NotEmpty(t, contentHashOf(text, ""))
+	assert.Equal(t, contentHashOf(text, ""), contentHashOf(fetched, ""))
+	assert.NotEqual(t, contentHashOf(text, ""), contentHashOf(text, "item-1"))
+
+	assert.Empty(t, contentHashOf(&RenderedTweet{PublishTweetType: PublishTweetTypeRetweet}, ""))
+	assert.Empty(t, contentHashOf(&RenderedTweet{PublishTweetType: PublishTweetTypeText, Texts: []string{""}}, ""))
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	created := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/tweets" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+			return
+		}
+
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		created = append(created, r.Header.Get("X-Test-Username")+": "+*in.Text)
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha", "bravo")
+	allowPrivateFetches(c)
+	c.contentHashes, _ = newStore[ContentHash]("")
+	c.dedupeWindow = time.Hour
+
+	t.Run("Test rendered text", func(t *testing.T) {
+		opts := PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"}
+
+		result, err := c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Skipped)
+
+		result, err = c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, PublishSkippedDuplicate, result.Skipped)
+		assert.Equal(t, "1000000000000000001", result.DuplicateOf)
+		assert.Equal(t, "alpha", result.Username)
+
+		// The history is kept per account
+		opts.Username = "bravo"
+		result, err = c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Skipped)
+
+		assert.Equal(t, []string{"alpha: hello", "bravo: hello"}, created)
+	})
+
+	t.Run("Test dedupeKey", func(t *testing.T) {
+		created = []string{}
+		item := map[string]any{"id": 1, "title": "First title"}
+		feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, map[string]any{"item": item})
+		}))
+		defer feed.Close()
+
+		opts := PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             "{*{ item.title }*}",
+			DedupeKey:        "item.id",
+		}
+
+		result, err := c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Skipped)
+
+		// An edited title of the same item is still a duplicate
+		item["title"] = "Edited title"
+		result, err = c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, PublishSkippedDuplicate, result.Skipped)
+
+		item["id"] = 2
+		result, err = c.publishTweet(opts)
+		assert.Nil(t, err)
+		assert.Empty(t, result.Skipped)
+
+		assert.Equal(t, []string{"alpha: First title", "alpha: Edited title"}, created)
+
+		opts.DedupeKey = "item.missing"
+		_, err = c.publishTweet(opts)
+		assert.NotNil(t, err)
+
+		// The key is only ever a path, so template syntax is an invalid path rather than part of a template
+		for _, key := range []string{"item.id }*}|* upper(x) *|{*{ item.id", "{{ item.id }}", "item.id | upper"} {
+			opts.DedupeKey = key
+			_, err = c.publishTweet(opts)
+			assert.IsType(t, &ValidationError{}, errors.Unwrap(err), key)
+		}
+		assert.Len(t, created, 2)
+	})
+
+	t.Run("Test content outside of the window", func(t *testing.T) {
+		created = []string{}
+		for _, record := range c.contentHashes.List() {
+			record.PublishedAt = record.PublishedAt.Add(-time.Hour)
+			c.contentHashes.Set(contentHashID(record.Username, record.Hash), record)
+		}
+
+		result, err := c.publishTweet(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"})
+		assert.Nil(t, err)
+		assert.Empty(t, result.Skipped)
+		assert.Equal(t, []string{"alpha: hello"}, created)
+	})
+}
+
+func TestRecordContentHashFailure(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": "hello"},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+	c.dedupeWindow = time.Hour
+
+	// The store can't be saved, because its directory is a file
+	file := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(file, nil, 0o600))
+	c.contentHashes, _ = newStore[ContentHash](filepath.Join(file, "content_hashes.json"))
+
+	// The tweet is live, so the publish still succeeds
+	result, err := c.publishTweet(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1000000000000000001"}, result.TweetIDs())
+}
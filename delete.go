@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/michimani/gotwi"
+	"github.com/michimani/gotwi/fields"
+	"github.com/michimani/gotwi/tweet/managetweet"
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/michimani/gotwi/tweet/tweetlookup"
+	tweetlookupTypes "github.com/michimani/gotwi/tweet/tweetlookup/types"
+)
+
+// The max number of published tweets that are recorded. The oldest records are removed first,
+// and their tweets can still be deleted by looking up their author.
+const maxPublishedTweets = 10000
+
+// PublishedTweet records which account in the client pool published a tweet.
+type PublishedTweet struct {
+	TweetID     string    `json:"tweetID"`
+	Username    string    `json:"username"`
+	Text        string    `json:"text,omitempty"`
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+type DeleteTweetResult struct {
+	TweetID  string `json:"tweetID"`
+	Username string `json:"username"`
+	Deleted  bool   `json:"deleted"`
+}
+
+func (c *TwitterClient) recordPublished(output *managetweetTypes.CreateOutput, username string) error {
+	if c.published == nil || output == nil || output.Data.ID == nil {
+		return nil
+	}
+
+	if err := c.published.Set(*output.Data.ID, PublishedTweet{
+		TweetID:     *output.Data.ID,
+		Username:    username,
+		Text:        gotwi.StringValue(output.Data.Text),
+		PublishedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	return c.prunePublished()
+}
+
+// prunePublished removes the oldest records of published tweets beyond maxPublishedTweets.
+func (c *TwitterClient) prunePublished() error {
+	records := c.published.List()
+	if len(records) <= maxPublishedTweets {
+		return nil
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].PublishedAt.After(records[j].PublishedAt)
+	})
+
+	stale := map[string]bool{}
+	for _, record := range records[maxPublishedTweets:] {
+		stale[record.TweetID] = true
+	}
+	return c.published.DeleteFunc(func(id string, _ PublishedTweet) bool {
+		return stale[id]
+	})
+}
+
+// findTweetOwner returns the username of the pool account that authored the tweet,
+// first from the record of published tweets, then by looking up the tweet's author.
+func (c *TwitterClient) findTweetOwner(tweetID string) (string, error) {
+	if c.published != nil {
+		if record, ok := c.published.Get(tweetID); ok {
+			if _, ok := c.pool.getByUsername(record.Username); ok {
+				return record.Username, nil
+			}
+		}
+	}
+
+	p := &tweetlookupTypes.GetInput{
+		ID:          tweetID,
+		TweetFields: fields.TweetFieldList{fields.TweetFieldAuthorID},
+	}
+	output, err := doWithPool(c, TwitterEndpointTweetLookup, "", func(pc *PoolClient) (*tweetlookupTypes.GetOutput, error) {
+		return tweetlookup.Get(context.Background(), pc.client, p)
+	})
+	if err != nil {
+		return "", fmt.Errorf("error looking up tweet ( %s ): %w", tweetID, err)
+	}
+
+	authorID := gotwi.StringValue(output.Data.AuthorID)
+	if authorID == "" {
+		return "", &TweetNotOwnedError{TweetID: tweetID}
+	}
+
+	// An account that can't be looked up is skipped, since it might not be the author anyway
+	var (
+		compared  bool
+		lookupErr error
+	)
+	for _, pc := range c.pool.clients {
+		userID, err := doWithPool(c, TwitterEndpointUserMe, pc.creds.Username, func(pc *PoolClient) (string, error) {
+			return c.getAuthedUserID(pc)
+		})
+		if err != nil {
+			lookupErr = fmt.Errorf("error looking up user ID of ( %s ): %w", pc.creds.Username, err)
+			c.LogErr(lookupErr)
+			continue
+		}
+		compared = true
+		if userID == authorID {
+			return pc.creds.Username, nil
+		}
+	}
+
+	// Without a single account to compare, the tweet can't be reported as not owned
+	if !compared && lookupErr != nil {
+		return "", lookupErr
+	}
+
+	return "", &TweetNotOwnedError{TweetID: tweetID}
+}
+
+// deleteTweet deletes the tweet using the client of the pool account that authored it.
+func (c *TwitterClient) deleteTweet(tweetID string) (*DeleteTweetResult, error) {
+	username, err := c.findTweetOwner(tweetID)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := doWithPool(c, TwitterEndpointDeleteTweet, username, func(pc *PoolClient) (*managetweetTypes.DeleteOutput, error) {
+		return managetweet.Delete(context.Background(), pc.client, &managetweetTypes.DeleteInput{ID: tweetID})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error deleting tweet ( %s ): %w", tweetID, err)
+	}
+
+	if c.published != nil {
+		if _, err := c.published.Delete(tweetID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &DeleteTweetResult{
+		TweetID:  tweetID,
+		Username: username,
+		Deleted:  gotwi.BoolValue(output.Data.Deleted),
+	}
+	c.webhooks.emit(WebhookEventTweetDeleted, result, "")
+
+	return result, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeleteTweet(t *testing.T) {
+	var (
+		deletedBy = map[string]string{}
+		lookups   = 0
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		username := r.Header.Get("X-Test-Username")
+
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/2/users/me" && username == "delta":
+			writeJSON(w, http.StatusInternalServerError, map[string]any{"title": "Internal Server Error"})
+		case r.Method == http.MethodGet && r.URL.Path == "/2/users/me":
+			writeJSON(w, http.StatusOK, map[string]any{
+				"data": map[string]string{"id": "id-" + username, "username": username},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/2/tweets/2000000000000000001":
+			lookups++
+			writeJSON(w, http.StatusOK, map[string]any{
+				"data": map[string]string{"id": "2000000000000000001", "author_id": "id-bravo"},
+			})
+		case r.Method == http.MethodGet && r.URL.Path == "/2/tweets/3000000000000000001":
+			lookups++
+			writeJSON(w, http.StatusOK, map[string]any{
+				"data": map[string]string{"id": "3000000000000000001", "author_id": "id-someone-else"},
+			})
+		case r.Method == http.MethodDelete:
+			deletedBy[r.URL.Path] = username
+			writeJSON(w, http.StatusOK, map[string]any{"data": map[string]bool{"deleted": true}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+	}
+
+	// The user ID of delta can't be looked up
+	c := newTestTwitterClient(t, handler, "delta", "alpha", "bravo", "charlie")
+	c.published, _ = newStore[PublishedTweet]("")
+	c.published.Set("1000000000000000001", PublishedTweet{TweetID: "1000000000000000001", Username: "charlie"})
+
+	t.Run("Test owner from record", func(t *testing.T) {
+		result, err := c.deleteTweet("1000000000000000001")
+		assert.Nil(t, err)
+		assert.Equal(t, "charlie", result.Username)
+		assert.True(t, result.Deleted)
+		assert.Equal(t, "charlie", deletedBy["/2/tweets/1000000000000000001"])
+		assert.Equal(t, 0, lookups)
+
+		_, ok := c.published.Get("1000000000000000001")
+		assert.False(t, ok)
+	})
+
+	t.Run("Test owner from lookup", func(t *testing.T) {
+		api := newTestAPI(c)
+		tweetUrl := url.PathEscape("https://twitter.com/bravo/status/2000000000000000001")
+
+		w := doTestRequest(api, http.MethodDelete, "/api/tweet/"+tweetUrl, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "bravo", deletedBy["/2/tweets/2000000000000000001"])
+		assert.Equal(t, 1, lookups)
+	})
+
+	t.Run("Test not owned", func(t *testing.T) {
+		_, err := c.deleteTweet("3000000000000000001")
+		var notOwnedErr *TweetNotOwnedError
+		assert.True(t, errors.As(err, &notOwnedErr))
+
+		api := newTestAPI(c)
+		w := doTestRequest(api, http.MethodDelete, "/api/tweet/3000000000000000001", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test invalid tweet ID", func(t *testing.T) {
+		api := newTestAPI(c)
+		w := doTestRequest(api, http.MethodDelete, "/api/tweet/abc", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Test other paths are cleaned", func(t *testing.T) {
+		api := newTestAPI(c)
+		w := doTestRequest(api, http.MethodGet, "/api//templates", nil)
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	})
+}
+
+func TestPrunePublished(t *testing.T) {
+	c := newTestTwitterClient(t, nil, "alpha")
+	c.published, _ = newStore[PublishedTweet]("")
+
+	start := time.Now()
+	for i := 0; i < maxPublishedTweets; i++ {
+		id := strconv.Itoa(i)
+		c.published.Set(id, PublishedTweet{TweetID: id, PublishedAt: start.Add(time.Duration(i) * time.Second)})
+	}
+
+	id := "1000000000000000001"
+	output := &managetweetTypes.CreateOutput{}
+	output.Data.ID = &id
+	assert.Nil(t, c.recordPublished(output, "alpha"))
+	assert.Len(t, c.published.List(), maxPublishedTweets)
+
+	_, ok := c.published.Get("0")
+	assert.False(t, ok)
+	_, ok = c.published.Get(id)
+	assert.True(t, ok)
+}
+
+func TestRecordPublishedFailure(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": "hello"},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+
+	// The store can't be saved, because its directory is a file
+	file := filepath.Join(t.TempDir(), "file")
+	assert.Nil(t, os.WriteFile(file, nil, 0o600))
+	c.published, _ = newStore[PublishedTweet](filepath.Join(file, "published_tweets.json"))
+
+	// The tweet is live, so the publish still succeeds
+	result, err := c.publishTweet(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1000000000000000001"}, result.TweetIDs())
+}
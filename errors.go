@@ -1,12 +1,167 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"time"
+
+	"github.com/michimani/gotwi"
+)
+
+// errInterruptedPublish fails a scheduled tweet or queued job that was being published when the service stopped.
+// It may or may not have been published, so it is failed rather than retried, which could publish a duplicate.
+var errInterruptedPublish = errors.New("interrupted by a restart while publishing")
+
+type APIErrCode string
+
+const (
+	APIErrCodeValidation     APIErrCode = "validation_error"
+	APIErrCodeInvalidText    APIErrCode = "invalid_tweet_text"
+	APIErrCodeNotFoundInPool APIErrCode = "username_not_in_pool"
+	APIErrCodeTweetNotOwned  APIErrCode = "tweet_not_owned"
+	APIErrCodeNotFound       APIErrCode = "not_found"
+	APIErrCodeConflict       APIErrCode = "conflict"
+	APIErrCodeKeyReused      APIErrCode = "idempotency_key_reused"
+	APIErrCodeQueueFull      APIErrCode = "queue_full"
+	APIErrCodeRateLimited    APIErrCode = "upstream_rate_limited"
+	APIErrCodeUpstreamAuth   APIErrCode = "upstream_auth_failure"
+	APIErrCodeUpstreamClient APIErrCode = "upstream_client_error"
+	APIErrCodeUpstreamServer APIErrCode = "upstream_server_error"
+	APIErrCodeFetchFailed    APIErrCode = "fetch_failed"
+	APIErrCodeInternal       APIErrCode = "internal_error"
 )
 
+type APIError struct {
+	Code   APIErrCode `json:"code"`
+	Detail string     `json:"detail,omitempty"`
+	Meta   any        `json:"meta,omitempty"`
+}
+
+// ValidationError is returned when a request can be rejected without calling the Twitter API.
+type ValidationError struct {
+	Msg string
+}
+
+func newValidationErr(format string, a ...any) *ValidationError {
+	return &ValidationError{Msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+type NotFoundInPoolError struct {
+	Username string
+}
+
+func (e *NotFoundInPoolError) Error() string {
+	return fmt.Sprintf("username (%s) not found in client pool", e.Username)
+}
+
+// TweetNotOwnedError is returned when no account in the client pool authored a tweet.
+type TweetNotOwnedError struct {
+	TweetID string
+}
+
+func (e *TweetNotOwnedError) Error() string {
+	return fmt.Sprintf("tweet (%s) was not authored by any account in the client pool", e.TweetID)
+}
+
+// NotFoundError is returned when a locally stored resource (ex: a scheduled tweet) does not exist.
+type NotFoundError struct {
+	Resource string
+	ID       string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s (%s) not found", e.Resource, e.ID)
+}
+
+// ConflictError is returned when a request conflicts with the current state of a resource.
+type ConflictError struct {
+	Msg string
+}
+
+func newConflictErr(format string, a ...any) *ConflictError {
+	return &ConflictError{Msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *ConflictError) Error() string {
+	return e.Msg
+}
+
+// FetchError is returned when the url of a fetch_json request could not be fetched.
+type FetchError struct {
+	Url string
+	Err error
+}
+
+func (e *FetchError) Error() string {
+	return fmt.Sprintf("error fetching url (%s): %s", e.Url, e.Err.Error())
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// ThreadPartialError is returned when some, but not all, parts of a thread were published.
+type ThreadPartialError struct {
+	Published int
+	Total     int
+	Err       error
+}
+
+func (e *ThreadPartialError) Error() string {
+	return fmt.Sprintf("published (%d) of (%d) thread parts before failing: %s", e.Published, e.Total, e.Err.Error())
+}
+
+func (e *ThreadPartialError) Unwrap() error {
+	return e.Err
+}
+
+// UpstreamError is returned when a Twitter API request made outside of gotwi returns a non-2XX response.
+type UpstreamError struct {
+	StatusCode int
+	Msg        string
+	RateLimit  *RateLimitState
+}
+
+func newUpstreamErr(resp *http.Response) *UpstreamError {
+	e := &UpstreamError{
+		StatusCode: resp.StatusCode,
+		Msg:        resp.Status,
+	}
+
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err == nil {
+		if len(body.Errors) > 0 && body.Errors[0].Message != "" {
+			e.Msg = body.Errors[0].Message
+		} else if body.Detail != "" {
+			e.Msg = body.Detail
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		e.RateLimit = rateLimitStateFromHeader(resp.Header, time.Now())
+	}
+
+	return e
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("the Twitter API returned status code (%d): %s", e.StatusCode, e.Msg)
+}
+
 func errInvalidTweetID(tweetID string) error {
-	return fmt.Errorf("tweet ID must be 19 characters long, and contain only numeric characters (received: %s)", tweetID)
+	return newValidationErr("tweet ID must be 19 characters long, and contain only numeric characters (received: %s)", tweetID)
 }
 
 func isRateLimitErr(err error) bool {
@@ -21,3 +176,69 @@ func isRateLimitErr(err error) bool {
 		"rate_limit",
 	)
 }
+
+// toAPIError maps an error to the HTTP status code and error body returned to API callers.
+func toAPIError(err error) (int, *APIError) {
+	var (
+		validationErr  *ValidationError
+		tweetTextErr   *TweetTextError
+		notFoundErr    *NotFoundInPoolError
+		notOwnedErr    *TweetNotOwnedError
+		notFoundResErr *NotFoundError
+		conflictErr    *ConflictError
+		keyReusedErr   *IdempotencyKeyReusedError
+		queueFullErr   *QueueFullError
+		rateLimitedErr *RateLimitedError
+		fetchErr       *FetchError
+		funcIpolErr    *FuncIpolError
+		gotwiErr       *gotwi.GotwiError
+		upstreamErr    *UpstreamError
+	)
+
+	switch {
+	case errors.As(err, &tweetTextErr):
+		return http.StatusBadRequest, &APIError{Code: APIErrCodeInvalidText, Detail: err.Error(), Meta: tweetTextErr.TweetTextInfo}
+	case errors.As(err, &validationErr), errors.As(err, &funcIpolErr):
+		return http.StatusBadRequest, &APIError{Code: APIErrCodeValidation, Detail: err.Error()}
+	case errors.As(err, &notFoundErr):
+		return http.StatusNotFound, &APIError{Code: APIErrCodeNotFoundInPool, Detail: notFoundErr.Error()}
+	case errors.As(err, &notOwnedErr):
+		return http.StatusNotFound, &APIError{Code: APIErrCodeTweetNotOwned, Detail: notOwnedErr.Error()}
+	case errors.As(err, &notFoundResErr):
+		return http.StatusNotFound, &APIError{Code: APIErrCodeNotFound, Detail: notFoundResErr.Error()}
+	case errors.As(err, &conflictErr):
+		return http.StatusConflict, &APIError{Code: APIErrCodeConflict, Detail: conflictErr.Error()}
+	case errors.As(err, &keyReusedErr):
+		return http.StatusUnprocessableEntity, &APIError{Code: APIErrCodeKeyReused, Detail: keyReusedErr.Error()}
+	case errors.As(err, &queueFullErr):
+		return http.StatusServiceUnavailable, &APIError{Code: APIErrCodeQueueFull, Detail: queueFullErr.Error()}
+	case errors.As(err, &rateLimitedErr):
+		return http.StatusTooManyRequests, &APIError{Code: APIErrCodeRateLimited, Detail: rateLimitedErr.Error()}
+	case errors.As(err, &fetchErr):
+		return http.StatusBadGateway, &APIError{Code: APIErrCodeFetchFailed, Detail: fetchErr.Error()}
+	case errors.As(err, &gotwiErr) && gotwiErr.OnAPI:
+		detail := gotwiErr.Detail
+		if detail == "" {
+			detail = gotwiErr.Title
+		}
+		if detail == "" && len(gotwiErr.APIErrors) > 0 {
+			detail = gotwiErr.APIErrors[0].Message
+		}
+		return toUpstreamAPIError(gotwiErr.StatusCode, detail)
+	case errors.As(err, &upstreamErr):
+		return toUpstreamAPIError(upstreamErr.StatusCode, upstreamErr.Msg)
+	}
+
+	return http.StatusInternalServerError, &APIError{Code: APIErrCodeInternal}
+}
+
+func toUpstreamAPIError(statusCode int, detail string) (int, *APIError) {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return http.StatusServiceUnavailable, &APIError{Code: APIErrCodeUpstreamAuth, Detail: detail}
+	case statusCode >= 500:
+		return http.StatusBadGateway, &APIError{Code: APIErrCodeUpstreamServer, Detail: detail}
+	default:
+		return http.StatusBadGateway, &APIError{Code: APIErrCodeUpstreamClient, Detail: detail}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/michimani/gotwi"
+	"github.com/michimani/gotwi/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToAPIError(t *testing.T) {
+	type ToAPIErrorTest struct {
+		err            error
+		expectedStatus int
+		expectedCode   APIErrCode
+	}
+
+	var newGotwiErr = func(statusCode int) error {
+		return &gotwi.GotwiError{
+			OnAPI:       true,
+			Non2XXError: resources.Non2XXError{StatusCode: statusCode},
+		}
+	}
+
+	tests := []ToAPIErrorTest{
+		{
+			err:            errors.New("something went wrong"),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   APIErrCodeInternal,
+		},
+		{
+			err:            errInvalidTweetID("123"),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   APIErrCodeValidation,
+		},
+		{
+			err:            fmt.Errorf("error creating tweet ( text ): %w", &NotFoundInPoolError{Username: "someone"}),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   APIErrCodeNotFoundInPool,
+		},
+		{
+			err:            fmt.Errorf("error creating tweet ( text ): %w", &RateLimitedError{}),
+			expectedStatus: http.StatusTooManyRequests,
+			expectedCode:   APIErrCodeRateLimited,
+		},
+		{
+			err:            &FuncIpolError{Call: "truncate(a, b)", Err: errors.New("invalid length")},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   APIErrCodeValidation,
+		},
+		{
+			err:            &FetchError{Url: "https://example.com", Err: errors.New("timeout")},
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   APIErrCodeFetchFailed,
+		},
+		{
+			err:            fmt.Errorf("error creating tweet ( text ): %w", newGotwiErr(http.StatusUnauthorized)),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   APIErrCodeUpstreamAuth,
+		},
+		{
+			err:            newGotwiErr(http.StatusForbidden),
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   APIErrCodeUpstreamClient,
+		},
+		{
+			err:            newGotwiErr(http.StatusServiceUnavailable),
+			expectedStatus: http.StatusBadGateway,
+			expectedCode:   APIErrCodeUpstreamServer,
+		},
+	}
+
+	for _, test := range tests {
+		status, apiErr := toAPIError(test.err)
+		assert.Equal(t, test.expectedStatus, status)
+		assert.Equal(t, test.expectedCode, apiErr.Code)
+	}
+
+	t.Run("Test writeErr() Retry-After", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		writeErr(w, &RateLimitedError{ResetAt: time.Now().Add(90 * time.Second)}, nil)
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "90", w.Header().Get(HTTPHeaderRetryAfter))
+
+		var resp APIResp
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.False(t, resp.Success)
+		assert.Equal(t, APIErrCodeRateLimited, resp.Error.Code)
+	})
+}
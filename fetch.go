@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Secrets are referenced as ${secret:NAME}, and resolved from the FETCH_SECRET_NAME env variable.
+// Only variables with the prefix can be referenced, so callers can't read the service's own credentials.
+var secretRefRegexp = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_]+)\}`)
+
+// Each secret can only be sent to the hosts listed in its FETCH_SECRET_NAME_HOSTS env variable,
+// so a caller can't send it to a host they control.
+const (
+	secretEnvPrefix      = "FETCH_SECRET_"
+	secretHostsEnvSuffix = "_HOSTS"
+)
+
+const redactedSecret = "[REDACTED]"
+
+// FetchOpts customizes the request made for a fetch_json tweet. The url, header values, body,
+// and basic auth credentials can reference secrets that are resolved server-side.
+type FetchOpts struct {
+	Method    string            `json:"method"`
+	Headers   map[string]string `json:"headers"`
+	Body      string            `json:"body"`
+	BasicAuth *FetchBasicAuth   `json:"basicAuth"`
+}
+
+type FetchBasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// String omits the header values and body, which may contain credentials.
+func (f *FetchOpts) String() string {
+	if f == nil {
+		return "<nil>"
+	}
+
+	names := make([]string, 0, len(f.Headers))
+	for name := range f.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return fmt.Sprintf(
+		"FetchOpts{ Method: %s, Headers: %v, Body: (%d bytes), BasicAuth: %t }",
+		f.method(),
+		names,
+		len(f.Body),
+		f.BasicAuth != nil,
+	)
+}
+
+func (f *FetchOpts) method() string {
+	if f == nil || f.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(f.Method)
+}
+
+func (f *FetchOpts) validate() error {
+	if f == nil {
+		return nil
+	}
+
+	switch f.method() {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return newValidationErr("invalid fetch method: %s", f.Method)
+	}
+
+	if f.Body != "" && f.method() == http.MethodGet {
+		return newValidationErr("a fetch body cannot be sent with method (%s)", http.MethodGet)
+	}
+
+	return nil
+}
+
+// secretResolver replaces secret references with their values, if the secret is bound to host.
+// It remembers the values so that they can be redacted from errors, and the hosts of every secret
+// it resolved so that redirects can be held to them.
+type secretResolver struct {
+	getenv func(string) string
+	host   string
+	values []string
+	hosts  [][]string
+}
+
+func (r *secretResolver) resolve(s string) (string, error) {
+	var err error
+	resolved := secretRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		if err != nil {
+			return ref
+		}
+
+		name := secretRefRegexp.FindStringSubmatch(ref)[1]
+		value := r.getenv(secretEnvPrefix + name)
+		if value == "" {
+			err = newValidationErr("unknown secret (%s)", name)
+			return ref
+		}
+
+		hosts := splitList(r.getenv(secretEnvPrefix + name + secretHostsEnvSuffix))
+		if len(hosts) == 0 {
+			err = newValidationErr("secret (%s) is not bound to any hosts (%s%s%s is not set)", name, secretEnvPrefix, name, secretHostsEnvSuffix)
+			return ref
+		}
+		if !matchesHost(r.host, hosts) {
+			err = newValidationErr("secret (%s) cannot be sent to host (%s)", name, r.host)
+			return ref
+		}
+
+		r.values = append(r.values, value)
+		r.hosts = append(r.hosts, hosts)
+		return value
+	})
+	return resolved, err
+}
+
+type secretHostsKey struct{}
+
+// checkSecretHosts returns an error if req carries secrets that aren't bound to its host,
+// which is the case for a redirect to another host.
+func checkSecretHosts(req *http.Request) error {
+	bindings, _ := req.Context().Value(secretHostsKey{}).([][]string)
+	for _, hosts := range bindings {
+		if !matchesHost(req.URL.Hostname(), hosts) {
+			return fmt.Errorf("secrets cannot be sent to host (%s)", req.URL.Hostname())
+		}
+	}
+	return nil
+}
+
+// redact removes the resolved secret values from err, which may include them (ex: the url of a *url.Error).
+func (r *secretResolver) redact(err error) error {
+	if err == nil || len(r.values) == 0 {
+		return err
+	}
+
+	msg := err.Error()
+	for _, value := range r.values {
+		msg = strings.ReplaceAll(msg, value, redactedSecret)
+	}
+	return errors.New(msg)
+}
+
+// newFetchRequest builds the request for a fetch_json tweet, with every secret reference resolved.
+func (o PublishTweetOpts) newFetchRequest(secrets *secretResolver) (*http.Request, error) {
+	f := o.Fetch
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	// The host is read before secrets are resolved, so a secret can't choose where secrets are sent
+	u, err := url.Parse(o.Url)
+	if err != nil {
+		return nil, newValidationErr("invalid url: %s", o.Url)
+	}
+	secrets.host = u.Hostname()
+
+	resolvedUrl, err := secrets.resolve(o.Url)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if f != nil && f.Body != "" {
+		resolvedBody, err := secrets.resolve(f.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(resolvedBody)
+	}
+
+	req, err := http.NewRequest(f.method(), resolvedUrl, body)
+	if err != nil {
+		return nil, secrets.redact(err)
+	}
+	if req.URL.Hostname() != secrets.host {
+		return nil, newValidationErr("secrets cannot be referenced in the url host")
+	}
+
+	if f != nil {
+		for name, value := range f.Headers {
+			resolvedValue, err := secrets.resolve(value)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(name, resolvedValue)
+		}
+		if body != nil && req.Header.Get(HTTPHeaderContentType) == "" {
+			req.Header.Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+		}
+
+		if f.BasicAuth != nil {
+			username, err := secrets.resolve(f.BasicAuth.Username)
+			if err != nil {
+				return nil, err
+			}
+			password, err := secrets.resolve(f.BasicAuth.Password)
+			if err != nil {
+				return nil, err
+			}
+			req.SetBasicAuth(username, password)
+		}
+	}
+
+	// Redirects are checked against the hosts of every secret the request carries
+	if len(secrets.hosts) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), secretHostsKey{}, secrets.hosts))
+	}
+	return req, nil
+}
+
+// fetch makes the request for a fetch_json tweet, and returns the response body.
+// Errors refer to the url as it was given, so resolved secrets are never included.
+func (o PublishTweetOpts) fetch(f *Fetcher) ([]byte, error) {
+	secrets := &secretResolver{getenv: os.Getenv}
+
+	req, err := o.newFetchRequest(secrets)
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, err
+		}
+		return nil, &FetchError{Url: o.Url, Err: err}
+	}
+
+	_, body, err := f.do(req, f.config.MaxBodyBytes, f.config.Timeout)
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, newValidationErr("%s", secrets.redact(err).Error())
+		}
+		return nil, &FetchError{Url: o.Url, Err: secrets.redact(err)}
+	}
+
+	return body, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetch(t *testing.T) {
+	f := newPrivateTestFetcher()
+	t.Setenv(secretEnvPrefix+"API_KEY", "super-secret-key")
+	t.Setenv(secretEnvPrefix+"PASSWORD", "super-secret-password")
+	t.Setenv(secretEnvPrefix+"UNBOUND", "unbound-secret")
+	t.Setenv(secretEnvPrefix+"API_KEY"+secretHostsEnvSuffix, "127.0.0.1")
+	t.Setenv(secretEnvPrefix+"PASSWORD"+secretHostsEnvSuffix, "127.0.0.1, *.example.com")
+
+	var received *http.Request
+	var receivedBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+			return
+		}
+		received = r
+		b, _ := io.ReadAll(r.Body)
+		receivedBody = string(b)
+		writeJSON(w, http.StatusOK, map[string]string{"headline": "Hello"})
+	}))
+	defer server.Close()
+
+	t.Run("Test default request", func(t *testing.T) {
+		body, err := PublishTweetOpts{Url: server.URL}.fetch(f)
+		assert.Nil(t, err)
+		assert.JSONEq(t, `{"headline":"Hello"}`, string(body))
+		assert.Equal(t, http.MethodGet, received.Method)
+	})
+
+	t.Run("Test method, headers, body and secrets", func(t *testing.T) {
+		_, err := PublishTweetOpts{
+			Url: server.URL + "/search?key=${secret:API_KEY}",
+			Fetch: &FetchOpts{
+				Method:    "post",
+				Headers:   map[string]string{"X-Api-Key": "${secret:API_KEY}", "Accept": "application/json"},
+				Body:      `{"query":"news"}`,
+				BasicAuth: &FetchBasicAuth{Username: "user", Password: "${secret:PASSWORD}"},
+			},
+		}.fetch(f)
+		assert.Nil(t, err)
+
+		assert.Equal(t, http.MethodPost, received.Method)
+		assert.Equal(t, "super-secret-key", received.URL.Query().Get("key"))
+		assert.Equal(t, "super-secret-key", received.Header.Get("X-Api-Key"))
+		assert.Equal(t, "application/json", received.Header.Get("Accept"))
+		assert.Equal(t, ContentTypeApplicationJson, received.Header.Get(HTTPHeaderContentType))
+		assert.Equal(t, `{"query":"news"}`, receivedBody)
+
+		username, password, ok := received.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "super-secret-password", password)
+	})
+
+	t.Run("Test invalid opts", func(t *testing.T) {
+		invalid := []PublishTweetOpts{
+			{Url: server.URL, Fetch: &FetchOpts{Method: "DELETE"}},
+			{Url: server.URL, Fetch: &FetchOpts{Body: "body"}},
+			{Url: server.URL, Fetch: &FetchOpts{Headers: map[string]string{"X-Api-Key": "${secret:MISSING}"}}},
+			// Only variables with the secret prefix can be referenced
+			{Url: server.URL + "?token=${secret:AUTH_TOKEN}"},
+			// Secrets are only sent to the hosts they're bound to
+			{Url: server.URL + "?key=${secret:UNBOUND}"},
+			{Url: "https://evil.example.org/?key=${secret:API_KEY}"},
+			{Url: "https://evil.example.org/", Fetch: &FetchOpts{Headers: map[string]string{"X-Api-Key": "${secret:API_KEY}"}}},
+			{Url: "https://${secret:API_KEY}/"},
+		}
+		for _, opts := range invalid {
+			_, err := opts.fetch(f)
+			assert.IsType(t, &ValidationError{}, err)
+		}
+	})
+
+	t.Run("Test redirects are held to the hosts of secrets", func(t *testing.T) {
+		received = nil
+
+		other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		_, err := PublishTweetOpts{Url: server.URL + "/redirect?key=${secret:API_KEY}&to=" + other}.fetch(f)
+		assert.IsType(t, &FetchError{}, err)
+		assert.Contains(t, err.Error(), "redirect blocked")
+		assert.Nil(t, received)
+
+		// Requests without secrets can still be redirected to another host
+		_, err = PublishTweetOpts{Url: server.URL + "/redirect?to=" + other}.fetch(f)
+		assert.Nil(t, err)
+		assert.NotNil(t, received)
+	})
+
+	t.Run("Test secrets are redacted from errors", func(t *testing.T) {
+		_, err := PublishTweetOpts{Url: "http://127.0.0.1:0/?key=${secret:API_KEY}"}.fetch(f)
+		assert.IsType(t, &FetchError{}, err)
+		assert.NotContains(t, err.Error(), "super-secret-key")
+	})
+
+	t.Run("Test String() omits credentials", func(t *testing.T) {
+		s := (&FetchOpts{
+			Headers:   map[string]string{"X-Api-Key": "raw-key"},
+			Body:      "raw-body",
+			BasicAuth: &FetchBasicAuth{Password: "raw-password"},
+		}).String()
+		assert.Contains(t, s, "X-Api-Key")
+		assert.NotContains(t, s, "raw-key")
+		assert.NotContains(t, s, "raw-body")
+		assert.NotContains(t, s, "raw-password")
+	})
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultFetchTimeout        = 10 * time.Second
+	defaultFetchConnectTimeout = 5 * time.Second
+	defaultFetchMaxBodyBytes   = 1024 * 1024
+	maxFetchRedirects          = 5
+)
+
+// Address ranges that aren't reachable on the public internet, beyond those reported by net.IP's methods
+var reservedIPNets = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+// isPrivateIP reports whether ip is a loopback, private, link-local, or otherwise non-public address.
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+
+	for _, ipNet := range reservedIPNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchConfig restricts the outbound requests made to fetch urls (ex: the url of a fetch_json tweet).
+type FetchConfig struct {
+	Timeout         time.Duration
+	ConnectTimeout  time.Duration
+	MaxBodyBytes    int64
+	AllowedSchemes  []string
+	AllowedHosts    []string
+	DeniedHosts     []string
+	AllowPrivateIPs bool
+}
+
+func defaultFetchConfig() FetchConfig {
+	return FetchConfig{
+		Timeout:        defaultFetchTimeout,
+		ConnectTimeout: defaultFetchConnectTimeout,
+		MaxBodyBytes:   defaultFetchMaxBodyBytes,
+		AllowedSchemes: []string{"http", "https"},
+	}
+}
+
+// splitList splits a comma-separated env variable, ignoring empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func loadFetchConfig(getenv func(string) string) (FetchConfig, error) {
+	config := defaultFetchConfig()
+
+	durations := []struct {
+		key   string
+		value *time.Duration
+	}{
+		{EnvFetchTimeout, &config.Timeout},
+		{EnvFetchConnectTimeout, &config.ConnectTimeout},
+	}
+	for _, d := range durations {
+		if s := getenv(d.key); s != "" {
+			value, err := time.ParseDuration(s)
+			if err != nil || value <= 0 {
+				return config, fmt.Errorf("invalid %s: %s", d.key, s)
+			}
+			*d.value = value
+		}
+	}
+
+	if s := getenv(EnvFetchMaxBodyBytes); s != "" {
+		value, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || value <= 0 {
+			return config, fmt.Errorf("invalid %s: %s", EnvFetchMaxBodyBytes, s)
+		}
+		config.MaxBodyBytes = value
+	}
+
+	if s := getenv(EnvFetchAllowedSchemes); s != "" {
+		config.AllowedSchemes = splitList(s)
+	}
+	config.AllowedHosts = splitList(getenv(EnvFetchAllowedHosts))
+	config.DeniedHosts = splitList(getenv(EnvFetchDeniedHosts))
+
+	if s := getenv(EnvFetchAllowPrivateIPs); s != "" {
+		value, err := strconv.ParseBool(s)
+		if err != nil {
+			return config, fmt.Errorf("invalid %s: %s", EnvFetchAllowPrivateIPs, s)
+		}
+		config.AllowPrivateIPs = value
+	}
+
+	return config, nil
+}
+
+// matchesHost reports whether host matches any of the patterns, where "*.example.com" matches any subdomain of example.com
+// (but not example.com itself). A "*" anywhere else in a pattern is matched literally.
+func matchesHost(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		if domain, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// checkUrl returns an error if the scheme or host of u isn't allowed by the config.
+func (c FetchConfig) checkUrl(u *url.URL) error {
+	scheme := strings.ToLower(u.Scheme)
+	allowed := false
+	for _, s := range c.AllowedSchemes {
+		allowed = allowed || s == scheme
+	}
+	if !allowed {
+		return fmt.Errorf("url scheme (%s) is not allowed", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if host == "" {
+		return errors.New("url has no host")
+	}
+	if matchesHost(host, c.DeniedHosts) {
+		return fmt.Errorf("url host (%s) is denied", host)
+	}
+	if len(c.AllowedHosts) > 0 && !matchesHost(host, c.AllowedHosts) {
+		return fmt.Errorf("url host (%s) is not allowed", host)
+	}
+
+	return nil
+}
+
+// Fetcher makes the outbound requests for fetch urls. Every connection is checked after DNS resolution,
+// so a host (or a redirect) that resolves to a private address is blocked.
+type Fetcher struct {
+	config FetchConfig
+	client *http.Client
+}
+
+func newFetcher(config FetchConfig) *Fetcher {
+	f := &Fetcher{config: config}
+
+	dialer := &net.Dialer{
+		Timeout: config.ConnectTimeout,
+		Control: f.checkConn,
+	}
+
+	f.client = &http.Client{
+		Transport: &http.Transport{
+			// A proxy would be dialed instead of the host, which would bypass the address check
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   config.ConnectTimeout,
+			ResponseHeaderTimeout: config.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+		},
+		CheckRedirect: f.checkRedirect,
+	}
+
+	return f
+}
+
+func (f *Fetcher) checkConn(network, address string, _ syscall.RawConn) error {
+	if f.config.AllowPrivateIPs {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+		return fmt.Errorf("connections to private address (%s) are not allowed", host)
+	}
+	return nil
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxFetchRedirects {
+		return fmt.Errorf("stopped after (%d) redirects", maxFetchRedirects)
+	}
+	if err := f.config.checkUrl(req.URL); err != nil {
+		return fmt.Errorf("redirect blocked: %w", err)
+	}
+	if err := checkSecretHosts(req); err != nil {
+		return fmt.Errorf("redirect blocked: %w", err)
+	}
+
+	// Headers may contain secrets meant for the original host only
+	if req.URL.Host != via[0].URL.Host {
+		req.Header = http.Header{}
+	}
+	return nil
+}
+
+// do makes the request, and returns the response along with its body, which is already read and closed.
+// The request is rejected with a *ValidationError if its url isn't allowed, and any failure after that
+// (including a non-2XX status, or a body larger than maxBytes) is returned as an error to be wrapped by the caller.
+// The whole request, including reading the body, must finish within timeout.
+func (f *Fetcher) do(req *http.Request, maxBytes int64, timeout time.Duration) (*http.Response, []byte, error) {
+	resp, err := f.open(req, timeout)
+	if err != nil {
+		return resp, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > maxBytes {
+		return resp, nil, fmt.Errorf("response body of (%d) bytes exceeds the limit of (%d) bytes", resp.ContentLength, maxBytes)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return resp, nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return resp, nil, fmt.Errorf("response body exceeds the limit of (%d) bytes", maxBytes)
+	}
+
+	return resp, body, nil
+}
+
+// open makes the request like do, but returns the response with its body left open,
+// so that a large body can be streamed. The caller must limit how much it reads, and close the body.
+// The whole request, including reading the body, must finish within timeout.
+func (f *Fetcher) open(req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if err := f.config.checkUrl(req.URL); err != nil {
+		return nil, newValidationErr("%s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		cancel()
+		return resp, fmt.Errorf("unexpected status code (%d)", resp.StatusCode)
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose cancels the context of a request once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
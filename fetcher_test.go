@@ -0,0 +1,244 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newPrivateTestFetcher returns a fetcher that can fetch from httptest servers, which listen on loopback addresses.
+func newPrivateTestFetcher() *Fetcher {
+	config := defaultFetchConfig()
+	config.AllowPrivateIPs = true
+	return newFetcher(config)
+}
+
+// allowPrivateFetches lets the client fetch from httptest servers.
+func allowPrivateFetches(c *TwitterClient) {
+	c.fetcher = newPrivateTestFetcher()
+}
+
+func TestLoadFetchConfig(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	config, err := loadFetchConfig(getenv)
+	assert.Nil(t, err)
+	assert.Equal(t, defaultFetchConfig(), config)
+
+	env = map[string]string{
+		EnvFetchTimeout:         "3s",
+		EnvFetchConnectTimeout:  "1s",
+		EnvFetchMaxBodyBytes:    "2048",
+		EnvFetchAllowedSchemes:  "HTTPS",
+		EnvFetchAllowedHosts:    "api.example.com, *.example.org",
+		EnvFetchDeniedHosts:     "bad.example.org",
+		EnvFetchAllowPrivateIPs: "true",
+	}
+	config, err = loadFetchConfig(getenv)
+	assert.Nil(t, err)
+	assert.Equal(t, FetchConfig{
+		Timeout:         3 * time.Second,
+		ConnectTimeout:  time.Second,
+		MaxBodyBytes:    2048,
+		AllowedSchemes:  []string{"https"},
+		AllowedHosts:    []string{"api.example.com", "*.example.org"},
+		DeniedHosts:     []string{"bad.example.org"},
+		AllowPrivateIPs: true,
+	}, config)
+
+	invalid := []map[string]string{
+		{EnvFetchTimeout: "soon"},
+		{EnvFetchConnectTimeout: "-1s"},
+		{EnvFetchMaxBodyBytes: "0"},
+		{EnvFetchAllowPrivateIPs: "maybe"},
+	}
+	for _, e := range invalid {
+		env = e
+		_, err := loadFetchConfig(getenv)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestIsPrivateIP(t *testing.T) {
+	private := []string{
+		"127.0.0.1",
+		"10.1.2.3",
+		"172.16.0.1",
+		"192.168.1.1",
+		"169.254.169.254",
+		"0.0.0.0",
+		"100.64.0.1",
+		"::1",
+		"fe80::1",
+		"fc00::1",
+		"::ffff:127.0.0.1",
+	}
+	for _, s := range private {
+		assert.True(t, isPrivateIP(net.ParseIP(s)), s)
+	}
+
+	public := []string{"1.1.1.1", "93.184.216.34", "2606:4700:4700::1111"}
+	for _, s := range public {
+		assert.False(t, isPrivateIP(net.ParseIP(s)), s)
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/large":
+			w.Write([]byte(strings.Repeat("a", 100)))
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		case "/redirect":
+			http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+		case "/headers":
+			w.Write([]byte(r.Header.Get("X-Api-Key")))
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	get := func(f *Fetcher, url string) ([]byte, error) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		_, body, err := f.do(req, f.config.MaxBodyBytes, f.config.Timeout)
+		return body, err
+	}
+
+	t.Run("Test private addresses are blocked", func(t *testing.T) {
+		f := newFetcher(defaultFetchConfig())
+
+		_, err := get(f, server.URL)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "private address")
+
+		_, err = get(f, strings.Replace(server.URL, "127.0.0.1", "localhost", 1))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test private addresses can be allowed", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+
+		body, err := get(newFetcher(config), server.URL)
+		assert.Nil(t, err)
+		assert.Equal(t, "ok", string(body))
+	})
+
+	t.Run("Test scheme and host lists", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+		config.AllowedHosts = []string{"*.example.com", "127.0.0.1"}
+		config.DeniedHosts = []string{"internal.example.com"}
+		f := newFetcher(config)
+
+		_, err := get(f, server.URL)
+		assert.Nil(t, err)
+
+		invalid := []string{
+			"ftp://api.example.com/file",
+			"file:///etc/passwd",
+			"https://example.org/feed",
+			"https://internal.example.com/feed",
+			"https://INTERNAL.example.com./feed",
+			"https://example.com/feed",
+			"https://evilexample.com/feed",
+		}
+		for _, url := range invalid {
+			_, err := get(f, url)
+			assert.IsType(t, &ValidationError{}, err, url)
+		}
+	})
+
+	t.Run("Test host wildcards", func(t *testing.T) {
+		patterns := []string{"*.example.com"}
+		assert.True(t, matchesHost("api.example.com", patterns))
+		assert.True(t, matchesHost("a.b.example.com", patterns))
+		assert.False(t, matchesHost("example.com", patterns))
+		assert.False(t, matchesHost("evilexample.com", patterns))
+
+		// Only the "*." form is a wildcard
+		assert.False(t, matchesHost("evilexample.com", []string{"*example.com"}))
+	})
+
+	t.Run("Test status code is checked", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+
+		_, err := get(newFetcher(config), server.URL+"/missing")
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "(404)")
+	})
+
+	t.Run("Test body size limit", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+		config.MaxBodyBytes = 99
+		f := newFetcher(config)
+
+		_, err := get(f, server.URL+"/large")
+		assert.NotNil(t, err)
+
+		f.config.MaxBodyBytes = 100
+		body, err := get(f, server.URL+"/large")
+		assert.Nil(t, err)
+		assert.Len(t, body, 100)
+	})
+
+	t.Run("Test redirects are checked", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+		config.DeniedHosts = []string{"localhost"}
+		f := newFetcher(config)
+
+		body, err := get(f, server.URL+"/redirect?to=/")
+		assert.Nil(t, err)
+		assert.Equal(t, "ok", string(body))
+
+		blocked := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		_, err = get(f, server.URL+"/redirect?to="+blocked)
+		assert.NotNil(t, err)
+		assert.Contains(t, err.Error(), "redirect blocked")
+
+		_, err = get(f, server.URL+"/redirect?to=file:///etc/passwd")
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test every connection is checked after DNS resolution", func(t *testing.T) {
+		// Redirects are dialed through the same check, so they can't reach a private address either
+		f := newFetcher(defaultFetchConfig())
+		assert.NotNil(t, f.checkConn("tcp4", "127.0.0.1:80", nil))
+		assert.NotNil(t, f.checkConn("tcp6", "[::1]:443", nil))
+		assert.NotNil(t, f.checkConn("tcp4", "169.254.169.254:80", nil))
+		assert.Nil(t, f.checkConn("tcp4", "93.184.216.34:443", nil))
+	})
+
+	t.Run("Test headers are dropped on cross-host redirects", func(t *testing.T) {
+		config := defaultFetchConfig()
+		config.AllowPrivateIPs = true
+		f := newFetcher(config)
+
+		other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/redirect?to="+other+"/headers", nil)
+		req.Header.Set("X-Api-Key", "secret")
+		_, body, err := f.do(req, config.MaxBodyBytes, config.Timeout)
+		assert.Nil(t, err)
+		assert.Empty(t, string(body))
+
+		req, _ = http.NewRequest(http.MethodGet, server.URL+"/redirect?to=/headers", nil)
+		req.Header.Set("X-Api-Key", "secret")
+		_, body, err = f.do(req, config.MaxBodyBytes, config.Timeout)
+		assert.Nil(t, err)
+		assert.Equal(t, "secret", string(body))
+	})
+}
@@ -7,8 +7,8 @@ require github.com/gorilla/mux v1.8.1
 require github.com/michimani/gotwi v0.16.1
 
 require (
-	github.com/EricFrancis12/stripol v0.0.0-20241202174442-52e8b4a438fd
 	github.com/joho/godotenv v1.5.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/stretchr/testify v1.10.0
 )
 
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func writeJSON(w http.ResponseWriter, status int, v any) error {
@@ -15,6 +20,10 @@ func writeOK(w http.ResponseWriter, data any) error {
 	return writeJSON(w, http.StatusOK, newAPIResp(true, "", data))
 }
 
+func writeAccepted(w http.ResponseWriter, data any) error {
+	return writeJSON(w, http.StatusAccepted, newAPIResp(true, "", data))
+}
+
 func redirectVisitor(w http.ResponseWriter, r *http.Request, url string) {
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
@@ -34,3 +43,51 @@ func writeNotFound(w http.ResponseWriter) error {
 func writeInternalServerError(w http.ResponseWriter, data any) error {
 	return writeJSON(w, http.StatusInternalServerError, newAPIResp(false, "internal server error", data))
 }
+
+// writeErr writes the status code and error body that corresponds to err.
+func writeErr(w http.ResponseWriter, err error, data any) error {
+	status, apiErr := toAPIError(err)
+
+	var rateLimitedErr *RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		seconds := math.Ceil(rateLimitedErr.RetryAfter(time.Now()).Seconds())
+		w.Header().Set(HTTPHeaderRetryAfter, strconv.Itoa(int(seconds)))
+	}
+
+	resp := newAPIResp(false, http.StatusText(status), data)
+	resp.Error = apiErr
+	return writeJSON(w, status, resp)
+}
+
+// writeReplay writes the stored response of a request with an Idempotency-Key.
+func writeReplay(w http.ResponseWriter, record *IdempotencyRecord) error {
+	w.Header().Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+	w.Header().Set(HTTPHeaderIdempotentReplayed, "true")
+	w.WriteHeader(record.StatusCode)
+	_, err := w.Write(record.Body)
+	return err
+}
+
+// responseRecorder captures the status code and body written to the wrapped ResponseWriter.
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w}
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.statusCode == 0 {
+		r.statusCode = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
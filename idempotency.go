@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long the response of a request with an Idempotency-Key is kept when IDEMPOTENCY_TTL is not set
+const defaultIdempotencyTTL = 24 * time.Hour
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the response stored for an Idempotency-Key.
+// A record that isn't completed belongs to a request that is still being handled.
+type IdempotencyRecord struct {
+	Key         string          `json:"key"`
+	RequestHash string          `json:"requestHash"`
+	Completed   bool            `json:"completed"`
+	StatusCode  int             `json:"statusCode,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	ExpiresAt   time.Time       `json:"expiresAt"`
+}
+
+// IdempotencyKeyReusedError is returned when an Idempotency-Key is sent again with a different request body.
+type IdempotencyKeyReusedError struct {
+	Key string
+}
+
+func (e *IdempotencyKeyReusedError) Error() string {
+	return fmt.Sprintf("Idempotency-Key (%s) was already used with a different request body", e.Key)
+}
+
+func parseIdempotencyTTL(s string) (time.Duration, error) {
+	if s == "" {
+		return defaultIdempotencyTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(s)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid idempotency ttl: %s", s)
+	}
+	return ttl, nil
+}
+
+// publishRequestHash identifies the content of a publish request, regardless of whether
+// it was sent as json or as a multipart form (whose boundary changes between retries).
+func publishRequestHash(opts PublishTweetOpts) string {
+	b, _ := json.Marshal(opts)
+
+	h := sha256.New()
+	h.Write(b)
+	for _, m := range opts.Media {
+		h.Write(m.body)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// IdempotencyKeys stores the responses of requests sent with an Idempotency-Key, so that retries are replayed
+// instead of being handled again.
+type IdempotencyKeys struct {
+	store *Store[IdempotencyRecord]
+	ttl   time.Duration
+	mu    sync.Mutex
+}
+
+func newIdempotencyKeys(store *Store[IdempotencyRecord], ttl time.Duration) *IdempotencyKeys {
+	return &IdempotencyKeys{
+		store: store,
+		ttl:   ttl,
+	}
+}
+
+// start releases the keys of requests that were still being handled when the service stopped,
+// which would otherwise respond with a conflict until they expire.
+func (k *IdempotencyKeys) start() error {
+	return k.store.DeleteFunc(func(_ string, record IdempotencyRecord) bool {
+		return !record.Completed
+	})
+}
+
+// begin claims the key for a request. If the key was already used with the same request,
+// the stored record is returned to be replayed. Otherwise a nil record means the request should be handled,
+// and must be followed by a call to complete.
+func (k *IdempotencyKeys) begin(key, requestHash string, now time.Time) (*IdempotencyRecord, error) {
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, newValidationErr("Idempotency-Key must not be longer than (%d) characters", maxIdempotencyKeyLength)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := k.store.DeleteFunc(func(_ string, record IdempotencyRecord) bool {
+		return !now.Before(record.ExpiresAt)
+	}); err != nil {
+		return nil, err
+	}
+
+	if record, ok := k.store.Get(key); ok {
+		if record.RequestHash != requestHash {
+			return nil, &IdempotencyKeyReusedError{Key: key}
+		}
+		if !record.Completed {
+			return nil, newConflictErr("a request with Idempotency-Key (%s) is still in progress", key)
+		}
+		return &record, nil
+	}
+
+	return nil, k.store.Set(key, IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(k.ttl),
+	})
+}
+
+// complete stores the response of the request that claimed the key.
+// Responses that may succeed when retried (server errors and rate limits) release the key instead,
+// unless something was published, since retrying would publish it again.
+func (k *IdempotencyKeys) complete(key string, statusCode int, body []byte, published bool) error {
+	retryable := statusCode == 0 || statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+	if retryable && !published {
+		_, err := k.store.Delete(key)
+		return err
+	}
+
+	_, err := k.store.Update(key, func(record IdempotencyRecord) (IdempotencyRecord, error) {
+		record.Completed = true
+		record.StatusCode = statusCode
+		record.Body = body
+		return record, nil
+	})
+	return err
+}
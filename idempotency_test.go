@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIdempotencyTTL(t *testing.T) {
+	ttl, err := parseIdempotencyTTL("")
+	assert.Nil(t, err)
+	assert.Equal(t, defaultIdempotencyTTL, ttl)
+
+	ttl, err = parseIdempotencyTTL("1h30m")
+	assert.Nil(t, err)
+	assert.Equal(t, 90*time.Minute, ttl)
+
+	for _, value := range []string{"0", "-1h", "a day"} {
+		_, err := parseIdempotencyTTL(value)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	store, _ := newStore[IdempotencyRecord]("")
+	k := newIdempotencyKeys(store, time.Hour)
+	now := time.Now()
+
+	record, err := k.begin("key", "hash", now)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	// The first request hasn't completed yet
+	_, err = k.begin("key", "hash", now)
+	assert.IsType(t, &ConflictError{}, err)
+
+	assert.Nil(t, k.complete("key", http.StatusOK, []byte(`{"success":true}`), true))
+
+	record, err = k.begin("key", "hash", now)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+	assert.JSONEq(t, `{"success":true}`, string(record.Body))
+
+	_, err = k.begin("key", "other-hash", now)
+	assert.IsType(t, &IdempotencyKeyReusedError{}, err)
+
+	// Expired keys can be used again
+	record, err = k.begin("key", "other-hash", now.Add(time.Hour))
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+
+	// Responses that may succeed when retried release the key
+	assert.Nil(t, k.complete("key", http.StatusBadGateway, nil, false))
+	_, ok := store.Get("key")
+	assert.False(t, ok)
+
+	// Keys of requests interrupted by a restart are released, while completed responses are kept
+	_, err = k.begin("interrupted", "hash", now)
+	assert.Nil(t, err)
+	_, err = k.begin("completed", "hash", now)
+	assert.Nil(t, err)
+	assert.Nil(t, k.complete("completed", http.StatusOK, []byte(`{"success":true}`), true))
+
+	assert.Nil(t, k.start())
+	record, err = k.begin("interrupted", "hash", now)
+	assert.Nil(t, err)
+	assert.Nil(t, record)
+	record, err = k.begin("completed", "hash", now)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, record.StatusCode)
+}
+
+func TestPublishTweetIdempotencyKey(t *testing.T) {
+	var (
+		created  = 0
+		fail     = false
+		failText = ""
+	)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		if fail || *in.Text == failText {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"title": "Service Unavailable"})
+			return
+		}
+
+		created++
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+	api := newTestAPI(newTestTwitterClient(t, handler, "alpha"))
+
+	doOptsRequest := func(key string, opts PublishTweetOpts) *httptest.ResponseRecorder {
+		b, _ := json.Marshal(opts)
+		r := httptest.NewRequest(http.MethodPost, "/api/tweet", NewByteReadCloser(b))
+		r.Header.Set(HTTPHeaderAuthorization, "Bearer "+testAuthToken)
+		r.Header.Set(HTTPHeaderIdempotencyKey, key)
+
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		return w
+	}
+	doRequest := func(key string, text string) *httptest.ResponseRecorder {
+		return doOptsRequest(key, PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: text})
+	}
+
+	first := doRequest("key-1", "hello")
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	replayed := doRequest("key-1", "hello")
+	assert.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get(HTTPHeaderIdempotentReplayed))
+	assert.Equal(t, first.Body.String(), replayed.Body.String())
+	assert.Equal(t, 1, created)
+
+	reused := doRequest("key-1", "goodbye")
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Equal(t, 1, created)
+
+	// A failed request can be retried with the same key
+	fail = true
+	assert.Equal(t, http.StatusBadGateway, doRequest("key-2", "goodbye").Code)
+	fail = false
+	assert.Equal(t, http.StatusOK, doRequest("key-2", "goodbye").Code)
+	assert.Equal(t, 2, created)
+
+	// A partly published thread is not published again when retried with the same key
+	failText = "second"
+	thread := PublishTweetOpts{PublishTweetType: PublishTweetTypeThread, Texts: []string{"first", "second"}}
+	partial := doOptsRequest("key-3", thread)
+	assert.Equal(t, http.StatusBadGateway, partial.Code)
+	assert.Equal(t, 3, created)
+
+	failText = ""
+	replayed = doOptsRequest("key-3", thread)
+	assert.Equal(t, http.StatusBadGateway, replayed.Code)
+	assert.Equal(t, "true", replayed.Header().Get(HTTPHeaderIdempotentReplayed))
+	assert.Equal(t, partial.Body.String(), replayed.Body.String())
+	assert.Equal(t, 3, created)
+}
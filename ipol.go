@@ -1,7 +1,12 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 type FuncIpolFn func(...string) (string, error)
@@ -10,61 +15,331 @@ type FuncIpol struct {
 	data       map[string]FuncIpolFn
 	leftDelim  string
 	rightDelim string
+	strict     bool
 }
 
 func newFuncIpol(leftDelim, rightDelim string) *FuncIpol {
-	return &FuncIpol{
+	f := &FuncIpol{
 		data:       make(map[string]FuncIpolFn),
 		leftDelim:  leftDelim,
 		rightDelim: rightDelim,
 	}
+	for name, fn := range stdIpolFns {
+		f.RegisterFn(name, fn)
+	}
+	return f
+}
+
+// Fn returns the registered function with the name.
+func (f *FuncIpol) Fn(name string) (FuncIpolFn, bool) {
+	fn, ok := f.data[name]
+	return fn, ok
 }
 
 func (f *FuncIpol) RegisterFn(name string, fn FuncIpolFn) {
 	f.data[strings.Trim(name, " ")] = fn
 }
 
+// Eval replaces each function call between the delimiters with its result. A call is written as name(args),
+// where each argument is either a nested call, a quoted string ("..." or '...', with backslash escapes), or bare text,
+// which is trimmed and can't contain commas or unbalanced parentheses.
+//
+// If a call can't be parsed or its function fails, the original text is kept, unless f is strict,
+// in which case the error is returned.
 func (f *FuncIpol) Eval(s string) (string, error) {
-	partsA := strings.Split(s, f.leftDelim)
+	return f.EvalValues(s, nil)
+}
 
-	for i, a := range partsA {
-		if !strings.Contains(a, f.rightDelim) {
-			continue
+// EvalValues is Eval, where s can reference values (as written by funcIpolValueRef) that are substituted
+// once the arguments are parsed. A value is never parsed itself, so its commas, parentheses,
+// and quotes remain part of the argument that references it.
+func (f *FuncIpol) EvalValues(s string, values []string) (string, error) {
+	var sb strings.Builder
+
+	for {
+		start := strings.Index(s, f.leftDelim)
+		if start == -1 {
+			sb.WriteString(s)
+			return sb.String(), nil
 		}
+		sb.WriteString(s[:start])
+		s = s[start:]
 
-		partsB := strings.Split(a, f.rightDelim)
-		if len(partsB) == 0 {
+		p := &funcIpolParser{src: s, pos: len(f.leftDelim), rightDelim: f.rightDelim, values: values}
+		result, err := p.parse(f)
+		if err == nil {
+			sb.WriteString(result)
+			s = s[p.pos:]
 			continue
 		}
+		if f.strict {
+			return "", err
+		}
 
-		trimmed := strings.TrimSpace(partsB[0])
-		partsC := strings.Split(trimmed, "(")
-		if len(partsC) < 2 {
-			continue
+		// Keep the original text of the call, or only the delimiter if the call is never closed
+		end := len(f.leftDelim)
+		if !errors.Is(err, errFuncIpolUnclosed) {
+			if i := strings.Index(s[end:], f.rightDelim); i != -1 {
+				end += i + len(f.rightDelim)
+			}
 		}
+		sb.WriteString(expandFuncIpolValues(s[:end], values))
+		s = s[end:]
+	}
+}
 
-		if popStr(&partsC[len(partsC)-1]) != ")" {
-			continue
+// References to values are wrapped in private use characters, which can't be mistaken for the syntax of a call
+const (
+	funcIpolValueRefStart = "\uE000"
+	funcIpolValueRefEnd   = "\uE001"
+)
+
+var funcIpolValueRefRegexp = regexp.MustCompile(funcIpolValueRefStart + `(\d+)` + funcIpolValueRefEnd)
+
+// funcIpolValueRef returns the reference to the value at index i, as passed to EvalValues.
+func funcIpolValueRef(i int) string {
+	return funcIpolValueRefStart + strconv.Itoa(i) + funcIpolValueRefEnd
+}
+
+func expandFuncIpolValues(s string, values []string) string {
+	if len(values) == 0 {
+		return s
+	}
+	return funcIpolValueRefRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+		i, _ := strconv.Atoi(funcIpolValueRefRegexp.FindStringSubmatch(ref)[1])
+		if i >= len(values) {
+			return ref
 		}
+		return values[i]
+	})
+}
 
-		var (
-			name = partsC[0]
-			args = strings.Split(partsC[1], ",")
-		)
+// SetStrict sets whether Eval returns the errors of calls, instead of keeping their original text.
+func (f *FuncIpol) SetStrict(strict bool) {
+	f.strict = strict
+}
 
-		fn, ok := f.data[name]
-		if !ok {
-			continue
+var errFuncIpolUnclosed = errors.New("function call is missing its closing delimiter")
+
+// FuncIpolError is returned by a strict FuncIpol when a function call can't be parsed, or its function fails.
+type FuncIpolError struct {
+	Call string
+	Err  error
+}
+
+func (e *FuncIpolError) Error() string {
+	return fmt.Sprintf("error evaluating (%s): %s", e.Call, e.Err.Error())
+}
+
+func (e *FuncIpolError) Unwrap() error {
+	return e.Err
+}
+
+type funcIpolParser struct {
+	src        string
+	pos        int
+	rightDelim string
+	values     []string
+}
+
+// parse parses and evaluates the call starting at p.pos, and moves p.pos past the closing delimiter.
+func (p *funcIpolParser) parse(f *FuncIpol) (string, error) {
+	start := p.pos
+
+	result, err := p.parseCall(f)
+	if err == nil {
+		p.skipSpace()
+		if !strings.HasPrefix(p.src[p.pos:], p.rightDelim) {
+			err = fmt.Errorf("expected %s at position (%d)", p.rightDelim, p.pos)
+		}
+	}
+	if err != nil {
+		call := p.src[start:]
+		if i := strings.Index(call, p.rightDelim); i != -1 {
+			call = call[:i]
 		}
+		return "", &FuncIpolError{Call: expandFuncIpolValues(strings.TrimSpace(call), p.values), Err: err}
+	}
+
+	p.pos += len(p.rightDelim)
+	return result, nil
+}
+
+func (p *funcIpolParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *funcIpolParser) eof() error {
+	if p.pos >= len(p.src) {
+		return errFuncIpolUnclosed
+	}
+	return nil
+}
+
+// parseCall parses and evaluates name(args) starting at p.pos.
+func (p *funcIpolParser) parseCall(f *FuncIpol) (string, error) {
+	p.skipSpace()
 
-		s, err := fn(args...)
+	name := p.parseIdent()
+	if name == "" {
+		if err := p.eof(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("expected a function name at position (%d)", p.pos)
+	}
+
+	p.skipSpace()
+	if err := p.eof(); err != nil {
+		return "", err
+	}
+	if p.src[p.pos] != '(' {
+		return "", fmt.Errorf("expected ( after (%s)", name)
+	}
+	p.pos++
+
+	args := []string{}
+	for {
+		p.skipSpace()
+		if err := p.eof(); err != nil {
+			return "", err
+		}
+		if p.src[p.pos] == ')' && len(args) == 0 {
+			p.pos++
+			break
+		}
+
+		arg, err := p.parseArg(f)
 		if err != nil {
-			continue
+			return "", err
+		}
+		args = append(args, arg)
+
+		p.skipSpace()
+		if err := p.eof(); err != nil {
+			return "", err
+		}
+		if p.src[p.pos] == ')' {
+			p.pos++
+			break
+		}
+		if p.src[p.pos] != ',' {
+			return "", fmt.Errorf("expected , or ) at position (%d)", p.pos)
+		}
+		p.pos++
+	}
+
+	fn, ok := f.data[name]
+	if !ok {
+		return "", fmt.Errorf("unknown function (%s)", name)
+	}
+
+	result, err := fn(args...)
+	if err != nil {
+		return "", err
+	}
+	return result, nil
+}
+
+func (p *funcIpolParser) parseIdent() string {
+	start := p.pos
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && (p.pos == start || !isDigit) {
+			break
 		}
-		partsB[0] = s
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
 
-		partsA[i] = strings.Join(partsB, "")
+// parseArg parses a nested call, quoted string, or bare text starting at p.pos.
+func (p *funcIpolParser) parseArg(f *FuncIpol) (string, error) {
+	switch p.src[p.pos] {
+	case '"', '\'':
+		s, err := p.parseString()
+		if err != nil {
+			return "", err
+		}
+		return expandFuncIpolValues(s, p.values), nil
+	}
+
+	// A nested call is an identifier followed by (
+	start := p.pos
+	if ident := p.parseIdent(); ident != "" {
+		end := p.pos
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '(' {
+			p.pos = start
+			return p.parseCall(f)
+		}
+		p.pos = end
+	}
+	p.pos = start
+
+	depth := 0
+	for ; p.pos < len(p.src); p.pos++ {
+		if strings.HasPrefix(p.src[p.pos:], p.rightDelim) {
+			break
+		}
+
+		c := p.src[p.pos]
+		if c == '(' {
+			depth++
+		} else if c == ')' {
+			if depth == 0 {
+				break
+			}
+			depth--
+		} else if c == ',' && depth == 0 {
+			break
+		}
+	}
+	if err := p.eof(); err != nil {
+		return "", err
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("unbalanced ( in argument (%s)", p.src[start:p.pos])
+	}
+
+	return expandFuncIpolValues(strings.TrimSpace(p.src[start:p.pos]), p.values), nil
+}
+
+// parseString parses a quoted string starting at p.pos, where a backslash escapes the next character
+// (\n and \t are a newline and tab).
+func (p *funcIpolParser) parseString() (string, error) {
+	quote := p.src[p.pos]
+	start := p.pos
+	p.pos++
+
+	var sb strings.Builder
+	for ; p.pos < len(p.src); p.pos++ {
+		c := p.src[p.pos]
+		switch c {
+		case quote:
+			p.pos++
+			return sb.String(), nil
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.src) {
+				break
+			}
+			switch p.src[p.pos] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(p.src[p.pos])
+			}
+		default:
+			sb.WriteByte(c)
+		}
 	}
 
-	return strings.Join(partsA, ""), nil
+	p.pos = start
+	return "", fmt.Errorf("unterminated string at position (%d)", start)
 }
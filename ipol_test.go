@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"testing"
@@ -49,6 +50,69 @@ func TestFuncIpol(t *testing.T) {
 			expected:  "This url is path-escaped: https:%2F%2Fexample.com%2Fnews%2Foffbeat%2Fvideo-bear-swim-swimming-pool",
 			shouldErr: false,
 		},
+
+		// Quoted arguments
+		{
+			input:     `|* replace("a, b, c", ", ", " & ") *|`,
+			expected:  "a & b & c",
+			shouldErr: false,
+		},
+		{
+			input:     `|* replace('say "hi"', '"', "'") *|`,
+			expected:  "say 'hi'",
+			shouldErr: false,
+		},
+		{
+			input:     `|* upper("escaped \"quote\" and \\ backslash") *|`,
+			expected:  `ESCAPED "QUOTE" AND \ BACKSLASH`,
+			shouldErr: false,
+		},
+		{
+			input:     `|* upper("(not a call), *| inside") *|`,
+			expected:  "(NOT A CALL), *| INSIDE",
+			shouldErr: false,
+		},
+
+		// Nested calls
+		{
+			input:     "|* truncate(upper(hello world), 8) *|",
+			expected:  "HELLO W…",
+			shouldErr: false,
+		},
+		{
+			input:     `|*default(lower(""), replace(n/a, /, " "))*| and |*upper(b)*|`,
+			expected:  "n a and B",
+			shouldErr: false,
+		},
+
+		// Bare text with balanced parentheses
+		{
+			input:     "|* pathEscape(https://example.com/wiki/Go_(language)) *|",
+			expected:  "https:%2F%2Fexample.com%2Fwiki%2FGo_%28language%29",
+			shouldErr: false,
+		},
+
+		// Calls that can't be evaluated are kept
+		{
+			input:     "a |* unknown(b) *| c",
+			expected:  "a |* unknown(b) *| c",
+			shouldErr: false,
+		},
+		{
+			input:     "|* truncate(hello, none) *|",
+			expected:  "|* truncate(hello, none) *|",
+			shouldErr: false,
+		},
+		{
+			input:     "|* upper(a *| then |* upper(b) *|",
+			expected:  "|* upper(a *| then B",
+			shouldErr: false,
+		},
+		{
+			input:     "5 |* 3",
+			expected:  "5 |* 3",
+			shouldErr: false,
+		},
 	}
 
 	for _, test := range tests {
@@ -61,3 +125,35 @@ func TestFuncIpol(t *testing.T) {
 		}
 	}
 }
+
+func TestFuncIpolStrict(t *testing.T) {
+	f := newFuncIpol("|*", "*|")
+	f.SetStrict(true)
+	f.RegisterFn("fail", func(args ...string) (string, error) {
+		return "", errors.New("failed on purpose")
+	})
+
+	s, err := f.Eval(`|* upper(truncate("a, b", 10)) *|`)
+	assert.Nil(t, err)
+	assert.Equal(t, "A, B", s)
+
+	invalid := []string{
+		"|* fail() *|",
+		"|* upper(fail(x)) *|",
+		"|* unknown(x) *|",
+		"|* truncate(hello, none) *|",
+		"|* upper(a, b) *|",
+		`|* upper("unterminated) *|`,
+		"|* upper(a(b) *|",
+		"|* upper(a) extra *|",
+		"|* upper(a)",
+		"|* (a) *|",
+	}
+	for _, input := range invalid {
+		_, err := f.Eval(input)
+		assert.IsType(t, &FuncIpolError{}, err, input)
+	}
+
+	_, err = f.Eval("|* fail() *|")
+	assert.ErrorContains(t, err, "failed on purpose")
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const defaultEllipsis = "…"
+
+// Functions registered on every FuncIpol, which are also available to template pipelines.
+// The value being formatted is always the first argument.
+var stdIpolFns = map[string]FuncIpolFn{
+	"truncate":     ipolTruncate,
+	"upper":        ipolStringFn("upper", strings.ToUpper),
+	"lower":        ipolStringFn("lower", strings.ToLower),
+	"title":        ipolStringFn("title", titleCase),
+	"pathEscape":   ipolStringFn("pathEscape", url.PathEscape),
+	"queryEscape":  ipolStringFn("queryEscape", url.QueryEscape),
+	"stripHTML":    ipolStringFn("stripHTML", stripHTML),
+	"formatNumber": ipolFormatNumber,
+	"formatDate":   ipolFormatDate,
+	"relativeTime": ipolRelativeTime,
+	"hashtagify":   ipolHashtagify,
+	"replace":      ipolReplace,
+	"regexReplace": ipolRegexReplace,
+	"default":      ipolDefault,
+}
+
+// Replaced in tests to render relative times against a fixed time
+var ipolNow = time.Now
+
+func checkIpolArgs(name string, args []string, min, max int) error {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	if min == max {
+		noun := "arguments"
+		if min == 1 {
+			noun = "argument"
+		}
+		return fmt.Errorf("%s requires %d %s, but got (%d) arguments instead", name, min, noun, len(args))
+	}
+	return fmt.Errorf("%s requires between %d and %d arguments, but got (%d) arguments instead", name, min, max, len(args))
+}
+
+// ipolStringFn wraps a function of a single string.
+func ipolStringFn(name string, fn func(string) string) FuncIpolFn {
+	return func(args ...string) (string, error) {
+		if err := checkIpolArgs(name, args, 1, 1); err != nil {
+			return "", err
+		}
+		return fn(args[0]), nil
+	}
+}
+
+// truncate(s, length, [ellipsis]) shortens s to at most length characters, including the ellipsis (default "…").
+func ipolTruncate(args ...string) (string, error) {
+	if err := checkIpolArgs("truncate", args, 2, 3); err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(args[1]))
+	if err != nil || n < 1 {
+		return "", fmt.Errorf("truncate length must be a positive integer (received: %s)", args[1])
+	}
+
+	ellipsis := defaultEllipsis
+	if len(args) == 3 {
+		ellipsis = args[2]
+	}
+
+	return truncate(args[0], n, ellipsis), nil
+}
+
+// truncate shortens s to at most n characters, ending with ellipsis if it was shortened.
+func truncate(s string, n int, ellipsis string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	e := []rune(ellipsis)
+	if len(e) >= n {
+		return string(runes[:n])
+	}
+	return strings.TrimRightFunc(string(runes[:n-len(e)]), unicode.IsSpace) + ellipsis
+}
+
+// titleCase capitalizes the first letter of each word, and lowercases the rest.
+func titleCase(s string) string {
+	runes := []rune(strings.ToLower(s))
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '-' {
+			runes[i] = unicode.ToTitle(r)
+		}
+	}
+	return string(runes)
+}
+
+var (
+	htmlHiddenRegexp     = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)\s*>`)
+	htmlTagRegexp        = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlWhitespaceRegexp = regexp.MustCompile(`[ \t]+`)
+)
+
+// stripHTML removes html tags (and the contents of script and style tags), and unescapes entities.
+func stripHTML(s string) string {
+	s = htmlHiddenRegexp.ReplaceAllString(s, "")
+	s = htmlTagRegexp.ReplaceAllString(s, "")
+	s = htmlWhitespaceRegexp.ReplaceAllString(s, " ")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+var numberSuffixes = []string{"", "K", "M", "B", "T"}
+
+// formatNumber(n, [decimals]) abbreviates n with a suffix (ex: 1.2K, 3.4M), rounded to decimals places (default 1).
+func ipolFormatNumber(args ...string) (string, error) {
+	if err := checkIpolArgs("formatNumber", args, 1, 2); err != nil {
+		return "", err
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(args[0]), 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return "", fmt.Errorf("formatNumber requires a number (received: %s)", args[0])
+	}
+
+	decimals := 1
+	if len(args) == 2 {
+		if decimals, err = strconv.Atoi(strings.TrimSpace(args[1])); err != nil || decimals < 0 || decimals > 3 {
+			return "", fmt.Errorf("formatNumber decimals must be between (0) and (3) (received: %s)", args[1])
+		}
+	}
+
+	return formatNumber(n, decimals), nil
+}
+
+func formatNumber(n float64, decimals int) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+
+	unit := 0
+	for n >= 1000 && unit < len(numberSuffixes)-1 {
+		n /= 1000
+		unit++
+	}
+
+	s := strconv.FormatFloat(n, 'f', decimals, 64)
+	// Rounding can carry into the next unit (ex: 999,999 -> 1000.0K -> 1M)
+	if s == strconv.FormatFloat(1000, 'f', decimals, 64) && unit < len(numberSuffixes)-1 {
+		s = strconv.FormatFloat(1, 'f', decimals, 64)
+		unit++
+	}
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+
+	return sign + s + numberSuffixes[unit]
+}
+
+// Layouts that formatDate accepts by name, besides Go layouts
+var namedDateLayouts = map[string]string{
+	"RFC3339":  time.RFC3339,
+	"RFC1123":  time.RFC1123,
+	"RFC822":   time.RFC822,
+	"Kitchen":  time.Kitchen,
+	"DateTime": time.DateTime,
+	"DateOnly": time.DateOnly,
+	"TimeOnly": time.TimeOnly,
+}
+
+// Layouts that dates are parsed from, unless they're unix timestamps
+var parseDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	time.DateTime,
+	time.DateOnly,
+	"2006-01-02T15:04:05",
+}
+
+// parseDate parses a date from one of the parseDateLayouts, or from a unix timestamp in seconds or milliseconds.
+func parseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 || n < -1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+
+	for _, layout := range parseDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date (%s)", s)
+}
+
+// formatDate(date, layout, [timezone]) formats the date with a Go layout (or a name such as RFC3339), in the timezone (default UTC).
+func ipolFormatDate(args ...string) (string, error) {
+	if err := checkIpolArgs("formatDate", args, 2, 3); err != nil {
+		return "", err
+	}
+
+	t, err := parseDate(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	layout := args[1]
+	if named, ok := namedDateLayouts[strings.TrimSpace(layout)]; ok {
+		layout = named
+	}
+
+	loc := time.UTC
+	if len(args) == 3 {
+		if loc, err = time.LoadLocation(strings.TrimSpace(args[2])); err != nil {
+			return "", fmt.Errorf("invalid timezone (%s)", args[2])
+		}
+	}
+
+	return t.In(loc).Format(layout), nil
+}
+
+var relativeTimeUnits = []struct {
+	name string
+	d    time.Duration
+}{
+	{"year", 365 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"day", 24 * time.Hour},
+	{"hour", time.Hour},
+	{"minute", time.Minute},
+}
+
+// relativeTime(date) describes the date relative to now (ex: 3 hours ago, in 2 days).
+func ipolRelativeTime(args ...string) (string, error) {
+	if err := checkIpolArgs("relativeTime", args, 1, 1); err != nil {
+		return "", err
+	}
+
+	t, err := parseDate(args[0])
+	if err != nil {
+		return "", err
+	}
+
+	return relativeTime(t, ipolNow()), nil
+}
+
+func relativeTime(t, now time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	for _, unit := range relativeTimeUnits {
+		if d < unit.d {
+			continue
+		}
+
+		n := int(d / unit.d)
+		s := fmt.Sprintf("%d %s", n, unit.name)
+		if n != 1 {
+			s += "s"
+		}
+		if future {
+			return "in " + s
+		}
+		return s + " ago"
+	}
+
+	return "just now"
+}
+
+// hashtagify(s) turns s into a hashtag by joining its words in title case (ex: "go release notes" -> #GoReleaseNotes).
+func ipolHashtagify(args ...string) (string, error) {
+	if err := checkIpolArgs("hashtagify", args, 1, 1); err != nil {
+		return "", err
+	}
+
+	var (
+		sb        strings.Builder
+		wordStart = true
+		hasLetter = false
+	)
+	for _, r := range args[0] {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			wordStart = true
+			continue
+		}
+
+		if wordStart {
+			r = unicode.ToUpper(r)
+			wordStart = false
+		}
+		hasLetter = hasLetter || !unicode.IsDigit(r)
+		sb.WriteRune(r)
+	}
+
+	// Hashtags can't be only numbers
+	if !hasLetter {
+		return "", fmt.Errorf("cannot make a hashtag from (%s)", args[0])
+	}
+	return "#" + sb.String(), nil
+}
+
+// replace(s, old, new) replaces every occurrence of old with new.
+func ipolReplace(args ...string) (string, error) {
+	if err := checkIpolArgs("replace", args, 3, 3); err != nil {
+		return "", err
+	}
+	if args[1] == "" {
+		return "", fmt.Errorf("replace requires a non-empty string to replace")
+	}
+	return strings.ReplaceAll(args[0], args[1], args[2]), nil
+}
+
+// regexReplace(s, pattern, replacement) replaces every match of the pattern, where the replacement can reference groups (ex: $1).
+func ipolRegexReplace(args ...string) (string, error) {
+	if err := checkIpolArgs("regexReplace", args, 3, 3); err != nil {
+		return "", err
+	}
+
+	re, err := regexp.Compile(args[1])
+	if err != nil {
+		return "", fmt.Errorf("invalid regex (%s): %w", args[1], err)
+	}
+	return re.ReplaceAllString(args[0], args[2]), nil
+}
+
+// default(s, fallback) returns the fallback if s is empty, or only whitespace.
+func ipolDefault(args ...string) (string, error) {
+	if err := checkIpolArgs("default", args, 2, 2); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(args[0]) == "" {
+		return args[1], nil
+	}
+	return args[0], nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdIpolFns(t *testing.T) {
+	type StdIpolFnTest struct {
+		fn        string
+		args      []string
+		expected  string
+		shouldErr bool
+	}
+
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	ipolNow = func() time.Time { return now }
+	t.Cleanup(func() { ipolNow = time.Now })
+
+	tests := []StdIpolFnTest{
+		// truncate
+		{fn: "truncate", args: []string{"Hello, world", "20"}, expected: "Hello, world"},
+		{fn: "truncate", args: []string{"Hello, world", "12"}, expected: "Hello, world"},
+		{fn: "truncate", args: []string{"Hello, world", "8"}, expected: "Hello,…"},
+		{fn: "truncate", args: []string{"Hello world", "7"}, expected: "Hello…"},
+		{fn: "truncate", args: []string{"Hello, world", "8", "..."}, expected: "Hello..."},
+		{fn: "truncate", args: []string{"héllo wörld", "4", ""}, expected: "héll"},
+		{fn: "truncate", args: []string{"Hello", "2", "..."}, expected: "He"},
+		{fn: "truncate", args: []string{"Hello", "0"}, shouldErr: true},
+		{fn: "truncate", args: []string{"Hello", "five"}, shouldErr: true},
+		{fn: "truncate", args: []string{"Hello"}, shouldErr: true},
+
+		// upper, lower, title
+		{fn: "upper", args: []string{"Hello World"}, expected: "HELLO WORLD"},
+		{fn: "lower", args: []string{"Hello World"}, expected: "hello world"},
+		{fn: "title", args: []string{"the QUICK brown-fox"}, expected: "The Quick Brown-Fox"},
+		{fn: "upper", args: []string{"a", "b"}, shouldErr: true},
+
+		// pathEscape, queryEscape
+		{fn: "pathEscape", args: []string{"a b/c"}, expected: "a%20b%2Fc"},
+		{fn: "queryEscape", args: []string{"a b&c=d"}, expected: "a+b%26c%3Dd"},
+
+		// stripHTML
+		{fn: "stripHTML", args: []string{"<p>Hello <b>world</b></p>"}, expected: "Hello world"},
+		{fn: "stripHTML", args: []string{"Tom &amp; Jerry&#39;s <br/>show"}, expected: "Tom & Jerry's show"},
+		{fn: "stripHTML", args: []string{"<style>p { color: red; }</style>Text<script>alert(1)</script>"}, expected: "Text"},
+		{fn: "stripHTML", args: []string{"no tags"}, expected: "no tags"},
+
+		// formatNumber
+		{fn: "formatNumber", args: []string{"999"}, expected: "999"},
+		{fn: "formatNumber", args: []string{"1000"}, expected: "1K"},
+		{fn: "formatNumber", args: []string{"1234"}, expected: "1.2K"},
+		{fn: "formatNumber", args: []string{"3400000"}, expected: "3.4M"},
+		{fn: "formatNumber", args: []string{"999999"}, expected: "1M"},
+		{fn: "formatNumber", args: []string{"2500000000"}, expected: "2.5B"},
+		{fn: "formatNumber", args: []string{"-15300"}, expected: "-15.3K"},
+		{fn: "formatNumber", args: []string{"12.75"}, expected: "12.8"},
+		{fn: "formatNumber", args: []string{"1234567", "2"}, expected: "1.23M"},
+		{fn: "formatNumber", args: []string{"1234567", "0"}, expected: "1M"},
+		{fn: "formatNumber", args: []string{"many"}, shouldErr: true},
+		{fn: "formatNumber", args: []string{"1000", "5"}, shouldErr: true},
+
+		// formatDate
+		{fn: "formatDate", args: []string{"2024-06-15T12:30:00Z", "Jan 2, 2006"}, expected: "Jun 15, 2024"},
+		{fn: "formatDate", args: []string{"2024-06-15T12:30:00Z", "Kitchen", "America/New_York"}, expected: "8:30AM"},
+		{fn: "formatDate", args: []string{"2024-06-15T12:30:00+02:00", "DateTime"}, expected: "2024-06-15 10:30:00"},
+		{fn: "formatDate", args: []string{"1718454600", "RFC3339"}, expected: "2024-06-15T12:30:00Z"},
+		{fn: "formatDate", args: []string{"1718454600000", "RFC3339"}, expected: "2024-06-15T12:30:00Z"},
+		{fn: "formatDate", args: []string{"2024-06-15", "Monday"}, expected: "Saturday"},
+		{fn: "formatDate", args: []string{"yesterday", "DateOnly"}, shouldErr: true},
+		{fn: "formatDate", args: []string{"2024-06-15", "DateOnly", "Mars/Olympus"}, shouldErr: true},
+
+		// relativeTime
+		{fn: "relativeTime", args: []string{"2024-06-15T11:59:30Z"}, expected: "just now"},
+		{fn: "relativeTime", args: []string{"2024-06-15T11:59:00Z"}, expected: "1 minute ago"},
+		{fn: "relativeTime", args: []string{"2024-06-15T09:00:00Z"}, expected: "3 hours ago"},
+		{fn: "relativeTime", args: []string{"2024-06-17T12:00:00Z"}, expected: "in 2 days"},
+		{fn: "relativeTime", args: []string{"2024-05-01"}, expected: "1 month ago"},
+		{fn: "relativeTime", args: []string{"2022-01-01"}, expected: "2 years ago"},
+		{fn: "relativeTime", args: []string{"soon"}, shouldErr: true},
+
+		// hashtagify
+		{fn: "hashtagify", args: []string{"go release notes"}, expected: "#GoReleaseNotes"},
+		{fn: "hashtagify", args: []string{"Go 1.24!"}, expected: "#Go124"},
+		{fn: "hashtagify", args: []string{"#already_tagged"}, expected: "#Already_tagged"},
+		{fn: "hashtagify", args: []string{"2024"}, shouldErr: true},
+		{fn: "hashtagify", args: []string{"!!!"}, shouldErr: true},
+
+		// replace, regexReplace
+		{fn: "replace", args: []string{"a-b-c", "-", " "}, expected: "a b c"},
+		{fn: "replace", args: []string{"a-b-c", "", " "}, shouldErr: true},
+		{fn: "regexReplace", args: []string{"v1.2.3", `v(\d+)\.(\d+)\.\d+`, "$1.$2"}, expected: "1.2"},
+		{fn: "regexReplace", args: []string{"a   b", `\s+`, " "}, expected: "a b"},
+		{fn: "regexReplace", args: []string{"abc", "(", ""}, shouldErr: true},
+
+		// default
+		{fn: "default", args: []string{"", "fallback"}, expected: "fallback"},
+		{fn: "default", args: []string{"  ", "fallback"}, expected: "fallback"},
+		{fn: "default", args: []string{"value", "fallback"}, expected: "value"},
+		{fn: "default", args: []string{"value"}, shouldErr: true},
+	}
+
+	for _, test := range tests {
+		fn, ok := stdIpolFns[test.fn]
+		assert.True(t, ok, test.fn)
+
+		s, err := fn(test.args...)
+		if test.shouldErr {
+			assert.NotNil(t, err, "%s(%q)", test.fn, test.args)
+		} else {
+			assert.Nil(t, err, "%s(%q)", test.fn, test.args)
+			assert.Equal(t, test.expected, s, "%s(%q)", test.fn, test.args)
+		}
+	}
+
+	t.Run("Test every FuncIpol registers the library", func(t *testing.T) {
+		f := newFuncIpol("|*", "*|")
+		for name := range stdIpolFns {
+			_, ok := f.Fn(name)
+			assert.True(t, ok, name)
+		}
+
+		s, err := f.Eval("|*upper(hello)*| |*formatNumber(1500)*|")
+		assert.Nil(t, err)
+		assert.Equal(t, "HELLO 1.5K", s)
+	})
+}
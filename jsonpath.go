@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A jsonFmt is a path into the fetched json, made of segments separated by dots (ex: data.post.title).
+// Besides object keys, a path can contain:
+//
+//   - Array indexes, as either a segment or in brackets (ex: authors.0.name, authors[0].name), counting from the end if negative (ex: items[-1])
+//   - Quoted keys in brackets, for keys containing dots or brackets (ex: headers["content.type"])
+//   - Wildcards, which select every item of an array (ex: authors[*].name)
+//   - Filters, which select the items of an array matching a predicate (ex: posts[?status == "published"][0].title)
+//
+// Keys after a wildcard or filter are looked up on each selected item, and indexes pick from the selected items.
+// Multiple selected items are joined with ", ", or with the separator given by a trailing | join("sep"),
+// which also joins the items of an array that wasn't selected (ex: tags | join(" ")).
+type jsonPath struct {
+	raw      string
+	segments []jsonPathSegment
+	sep      string
+	join     bool
+}
+
+type jsonPathSegmentKind int
+
+const (
+	jsonPathKey jsonPathSegmentKind = iota
+	jsonPathIndex
+	jsonPathWildcard
+	jsonPathFilter
+)
+
+type jsonPathSegment struct {
+	kind  jsonPathSegmentKind
+	key   string
+	index int
+	pred  *jsonPathPredicate
+}
+
+// jsonPathPredicate compares the value at path, relative to an array item, with a literal.
+// Without an operator, it matches items whose value at path is truthy.
+type jsonPathPredicate struct {
+	path    *jsonPath
+	op      string
+	literal interface{}
+}
+
+const defaultJsonPathSep = ", "
+
+var jsonPathOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+func parseJsonPath(s string) (*jsonPath, error) {
+	p := &jsonPath{raw: s, sep: defaultJsonPathSep}
+
+	pathStr, sep, hasSep, err := splitJoin(s)
+	if err != nil {
+		return nil, newValidationErr("invalid jsonFmt (%s): %s", s, err.Error())
+	}
+	if hasSep {
+		p.sep, p.join = sep, true
+	}
+
+	if p.segments, err = parseJsonPathSegments(strings.TrimSpace(pathStr)); err != nil {
+		return nil, newValidationErr("invalid jsonFmt (%s): %s", s, err.Error())
+	}
+
+	return p, nil
+}
+
+// splitJoin splits a trailing | join("sep") from a path.
+func splitJoin(s string) (string, string, bool, error) {
+	i := indexOutsideQuotes(s, '|')
+	if i == -1 {
+		return s, "", false, nil
+	}
+
+	join := strings.TrimSpace(s[i+1:])
+	arg, ok := strings.CutPrefix(join, "join(")
+	if !ok || !strings.HasSuffix(arg, ")") {
+		return "", "", false, fmt.Errorf("expected join(\"sep\") after |, but got (%s)", join)
+	}
+
+	sep, err := strconv.Unquote(strings.TrimSpace(strings.TrimSuffix(arg, ")")))
+	if err != nil {
+		return "", "", false, fmt.Errorf("join separator must be a quoted string")
+	}
+
+	return s[:i], sep, true, nil
+}
+
+// indexOutsideQuotes returns the index of the first c in s that isn't inside a quoted string, or -1.
+func indexOutsideQuotes(s string, c byte) int {
+	inQuotes := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && inQuotes:
+			i++
+		case s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == c && !inQuotes:
+			return i
+		}
+	}
+	return -1
+}
+
+func parseJsonPathSegments(s string) ([]jsonPathSegment, error) {
+	if s == "" {
+		return nil, fmt.Errorf("path is empty")
+	}
+
+	segments := []jsonPathSegment{}
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '.':
+			if i == 0 || i == len(s)-1 || s[i+1] == '.' || s[i+1] == '[' {
+				return nil, fmt.Errorf("unexpected (.) at position (%d)", i)
+			}
+			i++
+		case '[':
+			end := indexOutsideQuotes(s[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed ([) at position (%d)", i)
+			}
+
+			segment, err := parseJsonPathBracket(strings.TrimSpace(s[i+1 : i+end]))
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment)
+			i += end + 1
+
+			if i < len(s) && s[i] != '.' && s[i] != '[' {
+				return nil, fmt.Errorf("unexpected (%c) at position (%d)", s[i], i)
+			}
+		default:
+			end := strings.IndexAny(s[i:], ".[")
+			if end == -1 {
+				end = len(s) - i
+			}
+
+			key := s[i : i+end]
+			if index, err := strconv.Atoi(key); err == nil {
+				segments = append(segments, jsonPathSegment{kind: jsonPathIndex, key: key, index: index})
+			} else {
+				segments = append(segments, jsonPathSegment{kind: jsonPathKey, key: key})
+			}
+			i += end
+		}
+	}
+
+	return segments, nil
+}
+
+func parseJsonPathBracket(s string) (jsonPathSegment, error) {
+	switch {
+	case s == "*":
+		return jsonPathSegment{kind: jsonPathWildcard}, nil
+	case strings.HasPrefix(s, "?"):
+		pred, err := parseJsonPathPredicate(strings.TrimSpace(s[1:]))
+		if err != nil {
+			return jsonPathSegment{}, err
+		}
+		return jsonPathSegment{kind: jsonPathFilter, pred: pred}, nil
+	case strings.HasPrefix(s, `"`):
+		key, err := strconv.Unquote(s)
+		if err != nil {
+			return jsonPathSegment{}, fmt.Errorf("invalid quoted key (%s)", s)
+		}
+		return jsonPathSegment{kind: jsonPathKey, key: key}, nil
+	}
+
+	index, err := strconv.Atoi(s)
+	if err != nil {
+		return jsonPathSegment{}, fmt.Errorf("expected an index, *, ?predicate, or quoted key in brackets, but got (%s)", s)
+	}
+	return jsonPathSegment{kind: jsonPathIndex, key: s, index: index}, nil
+}
+
+func parseJsonPathPredicate(s string) (*jsonPathPredicate, error) {
+	pred := &jsonPathPredicate{}
+
+	pathStr := s
+	for _, op := range jsonPathOps {
+		if i := indexOutsideQuotes(s, op[0]); i != -1 && strings.HasPrefix(s[i:], op) {
+			pred.op = op
+			pathStr = s[:i]
+
+			literal, err := parseJsonPathLiteral(strings.TrimSpace(s[i+len(op):]))
+			if err != nil {
+				return nil, err
+			}
+			pred.literal = literal
+			break
+		}
+	}
+
+	pathStr = strings.TrimSpace(pathStr)
+	if pathStr == "@" {
+		pred.path = &jsonPath{raw: pathStr}
+		return pred, nil
+	}
+
+	segments, err := parseJsonPathSegments(strings.TrimPrefix(pathStr, "@."))
+	if err != nil {
+		return nil, fmt.Errorf("invalid predicate (%s): %w", s, err)
+	}
+	pred.path = &jsonPath{raw: pathStr, segments: segments}
+
+	return pred, nil
+}
+
+func parseJsonPathLiteral(s string) (interface{}, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if strings.HasPrefix(s, `"`) {
+		str, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid string (%s)", s)
+		}
+		return str, nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, fmt.Errorf("expected a quoted string, number, true, false, or null, but got (%s)", s)
+	}
+	return f, nil
+}
+
+// get returns the value at the path. If the path selects multiple items, they are returned with selected set to true.
+func (p *jsonPath) get(data interface{}) (value interface{}, selected bool, err error) {
+	value = data
+	for _, segment := range p.segments {
+		if value, err = segment.apply(value, selected); err != nil {
+			return nil, false, newValidationErr("invalid jsonFmt (%s): %s", p.raw, err.Error())
+		}
+		selected = selected || segment.kind == jsonPathWildcard || segment.kind == jsonPathFilter
+		if segment.kind == jsonPathIndex && selected {
+			selected = false
+		}
+	}
+
+	if p.join && !selected {
+		if _, ok := value.([]interface{}); !ok {
+			return nil, false, newValidationErr("invalid jsonFmt (%s): cannot join a value that is not an array", p.raw)
+		}
+		selected = true
+	}
+	return value, selected, nil
+}
+
+func (s jsonPathSegment) apply(value interface{}, selected bool) (interface{}, error) {
+	switch s.kind {
+	case jsonPathKey:
+		if selected {
+			items := []interface{}{}
+			for _, item := range value.([]interface{}) {
+				if m, ok := item.(map[string]interface{}); ok {
+					if v, ok := m[s.key]; ok {
+						items = append(items, v)
+					}
+				}
+			}
+			return items, nil
+		}
+
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("(%s) is not an object", s.key)
+		}
+		v, ok := m[s.key]
+		if !ok {
+			return nil, fmt.Errorf("key (%s) not found", s.key)
+		}
+		return v, nil
+
+	case jsonPathIndex:
+		// A numeric segment is still a key when indexing an object
+		if m, ok := value.(map[string]interface{}); ok && !selected {
+			v, ok := m[s.key]
+			if !ok {
+				return nil, fmt.Errorf("key (%s) not found", s.key)
+			}
+			return v, nil
+		}
+
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot index (%d) into a value that is not an array", s.index)
+		}
+		i := s.index
+		if i < 0 {
+			i += len(arr)
+		}
+		if i < 0 || i >= len(arr) {
+			return nil, fmt.Errorf("index (%d) out of range for array of length (%d)", s.index, len(arr))
+		}
+		return arr[i], nil
+
+	case jsonPathWildcard:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot select (*) from a value that is not an array")
+		}
+		if !selected {
+			return arr, nil
+		}
+
+		// Selecting from already selected items flattens them
+		items := []interface{}{}
+		for _, item := range arr {
+			if a, ok := item.([]interface{}); ok {
+				items = append(items, a...)
+			}
+		}
+		return items, nil
+
+	case jsonPathFilter:
+		arr, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot filter a value that is not an array")
+		}
+
+		items := []interface{}{}
+		for _, item := range arr {
+			if s.pred.matches(item) {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("unknown path segment")
+}
+
+func (pred *jsonPathPredicate) matches(item interface{}) bool {
+	value, selected, err := pred.path.get(item)
+	if err != nil || selected {
+		return false
+	}
+
+	if pred.op == "" {
+		return isTruthy(value)
+	}
+
+	return compareJsonValues(value, pred.op, pred.literal)
+}
+
+// compareJsonValues compares a value decoded from json with a literal. Numbers and strings can be ordered,
+// and any scalars can be compared with == and !=. Objects and arrays don't compare with anything.
+func compareJsonValues(value interface{}, op string, literal interface{}) bool {
+	var ok bool
+	if value, ok = jsonNumberToFloat(value); !ok || !isJsonScalar(value) {
+		return false
+	}
+	if literal, ok = jsonNumberToFloat(literal); !ok || !isJsonScalar(literal) {
+		return false
+	}
+
+	switch op {
+	case "==":
+		return value == literal
+	case "!=":
+		return value != literal
+	}
+
+	if a, ok := value.(float64); ok {
+		if b, ok := literal.(float64); ok {
+			return compareOrdered(a, b, op)
+		}
+	}
+	if a, ok := value.(string); ok {
+		if b, ok := literal.(string); ok {
+			return compareOrdered(a, b, op)
+		}
+	}
+	return false
+}
+
+func isJsonScalar(v interface{}) bool {
+	switch v.(type) {
+	case nil, bool, float64, string:
+		return true
+	}
+	return false
+}
+
+// jsonNumberToFloat converts v to a float64 if it's a json.Number, returning false if the number is invalid.
+func jsonNumberToFloat(v interface{}) (interface{}, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v, true
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+func compareOrdered[T float64 | string](a, b T, op string) bool {
+	switch op {
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	}
+	return false
+}
+
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f != 0
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+func formatJsonValue(value interface{}) (string, error) {
+	switch d := value.(type) {
+	case string:
+		return d, nil
+	case int64:
+		return fmt.Sprintf("%d", d), nil
+	case float64:
+		return fmt.Sprintf("%f", d), nil
+	case bool:
+		return strconv.FormatBool(d), nil
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -11,35 +11,25 @@ func main() {
 	}
 
 	var (
-		Port             string = os.Getenv(EnvPort)
-		Username         string = os.Getenv(EnvUsername)
-		AuthToken        string = os.Getenv(EnvAuthToken)
-		APIKey           string = os.Getenv(EnvAPIKey)
-		APIKeySecret     string = os.Getenv(EnvAPIKeySecret)
-		OAuthToken       string = os.Getenv(EnvOAuthToken)
-		OAuthTokenSecret string = os.Getenv(EnvOAuthTokenSecret)
+		Port      string = os.Getenv(EnvPort)
+		AuthToken string = os.Getenv(EnvAuthToken)
 	)
 
 	if !isValidAuthToken(AuthToken) {
 		log.Fatalf("invalid or missing variable (%s) from .env", EnvAuthToken)
 	}
 
-	creds := TwitterAPICreds{
-		Username:         Username,
-		APIKey:           APIKey,
-		APIKeySecret:     APIKeySecret,
-		OAuthToken:       OAuthToken,
-		OAuthTokenSecret: OAuthTokenSecret,
+	creds, err := loadTwitterAPICreds(os.Environ())
+	if err != nil {
+		log.Fatalf("error loading Twitter API credentials from .env: %s", err.Error())
 	}
-	if !creds.isValid() {
-		log.Fatalf(
-			"required Twitter API credentials from .env: (%s), (%s), (%s), (%s), (%s)",
-			EnvUsername, EnvAPIKey, EnvAPIKeySecret, EnvOAuthToken, EnvOAuthTokenSecret,
-		)
+
+	strategy, err := parseClientSelectionStrategy(os.Getenv(EnvClientStrategy))
+	if err != nil {
+		log.Fatalf("invalid variable (%s) from .env: %s", EnvClientStrategy, err.Error())
 	}
 
-	// TODO: refactor to allow many creds to be specified for the client pool:
-	api, err := newAPI(Port, AuthToken, creds)
+	api, err := newAPI(Port, AuthToken, strategy, creds...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/michimani/gotwi"
+)
+
+const (
+	mediaUploadEndpoint   = "https://upload.twitter.com/1.1/media/upload.json"
+	mediaMetadataEndpoint = "https://upload.twitter.com/1.1/media/metadata/create.json"
+)
+
+const (
+	mediaChunkSize           = 4 * 1024 * 1024
+	mediaSniffLen            = 512
+	maxMediaItems            = 4
+	maxImageBytes            = 5 * 1024 * 1024
+	maxGifBytes              = 15 * 1024 * 1024
+	maxVideoBytes            = 512 * 1024 * 1024
+	maxAltTextLength         = 1000
+	maxMediaProcessingWait   = 5 * time.Minute
+	mediaFetchTimeout        = 5 * time.Minute
+	defaultMediaCheckAfter   = 2 * time.Second
+	multipartMaxMemory       = 32 * 1024 * 1024
+	multipartFormFieldOpts   = "opts"
+	multipartFormFieldMedia  = "media"
+	multipartFormFieldAltTxt = "altText"
+	// Every media item at the largest size, base64 encoded in a json body, along with the rest of the opts
+	maxPublishRequestBytes = maxMediaItems*maxVideoBytes*4/3 + 1024*1024
+)
+
+// Replaced in tests to avoid waiting on media processing
+var mediaStatusSleep = time.Sleep
+
+type MediaCategory string
+
+const (
+	MediaCategoryImage MediaCategory = "tweet_image"
+	MediaCategoryGif   MediaCategory = "tweet_gif"
+	MediaCategoryVideo MediaCategory = "tweet_video"
+)
+
+// MediaOpts describes a single media item to attach to a tweet.
+// Exactly one of Data (base64 encoded) or Url must be provided,
+// unless the media was uploaded to the API as a multipart file.
+type MediaOpts struct {
+	Data      string `json:"data,omitempty"`
+	Url       string `json:"url,omitempty"`
+	AltText   string `json:"altText,omitempty"`
+	MediaType string `json:"mediaType,omitempty"`
+	// StoredID references the body in the MediaStore, once the media of a tweet to publish later has been stored
+	StoredID string `json:"storedID,omitempty"`
+	body     []byte
+}
+
+func (m *MediaOpts) String() string {
+	return fmt.Sprintf("MediaOpts{ Url: %s, MediaType: %s, AltText: %s, Bytes: %d }", m.Url, m.MediaType, m.AltText, len(m.body))
+}
+
+func (m *MediaOpts) category() MediaCategory {
+	return mediaCategory(m.MediaType)
+}
+
+func mediaCategory(mediaType string) MediaCategory {
+	switch {
+	case mediaType == "image/gif":
+		return MediaCategoryGif
+	case strings.HasPrefix(mediaType, "video/"):
+		return MediaCategoryVideo
+	default:
+		return MediaCategoryImage
+	}
+}
+
+func maxMediaBytes(category MediaCategory) int64 {
+	switch category {
+	case MediaCategoryGif:
+		return maxGifBytes
+	case MediaCategoryVideo:
+		return maxVideoBytes
+	default:
+		return maxImageBytes
+	}
+}
+
+// checkMediaBody validates the media type and size of the body of a media item.
+func checkMediaBody(mediaType string, size int64) error {
+	if size == 0 {
+		return newValidationErr("media item cannot be empty")
+	}
+
+	if !strings.HasPrefix(mediaType, "image/") && !strings.HasPrefix(mediaType, "video/") {
+		return newValidationErr("unsupported media type: %s", mediaType)
+	}
+
+	if maxBytes := maxMediaBytes(mediaCategory(mediaType)); size > maxBytes {
+		return newValidationErr("media item of type (%s) is (%d) bytes, which exceeds the maximum of (%d) bytes", mediaType, size, maxBytes)
+	}
+
+	return nil
+}
+
+// load resolves the body of the media item from its base64 data, and detects its media type if one wasn't provided.
+// The body of a media url isn't loaded, but streamed to the upload by open, so only the url is checked.
+func (m *MediaOpts) load(f *Fetcher) error {
+	if len([]rune(m.AltText)) > maxAltTextLength {
+		return newValidationErr("media alt text exceeds the maximum length of (%d)", maxAltTextLength)
+	}
+
+	if m.body == nil {
+		switch {
+		case m.StoredID != "":
+			return newValidationErr("stored media (%s) was not loaded", m.StoredID)
+		case m.Data != "" && m.Url != "":
+			return newValidationErr("media item must have either data or url, but not both")
+		case m.Data != "":
+			body, err := base64.StdEncoding.DecodeString(m.Data)
+			if err != nil {
+				return newValidationErr("media data is not valid base64: %s", err.Error())
+			}
+			m.body = body
+		case m.Url != "":
+			u, err := url.Parse(m.Url)
+			if err != nil || !isValidUrl(m.Url) {
+				return newValidationErr("invalid media url: %s", m.Url)
+			}
+			if err := f.config.checkUrl(u); err != nil {
+				return newValidationErr("%s", err.Error())
+			}
+			return nil
+		default:
+			return newValidationErr("media item must have either data or url")
+		}
+	}
+
+	if m.MediaType == "" || m.MediaType == "application/octet-stream" {
+		m.MediaType = http.DetectContentType(m.body)
+	}
+
+	return checkMediaBody(m.MediaType, int64(len(m.body)))
+}
+
+// loadMedia loads every media item, and checks that the combination of items can be attached to a single tweet.
+func loadMedia(f *Fetcher, media []*MediaOpts) error {
+	if len(media) > maxMediaItems {
+		return newValidationErr("a tweet can have at most (%d) media items (received: %d)", maxMediaItems, len(media))
+	}
+
+	for i, m := range media {
+		if m == nil {
+			return newValidationErr("media item (%d) is null", i+1)
+		}
+		if err := m.load(f); err != nil {
+			return fmt.Errorf("media item (%d): %w", i+1, err)
+		}
+		if err := checkMediaCombination(m.category(), len(media)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkMediaCombination(category MediaCategory, items int) error {
+	if category != MediaCategoryImage && items > 1 {
+		return newValidationErr("a gif or video must be the only media item in a tweet")
+	}
+	return nil
+}
+
+// MediaSource is the body of a media item, opened to be uploaded.
+type MediaSource struct {
+	io.ReadCloser
+	Size      int64
+	MediaType string
+}
+
+// open returns the body of the media item. The body of a media url is streamed from the response,
+// so that no more than a chunk of it is held in memory while it is uploaded.
+// The type of url media is only known once it is fetched, so it is validated here rather than by load.
+func (m *MediaOpts) open(f *Fetcher) (*MediaSource, error) {
+	if m.body != nil || m.Url == "" {
+		return &MediaSource{
+			ReadCloser: io.NopCloser(bytes.NewReader(m.body)),
+			Size:       int64(len(m.body)),
+			MediaType:  m.MediaType,
+		}, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, m.Url, nil)
+	if err != nil {
+		return nil, &FetchError{Url: m.Url, Err: err}
+	}
+
+	resp, err := f.open(req, mediaFetchTimeout)
+	if err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, err
+		}
+		return nil, &FetchError{Url: m.Url, Err: err}
+	}
+
+	// The size of the media is sent before its body is uploaded, so it has to be known in advance
+	if resp.ContentLength < 0 {
+		resp.Body.Close()
+		return nil, newValidationErr("media url (%s) must respond with a Content-Length header", m.Url)
+	}
+
+	body := bufio.NewReaderSize(resp.Body, mediaSniffLen)
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = strings.TrimSpace(strings.Split(resp.Header.Get(HTTPHeaderContentType), ";")[0])
+	}
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		// A body shorter than the sniffed length is returned with an error, which DetectContentType doesn't need
+		head, _ := body.Peek(mediaSniffLen)
+		mediaType = http.DetectContentType(head)
+	}
+
+	if err := checkMediaBody(mediaType, resp.ContentLength); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return &MediaSource{
+		ReadCloser: struct {
+			io.Reader
+			io.Closer
+		}{body, resp.Body},
+		Size:      resp.ContentLength,
+		MediaType: mediaType,
+	}, nil
+}
+
+const oauth1Header = `OAuth oauth_consumer_key="%s",oauth_nonce="%s",oauth_signature="%s",oauth_signature_method="%s",oauth_timestamp="%s",oauth_token="%s",oauth_version="%s"`
+
+// newSignedRequest creates a request signed with the OAuth 1.0a credentials of the client.
+// params are sent as a form body for POST requests, and as a query string otherwise.
+// If body is not nil, it is sent as-is and params are sent in the query string,
+// because the parameters of multipart bodies are not part of the signature.
+func newSignedRequest(client *gotwi.Client, method, endpoint string, params map[string]string, body io.Reader, contentType string) (*http.Request, error) {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+
+	rawUrl := endpoint
+	if method != http.MethodPost || body != nil {
+		if len(values) > 0 {
+			rawUrl = endpoint + "?" + values.Encode()
+		}
+	} else {
+		body = strings.NewReader(values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, rawUrl, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set(HTTPHeaderContentType, contentType)
+	}
+
+	out, err := gotwi.CreateOAuthSignature(&gotwi.CreateOAuthSignatureInput{
+		HTTPMethod:       method,
+		RawEndpoint:      endpoint,
+		OAuthConsumerKey: client.OAuthConsumerKey(),
+		OAuthToken:       client.OAuthToken(),
+		SigningKey:       client.SigningKey(),
+		ParameterMap:     params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set(HTTPHeaderAuthorization, fmt.Sprintf(oauth1Header,
+		url.QueryEscape(client.OAuthConsumerKey()),
+		url.QueryEscape(out.OAuthNonce),
+		url.QueryEscape(out.OAuthSignature),
+		url.QueryEscape(out.OAuthSignatureMethod),
+		url.QueryEscape(out.OAuthTimestamp),
+		url.QueryEscape(client.OAuthToken()),
+		url.QueryEscape(out.OAuthVersion),
+	))
+
+	return req, nil
+}
+
+// doSignedRequest sends the request with the client's http client, and decodes a successful response into v.
+func doSignedRequest(client *gotwi.Client, req *http.Request, v any) error {
+	resp, err := client.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newUpstreamErr(resp)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+
+	return nil
+}
+
+type MediaProcessingInfo struct {
+	State          string `json:"state"`
+	CheckAfterSecs int    `json:"check_after_secs"`
+	Error          *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type MediaUploadResp struct {
+	MediaIDString  string               `json:"media_id_string"`
+	ProcessingInfo *MediaProcessingInfo `json:"processing_info"`
+}
+
+// uploadMedia uploads the body of the media item with the client using the chunked INIT / APPEND / FINALIZE / STATUS flow,
+// and returns the resulting media ID.
+func uploadMedia(client *gotwi.Client, m *MediaOpts, src *MediaSource) (string, error) {
+	var initResp MediaUploadResp
+	req, err := newSignedRequest(client, http.MethodPost, mediaUploadEndpoint, map[string]string{
+		"command":        "INIT",
+		"total_bytes":    strconv.FormatInt(src.Size, 10),
+		"media_type":     src.MediaType,
+		"media_category": string(mediaCategory(src.MediaType)),
+	}, nil, "")
+	if err != nil {
+		return "", err
+	}
+	if err := doSignedRequest(client, req, &initResp); err != nil {
+		return "", fmt.Errorf("error initializing media upload: %w", err)
+	}
+
+	mediaID := initResp.MediaIDString
+	if mediaID == "" {
+		return "", fmt.Errorf("error initializing media upload: missing media ID")
+	}
+
+	var (
+		chunk    = make([]byte, min(mediaChunkSize, src.Size))
+		uploaded = int64(0)
+	)
+	for i := 0; uploaded < src.Size; i++ {
+		n, err := io.ReadFull(src, chunk[:min(int64(len(chunk)), src.Size-uploaded)])
+		if err != nil {
+			return "", fmt.Errorf("error reading media after (%d) of (%d) bytes: %w", uploaded+int64(n), src.Size, err)
+		}
+
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		fw, err := mw.CreateFormFile(multipartFormFieldMedia, "blob")
+		if err != nil {
+			return "", err
+		}
+		if _, err := fw.Write(chunk[:n]); err != nil {
+			return "", err
+		}
+		if err := mw.Close(); err != nil {
+			return "", err
+		}
+
+		req, err := newSignedRequest(client, http.MethodPost, mediaUploadEndpoint, map[string]string{
+			"command":       "APPEND",
+			"media_id":      mediaID,
+			"segment_index": strconv.Itoa(i),
+		}, &buf, mw.FormDataContentType())
+		if err != nil {
+			return "", err
+		}
+		if err := doSignedRequest(client, req, nil); err != nil {
+			return "", fmt.Errorf("error appending media chunk (%d): %w", i, err)
+		}
+		uploaded += int64(n)
+	}
+
+	var finalizeResp MediaUploadResp
+	req, err = newSignedRequest(client, http.MethodPost, mediaUploadEndpoint, map[string]string{
+		"command":  "FINALIZE",
+		"media_id": mediaID,
+	}, nil, "")
+	if err != nil {
+		return "", err
+	}
+	if err := doSignedRequest(client, req, &finalizeResp); err != nil {
+		return "", fmt.Errorf("error finalizing media upload: %w", err)
+	}
+
+	if err := waitForMediaProcessing(client, mediaID, finalizeResp.ProcessingInfo); err != nil {
+		return "", err
+	}
+
+	if m.AltText != "" {
+		if err := createMediaAltText(client, mediaID, m.AltText); err != nil {
+			return "", err
+		}
+	}
+
+	return mediaID, nil
+}
+
+// waitForMediaProcessing polls the STATUS command until the media has finished processing.
+func waitForMediaProcessing(client *gotwi.Client, mediaID string, info *MediaProcessingInfo) error {
+	waited := time.Duration(0)
+
+	for info != nil {
+		switch info.State {
+		case "succeeded":
+			return nil
+		case "failed":
+			msg := "unknown error"
+			if info.Error != nil {
+				msg = info.Error.Message
+			}
+			return fmt.Errorf("error processing media (%s): %s", mediaID, msg)
+		}
+
+		checkAfter := time.Duration(info.CheckAfterSecs) * time.Second
+		if checkAfter <= 0 {
+			checkAfter = defaultMediaCheckAfter
+		}
+		if waited+checkAfter > maxMediaProcessingWait {
+			return fmt.Errorf("error processing media (%s): timed out after %s", mediaID, waited)
+		}
+		mediaStatusSleep(checkAfter)
+		waited += checkAfter
+
+		var statusResp MediaUploadResp
+		req, err := newSignedRequest(client, http.MethodGet, mediaUploadEndpoint, map[string]string{
+			"command":  "STATUS",
+			"media_id": mediaID,
+		}, nil, "")
+		if err != nil {
+			return err
+		}
+		if err := doSignedRequest(client, req, &statusResp); err != nil {
+			return fmt.Errorf("error checking media status: %w", err)
+		}
+		info = statusResp.ProcessingInfo
+	}
+
+	return nil
+}
+
+func createMediaAltText(client *gotwi.Client, mediaID, altText string) error {
+	body, err := json.Marshal(map[string]any{
+		"media_id": mediaID,
+		"alt_text": map[string]string{"text": altText},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := newSignedRequest(client, http.MethodPost, mediaMetadataEndpoint, nil, bytes.NewReader(body), ContentTypeApplicationJson)
+	if err != nil {
+		return err
+	}
+	if err := doSignedRequest(client, req, nil); err != nil {
+		return fmt.Errorf("error creating media alt text: %w", err)
+	}
+
+	return nil
+}
+
+// uploadAllMedia uploads each media item with the client, and returns the media IDs in the same order.
+// Each item is opened only when it is uploaded, so the body of a media url is streamed rather than buffered.
+func uploadAllMedia(client *gotwi.Client, f *Fetcher, media []*MediaOpts) ([]string, error) {
+	mediaIDs := []string{}
+	for i, m := range media {
+		src, err := m.open(f)
+		if err != nil {
+			return nil, fmt.Errorf("media item (%d): %w", i+1, err)
+		}
+
+		if err := checkMediaCombination(mediaCategory(src.MediaType), len(media)); err != nil {
+			src.Close()
+			return nil, err
+		}
+
+		mediaID, err := uploadMedia(client, m, src)
+		src.Close()
+		if err != nil {
+			return nil, err
+		}
+		mediaIDs = append(mediaIDs, mediaID)
+	}
+	return mediaIDs, nil
+}
+
+func isMultipartForm(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get(HTTPHeaderContentType), "multipart/form-data")
+}
+
+// parseMultipartPublishTweetOpts reads PublishTweetOpts from the json-encoded "opts" field of a multipart form,
+// and appends each file in the "media" field as a media item. The alt text of each file
+// can be set with an "altText" field, in the same order as the files.
+func parseMultipartPublishTweetOpts(r *http.Request) (PublishTweetOpts, error) {
+	var opts PublishTweetOpts
+
+	if err := r.ParseMultipartForm(multipartMaxMemory); err != nil {
+		return opts, err
+	}
+
+	if s := r.FormValue(multipartFormFieldOpts); s != "" {
+		if err := json.Unmarshal([]byte(s), &opts); err != nil {
+			return opts, err
+		}
+	}
+
+	var (
+		files    = r.MultipartForm.File[multipartFormFieldMedia]
+		altTexts = r.MultipartForm.Value[multipartFormFieldAltTxt]
+	)
+
+	for i, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			return opts, err
+		}
+		// The media type is only sniffed later, so a file without one may be as large as a video
+		mediaType := fh.Header.Get(HTTPHeaderContentType)
+		max := int64(maxVideoBytes)
+		if mediaType != "" && mediaType != "application/octet-stream" {
+			max = maxMediaBytes(mediaCategory(mediaType))
+		}
+
+		body, err := io.ReadAll(io.LimitReader(f, max+1))
+		f.Close()
+		if err != nil {
+			return opts, err
+		}
+		if int64(len(body)) > max {
+			return opts, newValidationErr("media file (%d) exceeds the maximum size of (%d) bytes", i+1, max)
+		}
+
+		m := &MediaOpts{
+			MediaType: mediaType,
+			body:      body,
+		}
+		if i < len(altTexts) {
+			m.AltText = altTexts[i]
+		}
+		opts.Media = append(opts.Media, m)
+	}
+
+	return opts, nil
+}
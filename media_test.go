@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// A 1x1 transparent png
+var testPngBytes, _ = base64.StdEncoding.DecodeString("iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAQAAAC1HAwCAAAAC0lEQVR42mNkYAAAAAYAAjCB0C8AAAAASUVORK5CYII=")
+
+func TestLoadMedia(t *testing.T) {
+	type LoadMediaTest struct {
+		media     []*MediaOpts
+		shouldErr bool
+	}
+
+	var pngData = base64.StdEncoding.EncodeToString(testPngBytes)
+
+	tests := []LoadMediaTest{
+		// No media
+		{
+			media:     nil,
+			shouldErr: false,
+		},
+
+		// Proper usage
+		{
+			media:     []*MediaOpts{{Data: pngData, AltText: "a pixel"}},
+			shouldErr: false,
+		},
+		{
+			media:     []*MediaOpts{{Data: pngData}, {Data: pngData}, {Data: pngData}, {Data: pngData}},
+			shouldErr: false,
+		},
+
+		// Invalid media
+		{
+			media:     []*MediaOpts{{}},
+			shouldErr: true,
+		},
+		{
+			media:     []*MediaOpts{{Data: "not base64!"}},
+			shouldErr: true,
+		},
+		{
+			media:     []*MediaOpts{{Data: pngData, Url: "https://example.com/image.png"}},
+			shouldErr: true,
+		},
+		{
+			media:     []*MediaOpts{{Data: base64.StdEncoding.EncodeToString([]byte("plain text"))}},
+			shouldErr: true,
+		},
+		{
+			media:     []*MediaOpts{{Data: pngData, AltText: strings.Repeat("a", maxAltTextLength+1)}},
+			shouldErr: true,
+		},
+
+		// Too many media items
+		{
+			media:     []*MediaOpts{{Data: pngData}, {Data: pngData}, {Data: pngData}, {Data: pngData}, {Data: pngData}},
+			shouldErr: true,
+		},
+		{
+			media:     []*MediaOpts{{Data: pngData, MediaType: "video/mp4"}, {Data: pngData}},
+			shouldErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		err := loadMedia(newFetcher(defaultFetchConfig()), test.media)
+		if test.shouldErr {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+
+	m := &MediaOpts{Data: pngData}
+	assert.Nil(t, m.load(newFetcher(defaultFetchConfig())))
+	assert.Equal(t, "image/png", m.MediaType)
+	assert.Equal(t, MediaCategoryImage, m.category())
+}
+
+func TestUploadMedia(t *testing.T) {
+	mediaStatusSleep = func(time.Duration) {}
+	defer func() { mediaStatusSleep = time.Sleep }()
+
+	var (
+		commands   = []string{}
+		altText    = ""
+		createdIDs []string
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get(HTTPHeaderAuthorization), "OAuth "))
+
+		switch r.URL.Host + r.URL.Path {
+		case "upload.twitter.com/1.1/media/upload.json":
+			command := r.URL.Query().Get("command")
+			if command == "" {
+				r.ParseForm()
+				command = r.PostForm.Get("command")
+			}
+			commands = append(commands, command)
+
+			switch command {
+			case "INIT":
+				assert.Equal(t, "image/png", r.PostForm.Get("media_type"))
+				assert.Equal(t, "tweet_image", r.PostForm.Get("media_category"))
+				writeJSON(w, http.StatusAccepted, map[string]any{"media_id_string": "42"})
+			case "APPEND":
+				assert.Equal(t, "42", r.URL.Query().Get("media_id"))
+				f, _, err := r.FormFile(multipartFormFieldMedia)
+				assert.Nil(t, err)
+				f.Close()
+				w.WriteHeader(http.StatusNoContent)
+			case "FINALIZE":
+				writeJSON(w, http.StatusOK, map[string]any{
+					"media_id_string": "42",
+					"processing_info": map[string]any{"state": "pending", "check_after_secs": 1},
+				})
+			case "STATUS":
+				writeJSON(w, http.StatusOK, map[string]any{
+					"media_id_string": "42",
+					"processing_info": map[string]any{"state": "succeeded"},
+				})
+			}
+		case "upload.twitter.com/1.1/media/metadata/create.json":
+			var body struct {
+				AltText struct {
+					Text string `json:"text"`
+				} `json:"alt_text"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			altText = body.AltText.Text
+			w.WriteHeader(http.StatusOK)
+		case "api.twitter.com/2/tweets":
+			var in managetweetTypes.CreateInput
+			json.NewDecoder(r.Body).Decode(&in)
+			createdIDs = in.Media.MediaIDs
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"data": map[string]string{"id": "1000000000000000001", "text": "with media"},
+			})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+	result, err := c.publishTweet(PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		Text:             "with media",
+		Media: []*MediaOpts{
+			{Data: base64.StdEncoding.EncodeToString(testPngBytes), AltText: "a pixel"},
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1000000000000000001"}, result.TweetIDs())
+	assert.Equal(t, []string{"INIT", "APPEND", "FINALIZE", "STATUS"}, commands)
+	assert.Equal(t, "a pixel", altText)
+	assert.Equal(t, []string{"42"}, createdIDs)
+}
+
+func TestUploadMediaFromUrl(t *testing.T) {
+	// Larger than a chunk, so that it is appended in two chunks
+	body := append(append([]byte{}, testPngBytes...), make([]byte, mediaChunkSize)...)
+
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image.png":
+			w.Header().Set(HTTPHeaderContentType, "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body)
+		case "/unsized.png":
+			// Flushing before writing the body makes the response chunked, without a Content-Length
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			w.Write(testPngBytes)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer media.Close()
+
+	var (
+		appended   []byte
+		totalBytes string
+		mediaType  string
+		uploads    = 0
+		limitReset = time.Now().Add(time.Hour)
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Host + r.URL.Path {
+		case "upload.twitter.com/1.1/media/upload.json":
+			uploads++
+			r.ParseForm()
+			command := r.PostForm.Get("command")
+			if command == "" {
+				command = r.URL.Query().Get("command")
+			}
+
+			switch {
+			case r.Header.Get("X-Test-Username") == "bravo":
+				w.Header().Set(HTTPHeaderRateLimitRemaining, "0")
+				w.Header().Set(HTTPHeaderRateLimitReset, strconv.FormatInt(limitReset.Unix(), 10))
+				writeJSON(w, http.StatusTooManyRequests, map[string]any{"title": "Too Many Requests"})
+			case command == "INIT":
+				totalBytes = r.PostForm.Get("total_bytes")
+				mediaType = r.PostForm.Get("media_type")
+				writeJSON(w, http.StatusAccepted, map[string]any{"media_id_string": "42"})
+			case command == "APPEND":
+				f, _, err := r.FormFile(multipartFormFieldMedia)
+				assert.Nil(t, err)
+				b, _ := io.ReadAll(f)
+				f.Close()
+				appended = append(appended, b...)
+				w.WriteHeader(http.StatusNoContent)
+			case command == "FINALIZE":
+				writeJSON(w, http.StatusOK, map[string]any{"media_id_string": "42"})
+			}
+		case "api.twitter.com/2/tweets":
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"data": map[string]string{"id": "1000000000000000001", "text": "with media"},
+			})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha", "bravo")
+	allowPrivateFetches(c)
+
+	newOpts := func(username, path string) PublishTweetOpts {
+		return PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeText,
+			Text:             "with media",
+			Username:         username,
+			Media:            []*MediaOpts{{Url: media.URL + path}},
+		}
+	}
+
+	t.Run("Test body is streamed", func(t *testing.T) {
+		_, err := c.publishTweet(newOpts("alpha", "/image.png"))
+		assert.Nil(t, err)
+		assert.Equal(t, strconv.Itoa(len(body)), totalBytes)
+		assert.Equal(t, "image/png", mediaType)
+		assert.Equal(t, body, appended)
+	})
+
+	t.Run("Test body without a size", func(t *testing.T) {
+		_, err := c.publishTweet(newOpts("alpha", "/unsized.png"))
+		assert.IsType(t, &ValidationError{}, errors.Unwrap(errors.Unwrap(err)))
+		assert.ErrorContains(t, err, "Content-Length")
+	})
+
+	t.Run("Test uploads are rate-limited separately", func(t *testing.T) {
+		_, err := c.publishTweet(newOpts("bravo", "/image.png"))
+		var rateLimitedErr *RateLimitedError
+		assert.True(t, errors.As(err, &rateLimitedErr))
+		assert.Equal(t, TwitterEndpointMediaUpload, rateLimitedErr.Endpoint)
+
+		// Further uploads wait for the cooldown, but tweets without media can still be created
+		uploads = 0
+		_, err = c.publishTweet(newOpts("bravo", "/image.png"))
+		assert.True(t, errors.As(err, &rateLimitedErr))
+		assert.Equal(t, 0, uploads)
+
+		_, err = c.publishTweet(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "no media", Username: "bravo"})
+		assert.Nil(t, err)
+	})
+}
+
+func TestParseMultipartPublishTweetOpts(t *testing.T) {
+	newRequest := func(mediaType string, body []byte) *http.Request {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField(multipartFormFieldOpts, `{"publishTweetType":"text","text":"hello"}`)
+		mw.WriteField(multipartFormFieldAltTxt, "a pixel")
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", `form-data; name="media"; filename="media"`)
+		header.Set(HTTPHeaderContentType, mediaType)
+		part, _ := mw.CreatePart(header)
+		part.Write(body)
+		mw.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/api/tweet", &buf)
+		r.Header.Set(HTTPHeaderContentType, mw.FormDataContentType())
+		return r
+	}
+
+	opts, err := parseMultipartPublishTweetOpts(newRequest("image/png", testPngBytes))
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", opts.Text)
+	assert.Len(t, opts.Media, 1)
+	assert.Equal(t, testPngBytes, opts.Media[0].body)
+	assert.Equal(t, "a pixel", opts.Media[0].AltText)
+
+	// A file is only read up to the maximum size of its media type
+	_, err = parseMultipartPublishTweetOpts(newRequest("image/png", make([]byte, maxImageBytes+1)))
+	assert.IsType(t, &ValidationError{}, err)
+}
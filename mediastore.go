@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// Stored media is identified by the sha256 of its body
+var storedMediaIDRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// MediaStore keeps the bodies of the media items of tweets that are published later (ex: scheduled tweets,
+// queued jobs, recurring jobs, and templates), so that their records reference the media by ID instead of embedding it.
+// Each body is stored once as a file named after its hash, however many records reference it.
+// A MediaStore with an empty dir is kept in memory only.
+type MediaStore struct {
+	dir   string
+	items map[string][]byte
+	mu    sync.RWMutex
+}
+
+func newMediaStore(dir string) *MediaStore {
+	return &MediaStore{
+		dir:   dir,
+		items: make(map[string][]byte),
+	}
+}
+
+// put stores the body, and returns its ID.
+func (ms *MediaStore) put(body []byte) (string, error) {
+	sum := sha256.Sum256(body)
+	id := hex.EncodeToString(sum[:])
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.dir == "" {
+		ms.items[id] = body
+		return id, nil
+	}
+
+	path := filepath.Join(ms.dir, id)
+	if exists(path) {
+		return id, nil
+	}
+
+	if err := os.MkdirAll(ms.dir, 0o755); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first, so a crash mid-write can't leave a partial body under the ID
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o600); err != nil {
+		return "", err
+	}
+	return id, os.Rename(tmp, path)
+}
+
+func (ms *MediaStore) get(id string) ([]byte, error) {
+	if !storedMediaIDRegexp.MatchString(id) {
+		return nil, newValidationErr("invalid stored media ID (%s)", id)
+	}
+
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if ms.dir == "" {
+		body, ok := ms.items[id]
+		if !ok {
+			return nil, &NotFoundError{Resource: "stored media", ID: id}
+		}
+		return body, nil
+	}
+
+	body, err := os.ReadFile(filepath.Join(ms.dir, id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, &NotFoundError{Resource: "stored media", ID: id}
+	}
+	return body, err
+}
+
+// persist copies the media so that it can be stored as json, moving the body of each uploaded file
+// or base64 data item into the store. Url items are stored as-is, and fetched when they are published.
+func (ms *MediaStore) persist(media []*MediaOpts) ([]*MediaOpts, error) {
+	if media == nil {
+		return nil, nil
+	}
+
+	copied := make([]*MediaOpts, len(media))
+	for i, m := range media {
+		if m == nil {
+			continue
+		}
+
+		c := *m
+		body := c.body
+		if body == nil && c.Data != "" && c.Url == "" {
+			var err error
+			if body, err = base64.StdEncoding.DecodeString(c.Data); err != nil {
+				return nil, newValidationErr("media data is not valid base64: %s", err.Error())
+			}
+		}
+		if body != nil {
+			id, err := ms.put(body)
+			if err != nil {
+				return nil, err
+			}
+			c.StoredID, c.Data = id, ""
+		}
+		c.body = nil
+		copied[i] = &c
+	}
+	return copied, nil
+}
+
+// resolve returns a copy of opts whose media items that reference the store have their body loaded,
+// so that it can be published.
+func (ms *MediaStore) resolve(opts PublishTweetOpts) (PublishTweetOpts, error) {
+	if opts.Media == nil {
+		return opts, nil
+	}
+
+	media := make([]*MediaOpts, len(opts.Media))
+	for i, m := range opts.Media {
+		if m == nil {
+			continue
+		}
+
+		c := *m
+		if c.StoredID != "" {
+			body, err := ms.get(c.StoredID)
+			if err != nil {
+				return opts, err
+			}
+			c.body = body
+		}
+		media[i] = &c
+	}
+	opts.Media = media
+	return opts, nil
+}
+
+// prune removes the stored media whose ID isn't referenced.
+func (ms *MediaStore) prune(referenced map[string]bool) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if ms.dir == "" {
+		for id := range ms.items {
+			if !referenced[id] {
+				delete(ms.items, id)
+			}
+		}
+		return nil
+	}
+
+	entries, err := os.ReadDir(ms.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		// Leftover temporary files are removed as well
+		if id := entry.Name(); !referenced[id] {
+			errs = append(errs, os.Remove(filepath.Join(ms.dir, id)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// storedMediaIDs adds the IDs of the stored media referenced by opts to ids.
+func storedMediaIDs(ids map[string]bool, opts PublishTweetOpts) {
+	for _, m := range opts.Media {
+		if m != nil && m.StoredID != "" {
+			ids[m.StoredID] = true
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	ms := newMediaStore(dir)
+
+	body := []byte("\x89PNG\r\n\x1a\nimage")
+	media := []*MediaOpts{
+		{Data: base64.StdEncoding.EncodeToString(body), AltText: "from data"},
+		{body: body, MediaType: "image/png"},
+		{Url: "https://example.com/image.png"},
+	}
+
+	persisted, err := ms.persist(media)
+	assert.Nil(t, err)
+
+	// The same body is stored once, and referenced by both items
+	assert.NotEmpty(t, persisted[0].StoredID)
+	assert.Equal(t, persisted[0].StoredID, persisted[1].StoredID)
+	assert.Empty(t, persisted[0].Data)
+	assert.Equal(t, "from data", persisted[0].AltText)
+	assert.Nil(t, persisted[1].body)
+	assert.Equal(t, "https://example.com/image.png", persisted[2].Url)
+	assert.Empty(t, persisted[2].StoredID)
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	// The original media is unchanged
+	assert.NotEmpty(t, media[0].Data)
+	assert.NotNil(t, media[1].body)
+
+	t.Run("Test resolve()", func(t *testing.T) {
+		opts := PublishTweetOpts{Media: persisted}
+		resolved, err := ms.resolve(opts)
+		assert.Nil(t, err)
+		assert.Equal(t, body, resolved.Media[0].body)
+		assert.Equal(t, body, resolved.Media[1].body)
+		assert.Nil(t, resolved.Media[2].body)
+		assert.Nil(t, persisted[0].body)
+
+		// Media that was stored but not resolved can't be published
+		assert.IsType(t, &ValidationError{}, persisted[0].load(newFetcher(defaultFetchConfig())))
+
+		_, err = ms.resolve(PublishTweetOpts{Media: []*MediaOpts{{StoredID: "../templates.json"}}})
+		assert.IsType(t, &ValidationError{}, err)
+
+		_, err = ms.resolve(PublishTweetOpts{Media: []*MediaOpts{{StoredID: strings.Repeat("0", 64)}}})
+		assert.IsType(t, &NotFoundError{}, err)
+	})
+
+	t.Run("Test prune()", func(t *testing.T) {
+		other, err := ms.put([]byte("other"))
+		assert.Nil(t, err)
+
+		assert.Nil(t, ms.prune(map[string]bool{other: true}))
+
+		_, err = ms.get(persisted[0].StoredID)
+		assert.IsType(t, &NotFoundError{}, err)
+		got, err := ms.get(other)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("other"), got)
+	})
+}
+
+func TestStoredMedia(t *testing.T) {
+	api := newTestAPI(newTestTwitterClient(t, nil, "alpha"))
+
+	publishAt := time.Now().Add(time.Hour)
+	data := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nimage"))
+	st, err := api.scheduler.schedule(PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		Text:             "later",
+		Media:            []*MediaOpts{{Data: data}},
+		PublishAt:        &publishAt,
+	})
+	assert.Nil(t, err)
+
+	// The record references the media instead of embedding it
+	assert.Empty(t, st.Opts.Media[0].Data)
+	assert.NotEmpty(t, st.Opts.Media[0].StoredID)
+
+	orphan, err := api.media.put([]byte("orphan"))
+	assert.Nil(t, err)
+
+	assert.Nil(t, api.pruneMedia())
+
+	_, err = api.media.get(st.Opts.Media[0].StoredID)
+	assert.Nil(t, err)
+	_, err = api.media.get(orphan)
+	assert.IsType(t, &NotFoundError{}, err)
+}
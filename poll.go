@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/michimani/gotwi"
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+const (
+	minPollOptions         = 2
+	maxPollOptions         = 4
+	maxPollOptionLength    = 25
+	minPollDurationMinutes = 5
+	maxPollDurationMinutes = 7 * 24 * 60
+)
+
+type PollOpts struct {
+	Options         []string `json:"options"`
+	DurationMinutes int      `json:"durationMinutes"`
+}
+
+func (p *PollOpts) String() string {
+	return fmt.Sprintf("PollOpts{ Options: %q, DurationMinutes: %d }", p.Options, p.DurationMinutes)
+}
+
+func (p *PollOpts) validate() error {
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		return newValidationErr("poll must have between (%d) and (%d) options (received: %d)", minPollOptions, maxPollOptions, len(p.Options))
+	}
+
+	for i, option := range p.Options {
+		length := len([]rune(strings.TrimSpace(option)))
+		if length == 0 {
+			return newValidationErr("poll option (%d) cannot be an empty string", i+1)
+		}
+		if length > maxPollOptionLength {
+			return newValidationErr("poll option (%d) is (%d) characters long, which exceeds the maximum of (%d)", i+1, length, maxPollOptionLength)
+		}
+	}
+
+	if p.DurationMinutes < minPollDurationMinutes || p.DurationMinutes > maxPollDurationMinutes {
+		return newValidationErr("poll duration must be between (%d) and (%d) minutes (received: %d)", minPollDurationMinutes, maxPollDurationMinutes, p.DurationMinutes)
+	}
+
+	return nil
+}
+
+// render returns a copy of the poll with each option rendered against the fetched json data, and the variables of a named template.
+func (p *PollOpts) render(data interface{}, vars map[string]string, strict bool) (*PollOpts, error) {
+	rendered := &PollOpts{
+		Options:         make([]string, len(p.Options)),
+		DurationMinutes: p.DurationMinutes,
+	}
+
+	for i, option := range p.Options {
+		s, err := renderTemplate(option, data, vars, strict)
+		if err != nil {
+			return nil, fmt.Errorf("poll option (%d): %w", i+1, err)
+		}
+		rendered.Options[i] = strings.TrimSpace(s)
+	}
+
+	return rendered, nil
+}
+
+func (p *PollOpts) toCreateInput() *managetweetTypes.CreateInputPoll {
+	if p == nil {
+		return nil
+	}
+
+	return &managetweetTypes.CreateInputPoll{
+		Options:         p.Options,
+		DurationMinutes: gotwi.Int(p.DurationMinutes),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollOpts(t *testing.T) {
+	f := newPrivateTestFetcher()
+	t.Run("Test validate()", func(t *testing.T) {
+		type ValidatePollTest struct {
+			poll      PollOpts
+			shouldErr bool
+		}
+
+		tests := []ValidatePollTest{
+			// Proper usage
+			{
+				poll:      PollOpts{Options: []string{"Yes", "No"}, DurationMinutes: 60},
+				shouldErr: false,
+			},
+			{
+				poll:      PollOpts{Options: []string{"A", "B", "C", "D"}, DurationMinutes: maxPollDurationMinutes},
+				shouldErr: false,
+			},
+
+			// Invalid number of options
+			{
+				poll:      PollOpts{Options: []string{"Yes"}, DurationMinutes: 60},
+				shouldErr: true,
+			},
+			{
+				poll:      PollOpts{Options: []string{"A", "B", "C", "D", "E"}, DurationMinutes: 60},
+				shouldErr: true,
+			},
+
+			// Invalid options
+			{
+				poll:      PollOpts{Options: []string{"Yes", " "}, DurationMinutes: 60},
+				shouldErr: true,
+			},
+			{
+				poll:      PollOpts{Options: []string{"Yes", strings.Repeat("a", maxPollOptionLength+1)}, DurationMinutes: 60},
+				shouldErr: true,
+			},
+
+			// Invalid durations
+			{
+				poll:      PollOpts{Options: []string{"Yes", "No"}, DurationMinutes: minPollDurationMinutes - 1},
+				shouldErr: true,
+			},
+			{
+				poll:      PollOpts{Options: []string{"Yes", "No"}, DurationMinutes: maxPollDurationMinutes + 1},
+				shouldErr: true,
+			},
+		}
+
+		for _, test := range tests {
+			err := test.poll.validate()
+			if test.shouldErr {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+			}
+		}
+	})
+
+	t.Run("Test templated options", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"question": "Best language?", "a": "Go", "b": "Rust"}`))
+		}))
+		defer server.Close()
+
+		opts := PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              server.URL,
+			Text:             "{*{ question }*}",
+			Poll: &PollOpts{
+				Options:         []string{"{*{ a }*}", "{*{ b }*}", "Other"},
+				DurationMinutes: 60,
+			},
+		}
+
+		rendered, err := opts.render(f)
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"Best language?"}, rendered.Texts)
+		assert.Equal(t, []string{"Go", "Rust", "Other"}, rendered.Poll.Options)
+
+		// The original options are left untouched
+		assert.Equal(t, "{*{ a }*}", opts.Poll.Options[0])
+
+		opts.Poll.Options = []string{"{*{ missing }*}", "No"}
+		_, err = opts.render(f)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("Test poll with media", func(t *testing.T) {
+		opts := PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeText,
+			Text:             "Which one?",
+			Poll:             &PollOpts{Options: []string{"A", "B"}, DurationMinutes: 60},
+			Media:            []*MediaOpts{{MediaType: "image/png", body: testPngBytes}},
+		}
+
+		_, err := opts.render(f)
+		assert.NotNil(t, err)
+	})
+}
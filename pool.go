@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/michimani/gotwi"
+)
+
+type ClientSelectionStrategy string
+
+const (
+	ClientSelectionStrategyPriority          ClientSelectionStrategy = "priority"
+	ClientSelectionStrategyRoundRobin        ClientSelectionStrategy = "round_robin"
+	ClientSelectionStrategyLeastRecentlyUsed ClientSelectionStrategy = "least_recently_used"
+	ClientSelectionStrategyWeighted          ClientSelectionStrategy = "weighted"
+)
+
+func (s ClientSelectionStrategy) isValid() bool {
+	switch s {
+	case ClientSelectionStrategyPriority,
+		ClientSelectionStrategyRoundRobin,
+		ClientSelectionStrategyLeastRecentlyUsed,
+		ClientSelectionStrategyWeighted:
+		return true
+	}
+	return false
+}
+
+func parseClientSelectionStrategy(s string) (ClientSelectionStrategy, error) {
+	if s == "" {
+		return ClientSelectionStrategyPriority, nil
+	}
+
+	strategy := ClientSelectionStrategy(s)
+	if !strategy.isValid() {
+		return "", fmt.Errorf("invalid client selection strategy: %s", s)
+	}
+
+	return strategy, nil
+}
+
+type PoolClient struct {
+	creds         TwitterAPICreds
+	client        *gotwi.Client
+	lastUsed      uint64
+	currentWeight int
+	rateLimits    map[TwitterEndpoint]RateLimitState
+	userID        string
+}
+
+func (pc *PoolClient) weight() int {
+	if pc.creds.Weight < 1 {
+		return 1
+	}
+	return pc.creds.Weight
+}
+
+// ClientPool holds the Twitter clients in the order their credentials were declared,
+// and decides which order they should be tried in for each request.
+type ClientPool struct {
+	clients  []*PoolClient
+	strategy ClientSelectionStrategy
+	cursor   int
+	uses     uint64
+	mu       sync.Mutex
+}
+
+func newClientPool(clients []*PoolClient, strategy ClientSelectionStrategy) *ClientPool {
+	return &ClientPool{
+		clients:  clients,
+		strategy: strategy,
+	}
+}
+
+func (p *ClientPool) len() int {
+	return len(p.clients)
+}
+
+func (p *ClientPool) getByUsername(username string) (*PoolClient, bool) {
+	if username == "" {
+		return nil, false
+	}
+
+	for _, pc := range p.clients {
+		if pc.creds.Username == username {
+			return pc, true
+		}
+	}
+
+	return nil, false
+}
+
+// ordered returns every client in the pool, in the order they should be tried.
+// The first client is the one chosen by the selection strategy,
+// and the rest act as fallbacks.
+func (p *ClientPool) ordered() []*PoolClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ordered := make([]*PoolClient, len(p.clients))
+	copy(ordered, p.clients)
+
+	if len(ordered) == 0 {
+		return ordered
+	}
+
+	switch p.strategy {
+	case ClientSelectionStrategyRoundRobin:
+		start := p.cursor % len(ordered)
+		ordered = append(ordered[start:], ordered[:start]...)
+		p.cursor = (start + 1) % len(ordered)
+	case ClientSelectionStrategyLeastRecentlyUsed:
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].lastUsed < ordered[j].lastUsed
+		})
+	case ClientSelectionStrategyWeighted:
+		// Smooth weighted round-robin: each client accumulates its weight every pick,
+		// and the chosen client gives back the total weight of the pool.
+		var (
+			total  = 0
+			chosen = 0
+		)
+		for i, pc := range ordered {
+			pc.currentWeight += pc.weight()
+			total += pc.weight()
+			if pc.currentWeight > ordered[chosen].currentWeight {
+				chosen = i
+			}
+		}
+		ordered[chosen].currentWeight -= total
+
+		first := ordered[chosen]
+		ordered = append(ordered[:chosen], ordered[chosen+1:]...)
+		ordered = append([]*PoolClient{first}, ordered...)
+	}
+
+	return ordered
+}
+
+func (p *ClientPool) markUsed(pc *PoolClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.uses++
+	pc.lastUsed = p.uses
+}
+
+// cooldownUntil reports the time at which the client may be used for the endpoint again,
+// if it is currently rate-limited on that endpoint.
+func (p *ClientPool) cooldownUntil(pc *PoolClient, endpoint TwitterEndpoint, now time.Time) (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := pc.rateLimits[endpoint]
+	if !ok || !state.inCooldown(now) {
+		return time.Time{}, false
+	}
+	return state.ResetAt, true
+}
+
+// recordRateLimit stores the rate limit state of the client for the endpoint, if err was caused by a rate limit.
+// It returns the stored state, and whether err was caused by a rate limit.
+func (p *ClientPool) recordRateLimit(pc *PoolClient, endpoint TwitterEndpoint, err error, now time.Time) (RateLimitState, bool) {
+	state, ok := rateLimitStateFromErr(err, now)
+	if !ok {
+		return state, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pc.rateLimits == nil {
+		pc.rateLimits = make(map[TwitterEndpoint]RateLimitState)
+	}
+	pc.rateLimits[endpoint] = state
+
+	return state, true
+}
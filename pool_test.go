@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPool(t *testing.T) {
+	var newTestPool = func(strategy ClientSelectionStrategy, weights ...int) *ClientPool {
+		clients := []*PoolClient{}
+		for i, weight := range weights {
+			clients = append(clients, &PoolClient{
+				creds: TwitterAPICreds{
+					Username: string(rune('a' + i)),
+					Weight:   weight,
+				},
+			})
+		}
+		return newClientPool(clients, strategy)
+	}
+
+	var firstUsernames = func(p *ClientPool, n int) string {
+		s := ""
+		for i := 0; i < n; i++ {
+			pc := p.ordered()[0]
+			p.markUsed(pc)
+			s += pc.creds.Username
+		}
+		return s
+	}
+
+	var usernames = func(clients []*PoolClient) string {
+		s := ""
+		for _, pc := range clients {
+			s += pc.creds.Username
+		}
+		return s
+	}
+
+	t.Run("Test priority", func(t *testing.T) {
+		p := newTestPool(ClientSelectionStrategyPriority, 1, 1, 1)
+		assert.Equal(t, "aaaa", firstUsernames(p, 4))
+		assert.Equal(t, "abc", usernames(p.ordered()))
+	})
+
+	t.Run("Test round robin", func(t *testing.T) {
+		p := newTestPool(ClientSelectionStrategyRoundRobin, 1, 1, 1)
+		assert.Equal(t, "abc", usernames(p.ordered()))
+		assert.Equal(t, "bca", usernames(p.ordered()))
+		assert.Equal(t, "cab", usernames(p.ordered()))
+		assert.Equal(t, "abc", usernames(p.ordered()))
+	})
+
+	t.Run("Test least recently used", func(t *testing.T) {
+		p := newTestPool(ClientSelectionStrategyLeastRecentlyUsed, 1, 1, 1)
+		assert.Equal(t, "abcabc", firstUsernames(p, 6))
+
+		pc, ok := p.getByUsername("a")
+		assert.True(t, ok)
+		p.markUsed(pc)
+		assert.Equal(t, "bca", usernames(p.ordered()))
+	})
+
+	t.Run("Test weighted", func(t *testing.T) {
+		p := newTestPool(ClientSelectionStrategyWeighted, 5, 1, 1)
+		assert.Equal(t, "aabacaa", firstUsernames(p, 7))
+	})
+
+	t.Run("Test parseClientSelectionStrategy()", func(t *testing.T) {
+		strategy, err := parseClientSelectionStrategy("")
+		assert.Nil(t, err)
+		assert.Equal(t, ClientSelectionStrategyPriority, strategy)
+
+		strategy, err = parseClientSelectionStrategy("round_robin")
+		assert.Nil(t, err)
+		assert.Equal(t, ClientSelectionStrategyRoundRobin, strategy)
+
+		_, err = parseClientSelectionStrategy("random")
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// TweetPreview is the result of rendering and validating PublishTweetOpts without publishing them.
+type TweetPreview struct {
+	PublishTweetType PublishTweetType       `json:"publishTweetType"`
+	Texts            []*TweetPreviewText    `json:"texts"`
+	JsonFmts         map[string]interface{} `json:"jsonFmts,omitempty"`
+	Poll             *PollOpts              `json:"poll,omitempty"`
+	ReplyToTweetID   string                 `json:"replyToTweetID,omitempty"`
+	TargetTweetID    string                 `json:"targetTweetID,omitempty"`
+	Valid            bool                   `json:"valid"`
+	// Error is why the tweet would be rejected if it were published
+	Error    *APIError `json:"error,omitempty"`
+	Warnings []string  `json:"warnings"`
+}
+
+type TweetPreviewText struct {
+	Text           string `json:"text"`
+	WeightedLength int    `json:"weightedLength"`
+	MaxLength      int    `json:"maxLength"`
+}
+
+// previewTweet fetches, renders, and validates the tweet(s) described by opts, the same way as publishTweet,
+// but without calling the Twitter API. Errors that prevent the text from being rendered (ex: a failed fetch)
+// are returned, while a rendered tweet that fails validation is reported by the preview.
+func (c *TwitterClient) previewTweet(opts PublishTweetOpts) (*TweetPreview, error) {
+	rendered, data, err := opts.build(c.fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &TweetPreview{
+		PublishTweetType: rendered.PublishTweetType,
+		Texts:            []*TweetPreviewText{},
+		Poll:             rendered.Poll,
+		ReplyToTweetID:   rendered.ReplyToTweetID,
+		TargetTweetID:    rendered.TargetTweetID,
+		Valid:            true,
+		Warnings:         []string{},
+	}
+
+	for _, text := range rendered.Texts {
+		preview.Texts = append(preview.Texts, &TweetPreviewText{
+			Text:           text,
+			WeightedLength: weightedTweetLength(text),
+			MaxLength:      maxWeightedTweetLength,
+		})
+	}
+
+	if err := rendered.validate(); err != nil {
+		_, preview.Error = toAPIError(err)
+		preview.Valid = false
+	}
+
+	if data != nil {
+		preview.JsonFmts, preview.Warnings = previewJsonFmts(opts, data)
+	}
+
+	if opts.AutoThread && rendered.isThread() && rendered.PublishTweetType == PublishTweetTypeFetchJson {
+		preview.Warnings = append(preview.Warnings, fmt.Sprintf("the text is over the maximum length, and will be published as a thread of (%d) tweets", len(rendered.Texts)))
+	}
+
+	if opts.Username != "" {
+		if _, ok := c.pool.getByUsername(opts.Username); !ok {
+			preview.Warnings = append(preview.Warnings, (&NotFoundInPoolError{Username: opts.Username}).Error())
+		}
+	}
+
+	preview.Warnings = append(preview.Warnings, c.previewDuplicates(opts.Username, rendered.ContentHash)...)
+
+	return preview, nil
+}
+
+// previewJsonFmts resolves the paths used by the text and poll options of a fetch_json tweet,
+// and warns about paths that weren't found.
+func previewJsonFmts(opts PublishTweetOpts, data interface{}) (map[string]interface{}, []string) {
+	var (
+		values   = map[string]interface{}{}
+		warnings = []string{}
+	)
+
+	templates := []string{opts.Text}
+	if opts.Poll != nil {
+		templates = append(templates, opts.Poll.Options...)
+	}
+
+	for _, text := range templates {
+		t, err := parseTemplate(text)
+		if err != nil {
+			continue
+		}
+
+		for _, path := range t.paths() {
+			if _, ok := values[path.raw]; ok {
+				continue
+			}
+
+			value, _, err := path.get(data)
+			if err != nil {
+				warnings = append(warnings, err.Error())
+				continue
+			}
+			values[path.raw] = value
+		}
+	}
+
+	return values, warnings
+}
+
+// previewDuplicates warns if the content was already published within the dedupe window,
+// by username if it's given, or otherwise by any account in the client pool.
+func (c *TwitterClient) previewDuplicates(username, contentHash string) []string {
+	usernames := []string{username}
+	if username == "" {
+		usernames = []string{}
+		for _, pc := range c.pool.clients {
+			usernames = append(usernames, pc.creds.Username)
+		}
+	}
+
+	warnings := []string{}
+	now := time.Now()
+	for _, u := range usernames {
+		if dupErr, ok := c.findDuplicate(u, contentHash, now); ok {
+			warnings = append(warnings, fmt.Sprintf("%s, so publishing it again will be skipped", dupErr.Error()))
+		}
+	}
+	return warnings
+}
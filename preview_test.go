@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewTweet(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to the Twitter API: %s %s", r.Method, r.URL.String())
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha", "bravo")
+	allowPrivateFetches(c)
+	c.contentHashes, _ = newStore[ContentHash]("")
+	c.dedupeWindow = time.Hour
+	api := newTestAPI(c)
+
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"post": map[string]any{
+				"title": "Go 1.24 is released",
+				"body":  strings.Repeat("word ", 100),
+				"tags":  []string{"go", "release"},
+				"views": 1500,
+			},
+		})
+	}))
+	defer feed.Close()
+
+	decodePreview := func(t *testing.T, w *httptest.ResponseRecorder) *TweetPreview {
+		var resp struct {
+			Data *TweetPreview `json:"data"`
+		}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+		return resp.Data
+	}
+
+	t.Run("Test fetch_json", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             `{{ post.title | upper }} ({{ post.views }} views) {{ post.tags | join " #" }}`,
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		preview := decodePreview(t, w)
+		assert.True(t, preview.Valid)
+		assert.Nil(t, preview.Error)
+		assert.Empty(t, preview.Warnings)
+		assert.Equal(t, []*TweetPreviewText{{
+			Text:           "GO 1.24 IS RELEASED (1500 views) go #release",
+			WeightedLength: 44,
+			MaxLength:      maxWeightedTweetLength,
+		}}, preview.Texts)
+		assert.Equal(t, map[string]interface{}{
+			"post.title": "Go 1.24 is released",
+			"post.views": float64(1500),
+			"post.tags":  []interface{}{"go", "release"},
+		}, preview.JsonFmts)
+	})
+
+	t.Run("Test invalid rendered text", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             "{{ post.body }}",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		preview := decodePreview(t, w)
+		assert.False(t, preview.Valid)
+		assert.Equal(t, APIErrCodeInvalidText, preview.Error.Code)
+		assert.Len(t, preview.Texts, 1)
+		assert.Equal(t, 500, preview.Texts[0].WeightedLength)
+	})
+
+	t.Run("Test warnings", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             `{{ post.subtitle | default "none" }} |* truncate({*{ post.title }*}, 10) *| {{ post.body }}`,
+			Username:         "charlie",
+			AutoThread:       true,
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		preview := decodePreview(t, w)
+		assert.True(t, preview.Valid)
+		assert.Greater(t, len(preview.Texts), 1)
+		assert.Len(t, preview.Warnings, 3)
+		assert.Contains(t, preview.Warnings[0], "key (subtitle) not found")
+		assert.Contains(t, preview.Warnings[1], "published as a thread")
+		assert.Contains(t, preview.Warnings[2], "(charlie) not found in client pool")
+	})
+
+	t.Run("Test duplicate content", func(t *testing.T) {
+		opts := PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"}
+		rendered, err := opts.render(c.fetcher)
+		assert.Nil(t, err)
+		assert.Nil(t, c.recordContentHash("bravo", rendered.ContentHash, "1000000000000000001", time.Now()))
+
+		w := doTestRequest(api, http.MethodPost, "/api/tweet/preview", opts)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		preview := decodePreview(t, w)
+		assert.True(t, preview.Valid)
+		assert.Nil(t, preview.JsonFmts)
+		assert.Len(t, preview.Warnings, 1)
+		assert.Contains(t, preview.Warnings[0], "(bravo) already published the same content")
+
+		opts.Username = "alpha"
+		preview = decodePreview(t, doTestRequest(api, http.MethodPost, "/api/tweet/preview", opts))
+		assert.Empty(t, preview.Warnings)
+	})
+
+	t.Run("Test errors that prevent rendering", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             "{{ post.missing }}",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             "|* truncate({*{ post.title }*}, many) *|",
+			Strict:           true,
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL + "/missing",
+			Text:             "{{ post.title }}",
+		})
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+
+		w = doTestRequest(api, http.MethodPost, "/api/tweet/preview", PublishTweetOpts{
+			PublishTweetType: "unknown",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
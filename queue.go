@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPublishQueueSize    = 100
+	defaultPublishQueueWorkers = 4
+	// The number of times a job is attempted before a rate limit fails it
+	maxPublishJobAttempts = 5
+	// How long finished jobs can be looked up before they are removed
+	publishJobRetention = 24 * time.Hour
+)
+
+type PublishJobStatus string
+
+const (
+	PublishJobStatusQueued    PublishJobStatus = "queued"
+	PublishJobStatusRunning   PublishJobStatus = "running"
+	PublishJobStatusSucceeded PublishJobStatus = "succeeded"
+	PublishJobStatusFailed    PublishJobStatus = "failed"
+)
+
+// PublishJob is a publish request that is handled in the background by the publish queue.
+type PublishJob struct {
+	ID            string              `json:"id"`
+	Opts          PublishTweetOpts    `json:"opts"`
+	Status        PublishJobStatus    `json:"status"`
+	Attempts      int                 `json:"attempts"`
+	NextAttemptAt *time.Time          `json:"nextAttemptAt,omitempty"`
+	Result        *PublishTweetResult `json:"result,omitempty"`
+	Error         *APIError           `json:"error,omitempty"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	UpdatedAt     time.Time           `json:"updatedAt"`
+}
+
+func (j PublishJob) isFinished() bool {
+	return j.Status == PublishJobStatusSucceeded || j.Status == PublishJobStatusFailed
+}
+
+// QueueFullError is returned when a job can't be accepted because the publish queue is full.
+type QueueFullError struct {
+	Size int
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("the publish queue is full (%d jobs), try again later", e.Size)
+}
+
+// parsePositiveInt parses an optional positive integer env variable.
+func parsePositiveInt(name, s string, defaultValue int) (int, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, s)
+	}
+	return n, nil
+}
+
+// PublishQueue publishes jobs with a pool of workers. The queue is bounded,
+// so jobs are rejected with a *QueueFullError rather than piling up when publishing falls behind.
+// Jobs waiting to be retried count against the bound as well, since they will be queued again.
+type PublishQueue struct {
+	client  *TwitterClient
+	store   *Store[PublishJob]
+	media   *MediaStore
+	queue   chan string
+	workers int
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	// mu serializes enqueues, so the number of queued jobs can't exceed the bound
+	mu sync.Mutex
+	*Logger
+}
+
+func newPublishQueue(client *TwitterClient, store *Store[PublishJob], media *MediaStore, size, workers int, logger *Logger) *PublishQueue {
+	return &PublishQueue{
+		client:  client,
+		store:   store,
+		media:   media,
+		queue:   make(chan string, size),
+		workers: workers,
+		stop:    make(chan struct{}),
+		Logger:  logger,
+	}
+}
+
+// start recovers the jobs left by a previous shutdown, and runs the workers until close is called.
+func (q *PublishQueue) start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+
+	for _, job := range q.store.List() {
+		switch job.Status {
+		case PublishJobStatusRunning:
+			q.finish(job.ID, nil, errInterruptedPublish)
+		case PublishJobStatusQueued:
+			q.requeueAfter(job.ID, 0)
+		}
+	}
+}
+
+func (q *PublishQueue) close() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+func (q *PublishQueue) work() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case id := <-q.queue:
+			q.process(id)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// enqueue stores the job, and adds it to the queue if there is room.
+func (q *PublishQueue) enqueue(opts PublishTweetOpts) (PublishJob, error) {
+	opts, err := opts.prepare(q.client.fetcher, q.media)
+	if err != nil {
+		return PublishJob{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	q.LogErr(q.store.DeleteFunc(func(_ string, job PublishJob) bool {
+		return job.isFinished() && now.Sub(job.UpdatedAt) >= publishJobRetention
+	}))
+
+	if q.queued() >= cap(q.queue) {
+		return PublishJob{}, &QueueFullError{Size: cap(q.queue)}
+	}
+
+	job := PublishJob{
+		ID:        newID(),
+		Opts:      opts,
+		Status:    PublishJobStatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := q.store.Set(job.ID, job); err != nil {
+		return PublishJob{}, err
+	}
+
+	select {
+	case q.queue <- job.ID:
+		return job, nil
+	default:
+		// Left in the store, the job would be published after a restart, even though it was rejected
+		if _, err := q.store.Delete(job.ID); err != nil {
+			return PublishJob{}, fmt.Errorf("error removing rejected job (%s): %w", job.ID, err)
+		}
+		return PublishJob{}, &QueueFullError{Size: cap(q.queue)}
+	}
+}
+
+// queued returns the number of jobs that are queued, or waiting to be queued again (ex: a rate-limited job,
+// or a job recovered by start).
+func (q *PublishQueue) queued() int {
+	n := 0
+	for _, job := range q.store.List() {
+		if job.Status == PublishJobStatusQueued {
+			n++
+		}
+	}
+	return n
+}
+
+// requeueAfter adds the job back to the queue after d. Unlike enqueue, it waits for room in the queue,
+// because the job was already accepted.
+func (q *PublishQueue) requeueAfter(id string, d time.Duration) {
+	go func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-q.stop:
+			return
+		}
+
+		select {
+		case q.queue <- id:
+		case <-q.stop:
+		}
+	}()
+}
+
+func (q *PublishQueue) process(id string) {
+	var opts PublishTweetOpts
+	var attempts int
+	ok, err := q.store.Update(id, func(job PublishJob) (PublishJob, error) {
+		job.Status = PublishJobStatusRunning
+		job.Attempts++
+		job.NextAttemptAt = nil
+		job.UpdatedAt = time.Now()
+		opts = job.Opts
+		attempts = job.Attempts
+		return job, nil
+	})
+	if !ok || err != nil {
+		q.LogErr(err)
+		return
+	}
+
+	q.Infof("Publishing queued job (%s), attempt (%d)\n", id, attempts)
+	var result *PublishTweetResult
+	opts, err = q.media.resolve(opts)
+	if err == nil {
+		result, err = q.client.publishTweet(opts)
+	}
+
+	var rateLimitedErr *RateLimitedError
+	if errors.As(err, &rateLimitedErr) && attempts < maxPublishJobAttempts {
+		q.retry(id, rateLimitedErr)
+		return
+	}
+
+	q.finish(id, result, err)
+}
+
+// retry puts a rate-limited job back in the queue once the earliest client is available again.
+func (q *PublishQueue) retry(id string, rateLimitedErr *RateLimitedError) {
+	now := time.Now()
+	_, apiErr := toAPIError(rateLimitedErr)
+	_, err := q.store.Update(id, func(job PublishJob) (PublishJob, error) {
+		job.Status = PublishJobStatusQueued
+		job.NextAttemptAt = &rateLimitedErr.ResetAt
+		job.Error = apiErr
+		job.UpdatedAt = now
+		return job, nil
+	})
+	q.LogErr(err)
+
+	q.Infof("Retrying rate-limited job (%s) at %s\n", id, rateLimitedErr.ResetAt.UTC().Format(time.RFC3339))
+	q.requeueAfter(id, rateLimitedErr.RetryAfter(now))
+}
+
+func (q *PublishQueue) finish(id string, result *PublishTweetResult, publishErr error) {
+	var callbackUrl string
+	_, err := q.store.Update(id, func(job PublishJob) (PublishJob, error) {
+		callbackUrl = job.Opts.CallbackUrl
+		job.Result = result
+		job.Error = nil
+		job.UpdatedAt = time.Now()
+		if publishErr != nil {
+			job.Status = PublishJobStatusFailed
+			_, job.Error = toAPIError(publishErr)
+		} else {
+			job.Status = PublishJobStatusSucceeded
+		}
+		return job, nil
+	})
+	q.LogErr(err)
+
+	q.client.notifyPublished(callbackUrl, result, publishErr)
+
+	if publishErr != nil {
+		q.Errorf("error publishing queued job (%s): %s\n", id, publishErr.Error())
+		return
+	}
+	q.Infof("Published queued job (%s): %s\n", id, result.String())
+}
+
+func (q *PublishQueue) get(id string) (PublishJob, error) {
+	job, ok := q.store.Get(id)
+	if !ok {
+		return PublishJob{}, &NotFoundError{Resource: "job", ID: id}
+	}
+	return job, nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePositiveInt(t *testing.T) {
+	n, err := parsePositiveInt(EnvPublishQueueSize, "", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, n)
+
+	n, err = parsePositiveInt(EnvPublishQueueSize, "3", 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	for _, value := range []string{"0", "-1", "ten"} {
+		_, err := parsePositiveInt(EnvPublishQueueSize, value, 10)
+		assert.NotNil(t, err, value)
+	}
+}
+
+func TestPublishQueue(t *testing.T) {
+	rateLimited := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+
+		if *in.Text == "rate limited" && rateLimited < 1 {
+			rateLimited++
+			w.Header().Set(HTTPHeaderRateLimitRemaining, "0")
+			w.Header().Set(HTTPHeaderRateLimitReset, strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10))
+			writeJSON(w, http.StatusTooManyRequests, map[string]any{"title": "Too Many Requests"})
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+
+	t.Run("Test the queue is bounded", func(t *testing.T) {
+		store, _ := newStore[PublishJob]("")
+		q := newPublishQueue(c, store, newMediaStore(""), 1, 1, newLogger())
+
+		_, err := q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "one"})
+		assert.Nil(t, err)
+
+		_, err = q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "two"})
+		assert.IsType(t, &QueueFullError{}, err)
+		assert.Len(t, store.List(), 1)
+
+		_, err = q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText})
+		assert.IsType(t, &ValidationError{}, err)
+	})
+
+	t.Run("Test waiting jobs count against the bound", func(t *testing.T) {
+		// A rate-limited job waiting to be retried isn't in the channel, but will be queued again
+		store, _ := newStore[PublishJob]("")
+		store.Set("waiting", PublishJob{ID: "waiting", Status: PublishJobStatusQueued})
+		store.Set("finished", PublishJob{ID: "finished", Status: PublishJobStatusSucceeded, UpdatedAt: time.Now()})
+		q := newPublishQueue(c, store, newMediaStore(""), 2, 1, newLogger())
+
+		_, err := q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "one"})
+		assert.Nil(t, err)
+
+		_, err = q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "two"})
+		assert.IsType(t, &QueueFullError{}, err)
+		assert.Len(t, store.List(), 3)
+	})
+
+	t.Run("Test rate-limited jobs are retried", func(t *testing.T) {
+		store, _ := newStore[PublishJob]("")
+		q := newPublishQueue(c, store, newMediaStore(""), 10, 2, newLogger())
+		q.start()
+		defer q.close()
+
+		job, err := q.enqueue(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "rate limited"})
+		assert.Nil(t, err)
+		assert.Equal(t, PublishJobStatusQueued, job.Status)
+
+		assert.Eventually(t, func() bool {
+			job, _ := q.get(job.ID)
+			return job.NextAttemptAt != nil
+		}, time.Second, 10*time.Millisecond)
+
+		// The job waits for the cooldown of the rate-limited client, even though its reset time has already passed
+		job, err = q.get(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, PublishJobStatusQueued, job.Status)
+		assert.True(t, job.NextAttemptAt.After(time.Now().Add(defaultRateLimitCooldown-time.Minute)))
+
+		// End the cooldown early
+		alpha, _ := c.pool.getByUsername("alpha")
+		c.pool.mu.Lock()
+		alpha.rateLimits = nil
+		c.pool.mu.Unlock()
+		q.requeueAfter(job.ID, 0)
+
+		assert.Eventually(t, func() bool {
+			job, _ := q.get(job.ID)
+			return job.isFinished()
+		}, time.Second, 10*time.Millisecond)
+
+		job, err = q.get(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, PublishJobStatusSucceeded, job.Status)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Nil(t, job.Error)
+		assert.Equal(t, []string{"1000000000000000001"}, job.Result.TweetIDs())
+	})
+
+	t.Run("Test interrupted jobs are recovered", func(t *testing.T) {
+		store, _ := newStore[PublishJob]("")
+		store.Set("queued", PublishJob{ID: "queued", Status: PublishJobStatusQueued, Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "recovered"}})
+		store.Set("running", PublishJob{ID: "running", Status: PublishJobStatusRunning})
+
+		q := newPublishQueue(c, store, newMediaStore(""), 10, 1, newLogger())
+		q.start()
+		defer q.close()
+
+		assert.Eventually(t, func() bool {
+			job, _ := q.get("queued")
+			return job.Status == PublishJobStatusSucceeded
+		}, time.Second, 10*time.Millisecond)
+
+		job, _ := q.get("running")
+		assert.Equal(t, PublishJobStatusFailed, job.Status)
+	})
+}
+
+func TestPublishTweetAsync(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": "hello"},
+		})
+	}
+	api := newTestAPI(newTestTwitterClient(t, handler, "alpha"))
+	api.queue.start()
+	defer api.queue.close()
+
+	w := doTestRequest(api, http.MethodPost, "/api/tweet?async=true", PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"})
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	var resp struct {
+		Data PublishJob `json:"data"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	assert.NotEmpty(t, resp.Data.ID)
+
+	assert.Eventually(t, func() bool {
+		w := doTestRequest(api, http.MethodGet, "/api/jobs/"+resp.Data.ID, nil)
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp.Data.Status == PublishJobStatusSucceeded
+	}, time.Second, 10*time.Millisecond)
+
+	w = doTestRequest(api, http.MethodGet, "/api/jobs/missing", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
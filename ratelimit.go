@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/michimani/gotwi"
+)
+
+// The length of a Twitter API rate limit window,
+// used as the cooldown when a rate-limited response has no reset header
+const defaultRateLimitCooldown = 15 * time.Minute
+
+type TwitterEndpoint string
+
+const (
+	TwitterEndpointCreateTweet    TwitterEndpoint = "POST /2/tweets"
+	TwitterEndpointUserByUsername TwitterEndpoint = "GET /2/users/by/username/:username"
+	TwitterEndpointUserByID       TwitterEndpoint = "GET /2/users/:id"
+	TwitterEndpointUserMe         TwitterEndpoint = "GET /2/users/me"
+	TwitterEndpointUserTweets     TwitterEndpoint = "GET /2/users/:id/tweets"
+	TwitterEndpointDeleteTweet    TwitterEndpoint = "DELETE /2/tweets/:id"
+	TwitterEndpointTweetLookup    TwitterEndpoint = "GET /2/tweets/:id"
+	TwitterEndpointRetweet        TwitterEndpoint = "POST /2/users/:id/retweets"
+	TwitterEndpointUnretweet      TwitterEndpoint = "DELETE /2/users/:id/retweets/:source_tweet_id"
+	TwitterEndpointMediaUpload    TwitterEndpoint = "POST /1.1/media/upload.json"
+)
+
+type RateLimitState struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+func (s RateLimitState) inCooldown(now time.Time) bool {
+	return s.Remaining <= 0 && now.Before(s.ResetAt)
+}
+
+// rateLimitStateFromErr extracts the rate limit state from an error returned by gotwi.
+// The boolean return value reports whether the error was caused by a rate limit.
+func rateLimitStateFromErr(err error, now time.Time) (RateLimitState, bool) {
+	if err == nil {
+		return RateLimitState{}, false
+	}
+
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		if upstreamErr.StatusCode != http.StatusTooManyRequests {
+			return RateLimitState{}, false
+		}
+		if upstreamErr.RateLimit != nil {
+			return rateLimitedState(*upstreamErr.RateLimit, now), true
+		}
+		return rateLimitedState(RateLimitState{}, now), true
+	}
+
+	var gerr *gotwi.GotwiError
+	if errors.As(err, &gerr) && gerr.OnAPI {
+		if gerr.StatusCode != http.StatusTooManyRequests {
+			return RateLimitState{}, false
+		}
+
+		state := RateLimitState{}
+		if info := gerr.RateLimitInfo; info != nil {
+			state.Limit = info.Limit
+			if info.ResetAt != nil {
+				state.ResetAt = *info.ResetAt
+			}
+		}
+		return rateLimitedState(state, now), true
+	}
+
+	if isRateLimitErr(err) {
+		return rateLimitedState(RateLimitState{}, now), true
+	}
+
+	return RateLimitState{}, false
+}
+
+// rateLimitedState returns the state of a rate-limited response, which is always in cooldown for at least
+// defaultRateLimitCooldown, even if its headers report remaining requests or an earlier reset.
+func rateLimitedState(state RateLimitState, now time.Time) RateLimitState {
+	state.Remaining = 0
+	if minResetAt := now.Add(defaultRateLimitCooldown); state.ResetAt.Before(minResetAt) {
+		state.ResetAt = minResetAt
+	}
+	return state
+}
+
+// rateLimitStateFromHeader parses the x-rate-limit-* headers of a Twitter API response.
+func rateLimitStateFromHeader(h http.Header, now time.Time) *RateLimitState {
+	state := &RateLimitState{
+		ResetAt: now.Add(defaultRateLimitCooldown),
+	}
+
+	if limit, err := strconv.Atoi(h.Get(HTTPHeaderRateLimitLimit)); err == nil {
+		state.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(h.Get(HTTPHeaderRateLimitRemaining)); err == nil {
+		state.Remaining = remaining
+	}
+	if reset, err := strconv.ParseInt(h.Get(HTTPHeaderRateLimitReset), 10, 64); err == nil {
+		state.ResetAt = time.Unix(reset, 0)
+	}
+
+	return state
+}
+
+type RateLimitedError struct {
+	Endpoint TwitterEndpoint
+	Clients  int
+	ResetAt  time.Time
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf(
+		"all (%d) Twitter client(s) were rate-limited on (%s) until %s",
+		e.Clients,
+		e.Endpoint,
+		e.ResetAt.UTC().Format(time.RFC3339),
+	)
+}
+
+// RetryAfter reports how long the caller should wait before the earliest client is available again.
+func (e *RateLimitedError) RetryAfter(now time.Time) time.Duration {
+	d := e.ResetAt.Sub(now)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
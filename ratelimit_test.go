@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/michimani/gotwi"
+	"github.com/michimani/gotwi/resources"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Test rateLimitStateFromErr()", func(t *testing.T) {
+		soon := now.Add(time.Minute)
+		later := now.Add(time.Hour)
+
+		type RateLimitStateFromErrTest struct {
+			err         error
+			expected    RateLimitState
+			rateLimited bool
+		}
+
+		tests := []RateLimitStateFromErrTest{
+			// No error
+			{
+				err:         nil,
+				expected:    RateLimitState{},
+				rateLimited: false,
+			},
+
+			// Unrelated errors
+			{
+				err:         errors.New("connection refused"),
+				expected:    RateLimitState{},
+				rateLimited: false,
+			},
+			{
+				err: &gotwi.GotwiError{
+					OnAPI:       true,
+					Non2XXError: resources.Non2XXError{StatusCode: http.StatusForbidden},
+				},
+				expected:    RateLimitState{},
+				rateLimited: false,
+			},
+
+			// Rate limit errors without reset information
+			{
+				err: &gotwi.GotwiError{
+					OnAPI:       true,
+					Non2XXError: resources.Non2XXError{StatusCode: http.StatusTooManyRequests},
+				},
+				expected:    RateLimitState{ResetAt: now.Add(defaultRateLimitCooldown)},
+				rateLimited: true,
+			},
+			{
+				err:         errors.New("Rate limit exceeded"),
+				expected:    RateLimitState{ResetAt: now.Add(defaultRateLimitCooldown)},
+				rateLimited: true,
+			},
+
+			// Rate limit errors are in cooldown for at least defaultRateLimitCooldown, whatever their headers report
+			{
+				err: &UpstreamError{
+					StatusCode: http.StatusTooManyRequests,
+					RateLimit:  &RateLimitState{Limit: 50, Remaining: 10, ResetAt: soon},
+				},
+				expected:    RateLimitState{Limit: 50, ResetAt: now.Add(defaultRateLimitCooldown)},
+				rateLimited: true,
+			},
+			{
+				err: &UpstreamError{
+					StatusCode: http.StatusTooManyRequests,
+					RateLimit:  &RateLimitState{Limit: 50, Remaining: 10, ResetAt: later},
+				},
+				expected:    RateLimitState{Limit: 50, ResetAt: later},
+				rateLimited: true,
+			},
+		}
+
+		for _, test := range tests {
+			state, ok := rateLimitStateFromErr(test.err, now)
+			assert.Equal(t, test.expected, state)
+			assert.Equal(t, test.rateLimited, ok)
+		}
+	})
+
+	t.Run("Test doWithPool() cooldown", func(t *testing.T) {
+		pool := newClientPool([]*PoolClient{
+			{creds: TwitterAPICreds{Username: "a"}},
+			{creds: TwitterAPICreds{Username: "b"}},
+		}, ClientSelectionStrategyPriority)
+		c := &TwitterClient{pool: pool}
+
+		a, _ := pool.getByUsername("a")
+		resetAt := time.Now().Add(time.Hour)
+		pool.mu.Lock()
+		a.rateLimits = map[TwitterEndpoint]RateLimitState{
+			TwitterEndpointCreateTweet: {Limit: 100, Remaining: 0, ResetAt: resetAt},
+		}
+		pool.mu.Unlock()
+
+		var calls []string
+		var fn = func(pc *PoolClient) (string, error) {
+			calls = append(calls, pc.creds.Username)
+			return pc.creds.Username, nil
+		}
+
+		// Client "a" is skipped only for the endpoint it is cooling down on
+		username, err := doWithPool(c, TwitterEndpointCreateTweet, "", fn)
+		assert.Nil(t, err)
+		assert.Equal(t, "b", username)
+
+		username, err = doWithPool(c, TwitterEndpointUserByID, "", fn)
+		assert.Nil(t, err)
+		assert.Equal(t, "a", username)
+
+		// Requesting client "a" directly reports its reset time without calling the API
+		_, err = doWithPool(c, TwitterEndpointCreateTweet, "a", fn)
+		var rlErr *RateLimitedError
+		assert.True(t, errors.As(err, &rlErr))
+		assert.Equal(t, resetAt, rlErr.ResetAt)
+		assert.Equal(t, []string{"b", "a"}, calls)
+
+		// When every client is rate-limited, the earliest reset time is reported
+		_, err = doWithPool(c, TwitterEndpointCreateTweet, "", func(pc *PoolClient) (string, error) {
+			return "", errors.New("rate limit exceeded")
+		})
+		assert.True(t, errors.As(err, &rlErr))
+		assert.True(t, rlErr.ResetAt.Before(resetAt))
+		assert.Equal(t, 2, rlErr.Clients)
+	})
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	// Embeds the timezone database, so job timezones work on hosts without one installed
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// The number of runs kept in the history of each recurring job
+const maxRecurringJobRuns = 100
+
+// RecurringJobOpts is the definition of a recurring job, as sent to the create and update endpoints.
+type RecurringJobOpts struct {
+	Name     string           `json:"name"`
+	Cron     string           `json:"cron"`
+	Timezone string           `json:"timezone"`
+	Username string           `json:"username"`
+	Opts     PublishTweetOpts `json:"opts"`
+	Enabled  *bool            `json:"enabled"`
+}
+
+// RecurringJob publishes its opts every time its cron expression matches, in its timezone.
+type RecurringJob struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name"`
+	Cron      string           `json:"cron"`
+	Timezone  string           `json:"timezone"`
+	Username  string           `json:"username"`
+	Opts      PublishTweetOpts `json:"opts"`
+	Enabled   bool             `json:"enabled"`
+	NextRunAt *time.Time       `json:"nextRunAt,omitempty"`
+	LastRunAt *time.Time       `json:"lastRunAt,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+}
+
+// next returns the first time after t that the job should run.
+func (j RecurringJob) next(t time.Time) (time.Time, error) {
+	schedule, err := cron.ParseStandard(j.Cron)
+	if err != nil {
+		return time.Time{}, newValidationErr("invalid cron expression (%s): %s", j.Cron, err.Error())
+	}
+
+	loc, err := time.LoadLocation(j.Timezone)
+	if err != nil {
+		return time.Time{}, newValidationErr("invalid timezone (%s)", j.Timezone)
+	}
+
+	return schedule.Next(t.In(loc)), nil
+}
+
+// RecurringJobRun is the history entry of a single run of a recurring job.
+type RecurringJobRun struct {
+	ID         string    `json:"id"`
+	JobID      string    `json:"jobID"`
+	Success    bool      `json:"success"`
+	Skipped    string    `json:"skipped,omitempty"`
+	Texts      []string  `json:"texts,omitempty"`
+	TweetIDs   []string  `json:"tweetIDs,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// RecurringJobRunner runs recurring jobs when they are due.
+// Jobs and their run history are persisted in its stores, so they survive restarts.
+type RecurringJobRunner struct {
+	client *TwitterClient
+	jobs   *Store[RecurringJob]
+	runs   *Store[RecurringJobRun]
+	media  *MediaStore
+	mu     sync.Mutex
+	*dueRunner
+	*Logger
+}
+
+func newRecurringJobRunner(client *TwitterClient, jobs *Store[RecurringJob], runs *Store[RecurringJobRun], media *MediaStore, logger *Logger) *RecurringJobRunner {
+	r := &RecurringJobRunner{
+		client: client,
+		jobs:   jobs,
+		runs:   runs,
+		media:  media,
+		Logger: logger,
+	}
+	r.dueRunner = newDueRunner(r.runDue, r.nextRunAt)
+	return r
+}
+
+// start runs the recurring jobs in the background until close is called.
+// Runs that were missed while the service was stopped are skipped rather than caught up on.
+func (r *RecurringJobRunner) start() {
+	now := time.Now()
+	for _, job := range r.jobs.List() {
+		if !job.Enabled || job.NextRunAt == nil || job.NextRunAt.After(now) {
+			continue
+		}
+		r.jobs.Update(job.ID, func(job RecurringJob) (RecurringJob, error) {
+			next, err := job.next(now)
+			if err != nil {
+				return job, err
+			}
+			job.NextRunAt = &next
+			return job, nil
+		})
+	}
+
+	r.dueRunner.start()
+}
+
+func (r *RecurringJobRunner) nextRunAt() (time.Time, bool) {
+	var next time.Time
+	for _, job := range r.jobs.List() {
+		if job.Enabled && job.NextRunAt != nil && (next.IsZero() || job.NextRunAt.Before(next)) {
+			next = *job.NextRunAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// runDue runs every enabled job whose next run is not after now, and schedules its following run.
+func (r *RecurringJobRunner) runDue(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, job := range r.jobs.List() {
+		if !job.Enabled || job.NextRunAt == nil || job.NextRunAt.After(now) {
+			continue
+		}
+
+		_, err := r.jobs.Update(job.ID, func(job RecurringJob) (RecurringJob, error) {
+			next, err := job.next(now)
+			if err != nil {
+				return job, err
+			}
+			job.NextRunAt = &next
+			return job, nil
+		})
+		if err != nil {
+			r.LogErr(err)
+			continue
+		}
+
+		r.execute(job)
+	}
+}
+
+// execute publishes the job's opts, and records the run in the job's history.
+func (r *RecurringJobRunner) execute(job RecurringJob) RecurringJobRun {
+	r.Infof("Running recurring job (%s)\n", job.ID)
+
+	opts := job.Opts
+	if job.Username != "" {
+		opts.Username = job.Username
+	}
+
+	run := RecurringJobRun{
+		ID:        newID(),
+		JobID:     job.ID,
+		StartedAt: time.Now(),
+	}
+
+	var (
+		result   *PublishTweetResult
+		rendered *RenderedTweet
+	)
+	opts, err := r.media.resolve(opts)
+	if err == nil {
+		rendered, err = opts.render(r.client.fetcher)
+	}
+	if err == nil {
+		run.Texts = rendered.Texts
+
+		result, err = r.client.publishRendered(opts.Username, rendered)
+		if result != nil {
+			run.Username = result.Username
+			run.TweetIDs = result.TweetIDs()
+			run.Skipped = result.Skipped
+		}
+	}
+
+	r.client.notifyPublished(opts.CallbackUrl, result, err)
+	run.FinishedAt = time.Now()
+	run.Success = err == nil
+	if err != nil {
+		run.Error = err.Error()
+		r.Errorf("error running recurring job (%s): %s\n", job.ID, err.Error())
+	}
+
+	r.recordRun(run)
+	r.jobs.Update(job.ID, func(job RecurringJob) (RecurringJob, error) {
+		job.LastRunAt = &run.StartedAt
+		return job, nil
+	})
+
+	return run
+}
+
+// recordRun stores the run, and removes the oldest runs of the job beyond maxRecurringJobRuns.
+func (r *RecurringJobRunner) recordRun(run RecurringJobRun) {
+	if err := r.runs.Set(run.ID, run); err != nil {
+		r.LogErr(fmt.Errorf("error recording run of recurring job (%s): %w", run.JobID, err))
+		return
+	}
+
+	runs := r.listRuns(run.JobID)
+	if len(runs) <= maxRecurringJobRuns {
+		return
+	}
+
+	stale := map[string]bool{}
+	for _, old := range runs[maxRecurringJobRuns:] {
+		stale[old.ID] = true
+	}
+	r.LogErr(r.runs.DeleteFunc(func(id string, _ RecurringJobRun) bool {
+		return stale[id]
+	}))
+}
+
+// newJob validates the definition of a recurring job, and applies it to job.
+func (r *RecurringJobRunner) newJob(job RecurringJob, jobOpts RecurringJobOpts, now time.Time) (RecurringJob, error) {
+	if jobOpts.Cron == "" {
+		return job, newValidationErr("cron is required")
+	}
+	if jobOpts.Opts.PublishAt != nil {
+		return job, newValidationErr("publishAt cannot be used in a recurring job")
+	}
+
+	job.Name = jobOpts.Name
+	job.Cron = jobOpts.Cron
+	job.Timezone = jobOpts.Timezone
+	job.Username = jobOpts.Username
+	job.Opts = jobOpts.Opts
+	job.Enabled = jobOpts.Enabled == nil || *jobOpts.Enabled
+	job.UpdatedAt = now
+
+	if job.Username != "" {
+		if _, ok := r.client.pool.getByUsername(job.Username); !ok {
+			return job, &NotFoundInPoolError{Username: job.Username}
+		}
+	}
+
+	next, err := job.next(now)
+	if err != nil {
+		return job, err
+	}
+	job.NextRunAt = &next
+
+	job.Opts, err = jobOpts.Opts.prepare(r.client.fetcher, r.media)
+	return job, err
+}
+
+func (r *RecurringJobRunner) create(jobOpts RecurringJobOpts) (RecurringJob, error) {
+	now := time.Now()
+	job, err := r.newJob(RecurringJob{ID: newID(), CreatedAt: now}, jobOpts, now)
+	if err != nil {
+		return RecurringJob{}, err
+	}
+
+	if err := r.jobs.Set(job.ID, job); err != nil {
+		return RecurringJob{}, err
+	}
+
+	r.notify()
+	return job, nil
+}
+
+func (r *RecurringJobRunner) update(id string, jobOpts RecurringJobOpts) (RecurringJob, error) {
+	existing, err := r.get(id)
+	if err != nil {
+		return RecurringJob{}, err
+	}
+
+	updated, err := r.newJob(existing, jobOpts, time.Now())
+	if err != nil {
+		return RecurringJob{}, err
+	}
+
+	ok, err := r.jobs.Update(id, func(job RecurringJob) (RecurringJob, error) {
+		// The job may have run while the update was being validated
+		updated.LastRunAt = job.LastRunAt
+		return updated, nil
+	})
+	if !ok {
+		return RecurringJob{}, &NotFoundError{Resource: "recurring job", ID: id}
+	}
+	if err != nil {
+		return RecurringJob{}, err
+	}
+
+	r.notify()
+	return updated, nil
+}
+
+// delete removes the job and its run history.
+func (r *RecurringJobRunner) delete(id string) error {
+	ok, err := r.jobs.Delete(id)
+	if !ok {
+		return &NotFoundError{Resource: "recurring job", ID: id}
+	}
+	if err != nil {
+		return err
+	}
+
+	r.notify()
+	return r.runs.DeleteFunc(func(_ string, run RecurringJobRun) bool {
+		return run.JobID == id
+	})
+}
+
+// runNow runs the job immediately, without changing when it next runs.
+func (r *RecurringJobRunner) runNow(id string) (RecurringJobRun, error) {
+	job, err := r.get(id)
+	if err != nil {
+		return RecurringJobRun{}, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.execute(job), nil
+}
+
+func (r *RecurringJobRunner) get(id string) (RecurringJob, error) {
+	job, ok := r.jobs.Get(id)
+	if !ok {
+		return RecurringJob{}, &NotFoundError{Resource: "recurring job", ID: id}
+	}
+	return job, nil
+}
+
+func (r *RecurringJobRunner) list() []RecurringJob {
+	jobs := r.jobs.List()
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// listRuns returns the run history of a job, most recent first.
+func (r *RecurringJobRunner) listRuns(jobID string) []RecurringJobRun {
+	runs := []RecurringJobRun{}
+	for _, run := range r.runs.List() {
+		if run.JobID == jobID {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartedAt.After(runs[j].StartedAt)
+	})
+	return runs
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecurringJobNext(t *testing.T) {
+	job := RecurringJob{Cron: "0 9 * * *", Timezone: "America/New_York"}
+
+	next, err := job.next(time.Date(2024, time.July, 1, 12, 0, 0, 0, time.UTC))
+	assert.Nil(t, err)
+	// 9:00 in New York is 13:00 UTC during daylight saving time
+	assert.Equal(t, time.Date(2024, time.July, 1, 13, 0, 0, 0, time.UTC), next.UTC())
+
+	_, err = RecurringJob{Cron: "every morning"}.next(time.Now())
+	assert.IsType(t, &ValidationError{}, err)
+
+	_, err = RecurringJob{Cron: "0 9 * * *", Timezone: "Mars/Olympus_Mons"}.next(time.Now())
+	assert.IsType(t, &ValidationError{}, err)
+}
+
+func TestRecurringJobRunner(t *testing.T) {
+	headline := "First headline"
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"headline": headline})
+	}))
+	defer feed.Close()
+
+	published := map[string]string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/tweets" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+			return
+		}
+
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		if *in.Text == "Second headline" {
+			writeJSON(w, http.StatusForbidden, map[string]any{"title": "Forbidden", "detail": "duplicate content"})
+			return
+		}
+
+		published[*in.Text] = r.Header.Get("X-Test-Username")
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha", "bravo")
+	allowPrivateFetches(c)
+	jobs, _ := newStore[RecurringJob]("")
+	runs, _ := newStore[RecurringJobRun]("")
+	r := newRecurringJobRunner(c, jobs, runs, newMediaStore(""), newLogger())
+
+	t.Run("Test create() validates the job", func(t *testing.T) {
+		invalid := []RecurringJobOpts{
+			{Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeFetchJson, Url: feed.URL}},
+			{Cron: "@daily", Username: "charlie", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeFetchJson, Url: feed.URL}},
+			{Cron: "@daily", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeText}},
+			{Cron: "@daily", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hi", PublishAt: &time.Time{}}},
+		}
+		for _, jobOpts := range invalid {
+			_, err := r.create(jobOpts)
+			assert.NotNil(t, err)
+		}
+		assert.Empty(t, r.list())
+	})
+
+	job, err := r.create(RecurringJobOpts{
+		Name:     "Morning headline",
+		Cron:     "0 9 * * *",
+		Timezone: "Europe/London",
+		Username: "bravo",
+		Opts: PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL,
+			Text:             "{*{ headline }*}",
+		},
+	})
+	assert.Nil(t, err)
+	assert.True(t, job.Enabled)
+	assert.NotNil(t, job.NextRunAt)
+
+	t.Run("Test runDue()", func(t *testing.T) {
+		r.runDue(job.NextRunAt.Add(-time.Second))
+		assert.Empty(t, r.listRuns(job.ID))
+
+		r.runDue(*job.NextRunAt)
+		assert.Equal(t, map[string]string{"First headline": "bravo"}, published)
+
+		runs := r.listRuns(job.ID)
+		assert.Len(t, runs, 1)
+		assert.True(t, runs[0].Success)
+		assert.Equal(t, []string{"First headline"}, runs[0].Texts)
+		assert.Equal(t, []string{"1000000000000000001"}, runs[0].TweetIDs)
+
+		updated, err := r.get(job.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, job.NextRunAt.Add(24*time.Hour), *updated.NextRunAt)
+		assert.NotNil(t, updated.LastRunAt)
+	})
+
+	t.Run("Test failed runs are recorded", func(t *testing.T) {
+		headline = "Second headline"
+		run, err := r.runNow(job.ID)
+		assert.Nil(t, err)
+		assert.False(t, run.Success)
+		assert.Equal(t, []string{"Second headline"}, run.Texts)
+		assert.Contains(t, run.Error, "duplicate content")
+
+		runs := r.listRuns(job.ID)
+		assert.Len(t, runs, 2)
+		assert.Equal(t, run.ID, runs[0].ID)
+	})
+
+	t.Run("Test update() and delete()", func(t *testing.T) {
+		enabled := false
+		updated, err := r.update(job.ID, RecurringJobOpts{
+			Cron:    "*/5 * * * *",
+			Enabled: &enabled,
+			Opts:    job.Opts,
+		})
+		assert.Nil(t, err)
+		assert.False(t, updated.Enabled)
+		assert.Equal(t, "", updated.Username)
+
+		_, err = r.update("missing", RecurringJobOpts{Cron: "@daily"})
+		assert.IsType(t, &NotFoundError{}, err)
+
+		assert.Nil(t, r.delete(job.ID))
+		assert.Empty(t, r.listRuns(job.ID))
+		assert.IsType(t, &NotFoundError{}, r.delete(job.ID))
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/michimani/gotwi"
+	"github.com/michimani/gotwi/tweet/retweet"
+	retweetTypes "github.com/michimani/gotwi/tweet/retweet/types"
+	"github.com/michimani/gotwi/user/userlookup"
+	userlookupTypes "github.com/michimani/gotwi/user/userlookup/types"
+)
+
+// getAuthedUserID returns the user ID of the account the client is authenticated as,
+// looking it up the first time it is needed.
+func (c *TwitterClient) getAuthedUserID(pc *PoolClient) (string, error) {
+	c.pool.mu.Lock()
+	userID := pc.userID
+	c.pool.mu.Unlock()
+
+	if userID != "" {
+		return userID, nil
+	}
+
+	output, err := userlookup.GetMe(context.Background(), pc.client, &userlookupTypes.GetMeInput{})
+	if err != nil {
+		return "", err
+	}
+	userID = gotwi.StringValue(output.Data.ID)
+
+	c.pool.mu.Lock()
+	pc.userID = userID
+	c.pool.mu.Unlock()
+
+	return userID, nil
+}
+
+func (c *TwitterClient) retweet(username, tweetID string) (*PublishTweetResult, error) {
+	var usedUsername string
+	output, err := doWithPool(c, TwitterEndpointRetweet, username, func(pc *PoolClient) (*retweetTypes.CreateOutput, error) {
+		usedUsername = pc.creds.Username
+
+		userID, err := c.getAuthedUserID(pc)
+		if err != nil {
+			return nil, err
+		}
+
+		return retweet.Create(context.Background(), pc.client, &retweetTypes.CreateInput{
+			ID:      userID,
+			TweetID: tweetID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error retweeting tweet ( %s ): %w", tweetID, err)
+	}
+
+	return &PublishTweetResult{
+		Username:  usedUsername,
+		Retweeted: gotwi.Bool(output.Data.Retweeted),
+		TweetID:   tweetID,
+	}, nil
+}
+
+func (c *TwitterClient) unretweet(username, tweetID string) (*PublishTweetResult, error) {
+	var usedUsername string
+	output, err := doWithPool(c, TwitterEndpointUnretweet, username, func(pc *PoolClient) (*retweetTypes.DeleteOutput, error) {
+		usedUsername = pc.creds.Username
+
+		userID, err := c.getAuthedUserID(pc)
+		if err != nil {
+			return nil, err
+		}
+
+		return retweet.Delete(context.Background(), pc.client, &retweetTypes.DeleteInput{
+			ID:            userID,
+			SourceTweetID: tweetID,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error unretweeting tweet ( %s ): %w", tweetID, err)
+	}
+
+	return &PublishTweetResult{
+		Username:  usedUsername,
+		Retweeted: gotwi.Bool(output.Data.Retweeted),
+		TweetID:   tweetID,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetweetAndQuote(t *testing.T) {
+	var (
+		meLookups   = 0
+		requests    = []string{}
+		quoteTweets = []string{}
+	)
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch {
+		case r.URL.Path == "/2/users/me":
+			meLookups++
+			writeJSON(w, http.StatusOK, map[string]any{
+				"data": map[string]string{"id": "555", "username": "alpha"},
+			})
+		case r.URL.Path == "/2/users/555/retweets":
+			writeJSON(w, http.StatusOK, map[string]any{"data": map[string]bool{"retweeted": true}})
+		case r.URL.Path == "/2/users/555/retweets/1234567890123456789":
+			writeJSON(w, http.StatusOK, map[string]any{"data": map[string]bool{"retweeted": false}})
+		case r.URL.Path == "/2/tweets":
+			var in managetweetTypes.CreateInput
+			json.NewDecoder(r.Body).Decode(&in)
+			quoteTweets = append(quoteTweets, *in.QuoteTweetID)
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+			})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+
+	t.Run("Test retweet", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			result, err := c.publishTweet(PublishTweetOpts{
+				PublishTweetType: PublishTweetTypeRetweet,
+				TargetTweet:      "https://twitter.com/user/status/1234567890123456789",
+			})
+			assert.Nil(t, err)
+			assert.True(t, *result.Retweeted)
+			assert.Equal(t, "1234567890123456789", result.TweetID)
+			assert.Equal(t, "alpha", result.Username)
+		}
+
+		// The authenticated user ID is only looked up once per client
+		assert.Equal(t, 1, meLookups)
+	})
+
+	t.Run("Test unretweet", func(t *testing.T) {
+		// The account that retweeted must be given
+		_, err := c.publishTweet(PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeUnretweet,
+			TargetTweet:      "1234567890123456789",
+		})
+		assert.IsType(t, &ValidationError{}, err)
+
+		result, err := c.publishTweet(PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeUnretweet,
+			TargetTweet:      "1234567890123456789",
+			Username:         "alpha",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, "alpha", result.Username)
+		assert.False(t, *result.Retweeted)
+		assert.Equal(t, "DELETE /2/users/555/retweets/1234567890123456789", requests[len(requests)-1])
+	})
+
+	t.Run("Test quote", func(t *testing.T) {
+		result, err := c.publishTweet(PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeQuote,
+			Text:             "look at this",
+			TargetTweet:      "https://x.com/user/status/1234567890123456789?s=20",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"1000000000000000001"}, result.TweetIDs())
+		assert.Equal(t, []string{"1234567890123456789"}, quoteTweets)
+	})
+
+	t.Run("Test invalid target tweet", func(t *testing.T) {
+		for _, publishTweetType := range []PublishTweetType{PublishTweetTypeQuote, PublishTweetTypeRetweet, PublishTweetTypeUnretweet} {
+			_, err := c.publishTweet(PublishTweetOpts{
+				PublishTweetType: publishTweetType,
+				Text:             "look at this",
+				TargetTweet:      "https://twitter.com/user/status/abc",
+			})
+			var validationErr *ValidationError
+			assert.ErrorAs(t, err, &validationErr)
+
+			_, err = c.publishTweet(PublishTweetOpts{
+				PublishTweetType: publishTweetType,
+				Text:             "look at this",
+				Username:         "alpha",
+			})
+			assert.ErrorAs(t, err, &validationErr)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// dueRunner calls run whenever the earliest item of a component is due, as reported by next,
+// and whenever it is notified that the items changed. It runs the scheduler and the recurring jobs.
+type dueRunner struct {
+	run  func(now time.Time)
+	next func() (time.Time, bool)
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newDueRunner(run func(now time.Time), next func() (time.Time, bool)) *dueRunner {
+	return &dueRunner{
+		run:  run,
+		next: next,
+		wake: make(chan struct{}, 1),
+		stop: make(chan struct{}),
+	}
+}
+
+// start runs the due items in the background until close is called.
+func (d *dueRunner) start() {
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// close stops the runner, and waits for the items being run to finish.
+func (d *dueRunner) close() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// notify wakes the runner up to run the items that are due, and to recompute when the next item is due.
+func (d *dueRunner) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (d *dueRunner) loop() {
+	defer d.wg.Done()
+
+	for {
+		d.run(time.Now())
+
+		var (
+			timer  *time.Timer
+			timerC <-chan time.Time
+		)
+		if next, ok := d.next(); ok {
+			timer = time.NewTimer(time.Until(next))
+			timerC = timer.C
+		}
+
+		select {
+		case <-timerC:
+		case <-d.wake:
+		case <-d.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
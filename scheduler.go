@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// How long finished scheduled tweets can be looked up before they are removed
+const scheduledTweetRetention = 7 * 24 * time.Hour
+
+type ScheduledTweetStatus string
+
+const (
+	ScheduledTweetStatusPending   ScheduledTweetStatus = "pending"
+	ScheduledTweetStatusRunning   ScheduledTweetStatus = "running"
+	ScheduledTweetStatusPublished ScheduledTweetStatus = "published"
+	ScheduledTweetStatusSkipped   ScheduledTweetStatus = "skipped"
+	ScheduledTweetStatusFailed    ScheduledTweetStatus = "failed"
+	ScheduledTweetStatusCancelled ScheduledTweetStatus = "cancelled"
+)
+
+type ScheduledTweet struct {
+	ID        string               `json:"id"`
+	Opts      PublishTweetOpts     `json:"opts"`
+	PublishAt time.Time            `json:"publishAt"`
+	Status    ScheduledTweetStatus `json:"status"`
+	Result    *PublishTweetResult  `json:"result,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	CreatedAt time.Time            `json:"createdAt"`
+	UpdatedAt time.Time            `json:"updatedAt"`
+}
+
+func (st ScheduledTweet) isFinished() bool {
+	return st.Status != ScheduledTweetStatusPending && st.Status != ScheduledTweetStatusRunning
+}
+
+// Scheduler publishes scheduled tweets at their publishAt time.
+// Scheduled tweets are persisted in its store, so they survive restarts.
+type Scheduler struct {
+	client *TwitterClient
+	store  *Store[ScheduledTweet]
+	media  *MediaStore
+	mu     sync.Mutex
+	*dueRunner
+	*Logger
+}
+
+func newScheduler(client *TwitterClient, store *Store[ScheduledTweet], media *MediaStore, logger *Logger) *Scheduler {
+	s := &Scheduler{
+		client: client,
+		store:  store,
+		media:  media,
+		Logger: logger,
+	}
+	s.dueRunner = newDueRunner(s.runDue, s.nextPublishAt)
+	return s
+}
+
+// start recovers from any previous shutdown, and runs the scheduler in the background until close is called.
+func (s *Scheduler) start() {
+	for _, st := range s.store.List() {
+		if st.Status != ScheduledTweetStatusRunning {
+			continue
+		}
+		s.store.Update(st.ID, func(st ScheduledTweet) (ScheduledTweet, error) {
+			st.Status = ScheduledTweetStatusFailed
+			st.Error = errInterruptedPublish.Error()
+			st.UpdatedAt = time.Now()
+			return st, nil
+		})
+	}
+
+	s.dueRunner.start()
+}
+
+func (s *Scheduler) nextPublishAt() (time.Time, bool) {
+	var next time.Time
+	for _, st := range s.store.List() {
+		if st.Status == ScheduledTweetStatusPending && (next.IsZero() || st.PublishAt.Before(next)) {
+			next = st.PublishAt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// runDue publishes every pending tweet whose publishAt time is not after now,
+// and removes the finished tweets older than scheduledTweetRetention.
+func (s *Scheduler) runDue(now time.Time) {
+	for _, st := range s.takeDue(now) {
+		s.execute(st)
+	}
+}
+
+// takeDue marks the pending tweets whose publishAt time is not after now as running, and returns them in publishAt order.
+// The tweets are published after the lock is released, so that a slow publish doesn't block the others.
+func (s *Scheduler) takeDue(now time.Time) []ScheduledTweet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.LogErr(s.store.DeleteFunc(func(_ string, st ScheduledTweet) bool {
+		return st.isFinished() && now.Sub(st.UpdatedAt) >= scheduledTweetRetention
+	}))
+
+	due := []ScheduledTweet{}
+	for _, st := range s.store.List() {
+		if st.Status != ScheduledTweetStatusPending || st.PublishAt.After(now) {
+			continue
+		}
+
+		// The tweet is only taken if it is still pending, since it may have been cancelled since it was listed
+		ok, err := s.store.Update(st.ID, func(taken ScheduledTweet) (ScheduledTweet, error) {
+			if taken.Status != ScheduledTweetStatusPending {
+				return taken, newConflictErr("scheduled tweet (%s) is no longer pending", taken.ID)
+			}
+			taken.Status = ScheduledTweetStatusRunning
+			taken.UpdatedAt = time.Now()
+			st = taken
+			return taken, nil
+		})
+		if !ok || errors.As(err, new(*ConflictError)) {
+			continue
+		}
+		if err != nil {
+			s.LogErr(err)
+			continue
+		}
+		due = append(due, st)
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].PublishAt.Before(due[j].PublishAt)
+	})
+	return due
+}
+
+// execute publishes a tweet taken by takeDue.
+func (s *Scheduler) execute(st ScheduledTweet) {
+	id, opts := st.ID, st.Opts
+
+	s.Infof("Publishing scheduled Tweet (%s)\n", id)
+	var result *PublishTweetResult
+	opts, publishErr := s.media.resolve(opts)
+	if publishErr == nil {
+		result, publishErr = s.client.publishTweet(opts)
+	}
+	s.client.notifyPublished(opts.CallbackUrl, result, publishErr)
+
+	_, err := s.store.Update(id, func(st ScheduledTweet) (ScheduledTweet, error) {
+		st.Result = result
+		st.UpdatedAt = time.Now()
+		switch {
+		case publishErr != nil:
+			st.Status = ScheduledTweetStatusFailed
+			st.Error = publishErr.Error()
+		case result.Skipped != "":
+			st.Status = ScheduledTweetStatusSkipped
+		default:
+			st.Status = ScheduledTweetStatusPublished
+		}
+		return st, nil
+	})
+	s.LogErr(err)
+
+	if publishErr != nil {
+		s.Errorf("error publishing scheduled Tweet (%s): %s\n", id, publishErr.Error())
+		return
+	}
+	s.Infof("Published scheduled Tweet (%s): %s\n", id, result.String())
+}
+
+// schedule stores opts to be published at its publishAt time.
+func (s *Scheduler) schedule(opts PublishTweetOpts) (ScheduledTweet, error) {
+	if opts.PublishAt == nil {
+		return ScheduledTweet{}, newValidationErr("publishAt is required to schedule a tweet")
+	}
+
+	publishAt := *opts.PublishAt
+	opts.PublishAt = nil
+	opts, err := opts.prepare(s.client.fetcher, s.media)
+	if err != nil {
+		return ScheduledTweet{}, err
+	}
+
+	now := time.Now()
+	st := ScheduledTweet{
+		ID:        newID(),
+		Opts:      opts,
+		PublishAt: publishAt,
+		Status:    ScheduledTweetStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.store.Set(st.ID, st); err != nil {
+		return ScheduledTweet{}, err
+	}
+
+	s.notify()
+	return st, nil
+}
+
+func (s *Scheduler) list(status ScheduledTweetStatus) []ScheduledTweet {
+	all := s.store.List()
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].PublishAt.Before(all[j].PublishAt)
+	})
+
+	if status == "" {
+		return all
+	}
+
+	filtered := []ScheduledTweet{}
+	for _, st := range all {
+		if st.Status == status {
+			filtered = append(filtered, st)
+		}
+	}
+	return filtered
+}
+
+func (s *Scheduler) get(id string) (ScheduledTweet, error) {
+	st, ok := s.store.Get(id)
+	if !ok {
+		return ScheduledTweet{}, &NotFoundError{Resource: "scheduled tweet", ID: id}
+	}
+	return st, nil
+}
+
+// updatePending applies fn to a scheduled tweet that hasn't been published yet.
+func (s *Scheduler) updatePending(id string, fn func(st *ScheduledTweet)) (ScheduledTweet, error) {
+	var updated ScheduledTweet
+	ok, err := s.store.Update(id, func(st ScheduledTweet) (ScheduledTweet, error) {
+		if st.Status != ScheduledTweetStatusPending {
+			return st, newConflictErr("scheduled tweet (%s) is (%s), and can no longer be changed", id, st.Status)
+		}
+		fn(&st)
+		st.UpdatedAt = time.Now()
+		updated = st
+		return st, nil
+	})
+	if !ok {
+		return ScheduledTweet{}, &NotFoundError{Resource: "scheduled tweet", ID: id}
+	}
+	if err != nil {
+		return ScheduledTweet{}, err
+	}
+
+	s.notify()
+	return updated, nil
+}
+
+func (s *Scheduler) cancel(id string) (ScheduledTweet, error) {
+	return s.updatePending(id, func(st *ScheduledTweet) {
+		st.Status = ScheduledTweetStatusCancelled
+	})
+}
+
+func (s *Scheduler) reschedule(id string, publishAt time.Time) (ScheduledTweet, error) {
+	if publishAt.IsZero() {
+		return ScheduledTweet{}, newValidationErr("publishAt is required to reschedule a tweet")
+	}
+
+	return s.updatePending(id, func(st *ScheduledTweet) {
+		st.PublishAt = publishAt
+	})
+}
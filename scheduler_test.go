@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	published := []string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/tweets" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+			return
+		}
+
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		published = append(published, *in.Text)
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha")
+	path := filepath.Join(t.TempDir(), "scheduled_tweets.json")
+	store, err := newStore[ScheduledTweet](path)
+	assert.Nil(t, err)
+	s := newScheduler(c, store, newMediaStore(""), newLogger())
+
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	t.Run("Test schedule() validates the tweet", func(t *testing.T) {
+		_, err := s.schedule(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, PublishAt: at(time.Hour)})
+		assert.NotNil(t, err)
+
+		_, err = s.schedule(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hello"})
+		assert.NotNil(t, err)
+	})
+
+	first, err := s.schedule(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "first", PublishAt: at(time.Minute)})
+	assert.Nil(t, err)
+	second, err := s.schedule(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "second", PublishAt: at(time.Hour)})
+	assert.Nil(t, err)
+	third, err := s.schedule(PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "third", PublishAt: at(2 * time.Hour)})
+	assert.Nil(t, err)
+
+	t.Run("Test runDue()", func(t *testing.T) {
+		s.runDue(now)
+		assert.Empty(t, published)
+
+		s.runDue(now.Add(time.Minute))
+		assert.Equal(t, []string{"first"}, published)
+
+		st, err := s.get(first.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, ScheduledTweetStatusPublished, st.Status)
+		assert.Equal(t, "alpha", st.Result.Username)
+	})
+
+	t.Run("Test cancel() and reschedule()", func(t *testing.T) {
+		_, err := s.cancel(first.ID)
+		assert.IsType(t, &ConflictError{}, err)
+
+		_, err = s.cancel("missing")
+		assert.IsType(t, &NotFoundError{}, err)
+
+		st, err := s.cancel(second.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, ScheduledTweetStatusCancelled, st.Status)
+
+		st, err = s.reschedule(third.ID, now.Add(30*time.Minute))
+		assert.Nil(t, err)
+		assert.Equal(t, ScheduledTweetStatusPending, st.Status)
+
+		assert.Equal(t, []ScheduledTweet{st}, s.list(ScheduledTweetStatusPending))
+	})
+
+	t.Run("Test scheduled tweets survive a restart", func(t *testing.T) {
+		store.Update(third.ID, func(st ScheduledTweet) (ScheduledTweet, error) {
+			st.Status = ScheduledTweetStatusRunning
+			return st, nil
+		})
+
+		reloaded, err := newStore[ScheduledTweet](path)
+		assert.Nil(t, err)
+		assert.Len(t, reloaded.List(), 3)
+
+		restarted := newScheduler(c, reloaded, newMediaStore(""), newLogger())
+		restarted.start()
+		defer restarted.close()
+
+		// A tweet interrupted while publishing is not retried
+		st, err := restarted.get(third.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, ScheduledTweetStatusFailed, st.Status)
+	})
+
+	t.Run("Test finished tweets are removed after scheduledTweetRetention", func(t *testing.T) {
+		s.runDue(time.Now().Add(scheduledTweetRetention - time.Minute))
+		assert.Len(t, s.list(""), 3)
+
+		s.runDue(time.Now().Add(scheduledTweetRetention + time.Minute))
+		_, err := s.get(first.ID)
+		assert.IsType(t, &NotFoundError{}, err)
+		_, err = s.get(second.ID)
+		assert.IsType(t, &NotFoundError{}, err)
+
+		// A tweet that is still running is kept
+		st, err := s.get(third.ID)
+		assert.Nil(t, err)
+		assert.Equal(t, ScheduledTweetStatusRunning, st.Status)
+	})
+}
+
+func TestScheduledTweetAPI(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": "now"},
+		})
+	}
+	api := newTestAPI(newTestTwitterClient(t, handler, "alpha"))
+
+	t.Run("Test publishAt in the future is scheduled", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet", map[string]any{
+			"publishTweetType": PublishTweetTypeText,
+			"text":             "later",
+			"publishAt":        time.Now().Add(time.Hour),
+		})
+		assert.Equal(t, http.StatusAccepted, w.Code)
+
+		var resp struct {
+			Data ScheduledTweet `json:"data"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		assert.Equal(t, ScheduledTweetStatusPending, resp.Data.Status)
+		assert.Nil(t, resp.Data.Opts.PublishAt)
+
+		w = doTestRequest(api, http.MethodGet, "/api/scheduled/"+resp.Data.ID, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = doTestRequest(api, http.MethodPatch, "/api/scheduled/"+resp.Data.ID, map[string]any{
+			"publishAt": time.Now().Add(2 * time.Hour),
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = doTestRequest(api, http.MethodDelete, "/api/scheduled/"+resp.Data.ID, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = doTestRequest(api, http.MethodDelete, "/api/scheduled/"+resp.Data.ID, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = doTestRequest(api, http.MethodGet, "/api/scheduled/missing", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test publishAt in the past is published immediately", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/tweet", map[string]any{
+			"publishTweetType": PublishTweetTypeText,
+			"text":             "now",
+			"publishAt":        time.Now().Add(-time.Minute),
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+}
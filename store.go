@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const defaultDataDir = "./data"
+
+// Store is a map of items that is persisted to a json file after every change.
+// A Store with an empty path is kept in memory only.
+type Store[T any] struct {
+	path  string
+	items map[string]T
+	mu    sync.RWMutex
+}
+
+func newStore[T any](path string) (*Store[T], error) {
+	s := &Store[T]{
+		path:  path,
+		items: make(map[string]T),
+	}
+
+	if path == "" || !exists(path) {
+		return s, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return s, nil
+	}
+	if err := json.Unmarshal(b, &s.items); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// storePath returns the path of a store file inside of dataDir,
+// or an empty string (an in-memory store) if dataDir is empty.
+func storePath(dataDir, filename string) string {
+	if dataDir == "" {
+		return ""
+	}
+	return filepath.Join(dataDir, filename)
+}
+
+// save writes every item to the store file. The caller must hold the write lock.
+func (s *Store[T]) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(s.items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so a crash mid-write can't corrupt the store
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Store[T]) Get(id string) (T, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	item, ok := s.items[id]
+	return item, ok
+}
+
+func (s *Store[T]) Set(id string, item T) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[id] = item
+	return s.save()
+}
+
+// Update replaces the item with the result of fn, while holding the lock.
+// It reports whether the item existed.
+func (s *Store[T]) Update(id string, fn func(item T) (T, error)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[id]
+	if !ok {
+		return false, nil
+	}
+
+	updated, err := fn(item)
+	if err != nil {
+		return true, err
+	}
+
+	s.items[id] = updated
+	return true, s.save()
+}
+
+// Delete removes the item, and reports whether it existed.
+func (s *Store[T]) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; !ok {
+		return false, nil
+	}
+
+	delete(s.items, id)
+	return true, s.save()
+}
+
+// DeleteFunc removes every item for which fn returns true.
+func (s *Store[T]) DeleteFunc(fn func(id string, item T) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := false
+	for id, item := range s.items {
+		if fn(id, item) {
+			delete(s.items, id)
+			deleted = true
+		}
+	}
+
+	if !deleted {
+		return nil
+	}
+	return s.save()
+}
+
+// List returns every item, sorted by id.
+func (s *Store[T]) List() []T {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := make([]T, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, s.items[id])
+	}
+	return items
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	path := filepath.Join(t.TempDir(), "nested", "items.json")
+
+	s, err := newStore[item](path)
+	assert.Nil(t, err)
+	assert.Empty(t, s.List())
+
+	assert.Nil(t, s.Set("b", item{Name: "bravo", Count: 2}))
+	assert.Nil(t, s.Set("a", item{Name: "alpha", Count: 1}))
+
+	ok, err := s.Update("a", func(i item) (item, error) {
+		i.Count++
+		return i, nil
+	})
+	assert.True(t, ok)
+	assert.Nil(t, err)
+
+	ok, err = s.Update("a", func(i item) (item, error) {
+		return i, errors.New("rejected")
+	})
+	assert.True(t, ok)
+	assert.NotNil(t, err)
+
+	ok, _ = s.Update("missing", func(i item) (item, error) { return i, nil })
+	assert.False(t, ok)
+
+	// Items survive reloading the store from disk
+	reloaded, err := newStore[item](path)
+	assert.Nil(t, err)
+	assert.Equal(t, []item{{Name: "alpha", Count: 2}, {Name: "bravo", Count: 2}}, reloaded.List())
+
+	ok, err = reloaded.Delete("a")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, _ = reloaded.Delete("a")
+	assert.False(t, ok)
+
+	assert.Nil(t, reloaded.DeleteFunc(func(id string, i item) bool { return i.Count == 2 }))
+	assert.Empty(t, reloaded.List())
+
+	// In-memory stores are never written to disk
+	mem, err := newStore[item]("")
+	assert.Nil(t, err)
+	assert.Nil(t, mem.Set("a", item{Name: "alpha"}))
+	_, ok = mem.Get("a")
+	assert.True(t, ok)
+}
@@ -0,0 +1,930 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// tmpl renders the text of a fetch_json tweet (or poll option) against the fetched json, along with the {*{ }*} and |* *| syntaxes.
+// Its {{ }} actions are described in the Templates section of the README.
+type tmpl struct {
+	nodes []tmplNode
+}
+
+type tmplNode interface{}
+
+type tmplTextNode struct {
+	text string
+}
+
+type tmplOutputNode struct {
+	pipe *tmplPipeline
+}
+
+// tmplFuncIpolNode is a |* fn(args) *| call, whose body can itself contain actions.
+type tmplFuncIpolNode struct {
+	body []tmplNode
+}
+
+type tmplIfNode struct {
+	branches []tmplBranch
+	elseBody []tmplNode
+}
+
+type tmplBranch struct {
+	cond *tmplCond
+	body []tmplNode
+}
+
+type tmplRangeNode struct {
+	pipe     *tmplPipeline
+	body     []tmplNode
+	elseBody []tmplNode
+}
+
+type tmplCond struct {
+	not   bool
+	left  *tmplPipeline
+	op    string
+	right *tmplPipeline
+}
+
+type tmplPipeline struct {
+	head  *tmplOperand
+	calls []*tmplCall
+}
+
+type tmplCall struct {
+	name string
+	args []*tmplOperand
+}
+
+type tmplOperandKind int
+
+const (
+	tmplOperandLiteral tmplOperandKind = iota
+	tmplOperandPath
+	tmplOperandRootPath
+	tmplOperandItemPath
+	tmplOperandIndex
+	tmplOperandVarsPath
+)
+
+type tmplOperand struct {
+	kind    tmplOperandKind
+	literal interface{}
+	path    *jsonPath
+}
+
+const (
+	tmplLeftDelim      = "{{"
+	tmplRightDelim     = "}}"
+	jsonFmtLeftDelim   = "{*{"
+	jsonFmtRightDelim  = "}*}"
+	funcIpolLeftDelim  = "|*"
+	funcIpolRightDelim = "*|"
+	tmplDefaultFn      = "default"
+	tmplJoinFn         = "join"
+	tmplTrimMarker     = "-"
+	tmplKeywordIf      = "if"
+	tmplKeywordElse    = "else"
+	tmplKeywordRange   = "range"
+	tmplKeywordEnd     = "end"
+	tmplKeywordNot     = "not"
+	tmplItemRef        = "@"
+	tmplIndexRef       = "@index"
+	tmplRootRef        = "$"
+	tmplVarsRef        = "$vars"
+	tmplPipeSep        = "|"
+)
+
+// renderTemplate renders text against the fetched json data, and the variables of a named template.
+// A |* fn(args) *| call that can't be evaluated is published as written, unless strict is set, in which case it's an error.
+func renderTemplate(text string, data interface{}, vars map[string]string, strict bool) (string, error) {
+	t, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+
+	f := newFuncIpol(funcIpolLeftDelim, funcIpolRightDelim)
+	f.SetStrict(strict)
+	return t.render(tmplScope{root: data, vars: tmplVars(vars)}, f)
+}
+
+// tmplVars converts the variables of a named template into json data, so that paths can be resolved against them.
+func tmplVars(vars map[string]string) interface{} {
+	data := make(map[string]interface{}, len(vars))
+	for name, value := range vars {
+		data[name] = value
+	}
+	return data
+}
+
+func parseTemplate(text string) (*tmpl, error) {
+	p := &tmplParser{src: text}
+
+	nodes, term, err := p.parseList(false)
+	if err != nil {
+		return nil, newValidationErr("invalid template: %s", err.Error())
+	}
+	if term != "" {
+		return nil, newValidationErr("invalid template: unexpected {{ %s }}", term)
+	}
+
+	return &tmpl{nodes: nodes}, nil
+}
+
+type tmplParser struct {
+	src      string
+	pos      int
+	trimNext bool
+}
+
+// parseList parses nodes until the end of the template, or until a {{ else }}, {{ else if }}, {{ end }},
+// or (when inFuncIpol is true) *| terminator, which is returned.
+func (p *tmplParser) parseList(inFuncIpol bool) ([]tmplNode, string, error) {
+	nodes := []tmplNode{}
+
+	for {
+		delim, i := p.nextDelim(inFuncIpol)
+
+		text := p.src[p.pos:]
+		if i != -1 {
+			text = p.src[p.pos:i]
+		}
+		if p.trimNext {
+			text = strings.TrimLeft(text, " \t\r\n")
+			p.trimNext = false
+		}
+		if text != "" {
+			nodes = append(nodes, &tmplTextNode{text: text})
+		}
+
+		if i == -1 {
+			p.pos = len(p.src)
+			return nodes, "", nil
+		}
+		p.pos = i + len(delim)
+
+		switch delim {
+		case funcIpolRightDelim:
+			return nodes, funcIpolRightDelim, nil
+
+		case funcIpolLeftDelim:
+			body, term, err := p.parseList(true)
+			if err != nil {
+				return nil, "", err
+			}
+			if term != funcIpolRightDelim {
+				return nil, "", fmt.Errorf("unexpected {{ %s }} inside of %s %s", term, funcIpolLeftDelim, funcIpolRightDelim)
+			}
+			nodes = append(nodes, &tmplFuncIpolNode{body: body})
+
+		case jsonFmtLeftDelim:
+			end := strings.Index(p.src[p.pos:], jsonFmtRightDelim)
+			if end == -1 {
+				return nil, "", fmt.Errorf("unclosed %s", jsonFmtLeftDelim)
+			}
+
+			path, err := parseJsonPath(strings.TrimSpace(p.src[p.pos : p.pos+end]))
+			if err != nil {
+				return nil, "", err
+			}
+			p.pos += end + len(jsonFmtRightDelim)
+
+			nodes = append(nodes, &tmplOutputNode{pipe: &tmplPipeline{head: &tmplOperand{kind: tmplOperandRootPath, path: path}}})
+
+		case tmplLeftDelim:
+			action, err := p.readAction(nodes)
+			if err != nil {
+				return nil, "", err
+			}
+
+			node, term, err := p.parseAction(action, inFuncIpol)
+			if err != nil {
+				return nil, "", err
+			}
+			if term != "" {
+				return nodes, term, nil
+			}
+			nodes = append(nodes, node)
+		}
+	}
+}
+
+var tmplClosingDelims = map[string]string{
+	tmplLeftDelim:     tmplRightDelim,
+	jsonFmtLeftDelim:  jsonFmtRightDelim,
+	funcIpolLeftDelim: funcIpolRightDelim,
+}
+
+// nextDelim returns the next opening delimiter (or closing *| when inFuncIpol is true), and its index.
+func (p *tmplParser) nextDelim(inFuncIpol bool) (string, int) {
+	delims := []string{tmplLeftDelim, jsonFmtLeftDelim, funcIpolLeftDelim}
+	if inFuncIpol {
+		delims = append(delims, funcIpolRightDelim)
+	}
+
+	var (
+		next  string
+		index = -1
+	)
+	for _, delim := range delims {
+		i := strings.Index(p.src[p.pos:], delim)
+		if i == -1 {
+			continue
+		}
+		// An opening delimiter without its closing delimiter is left as text (ex: "5 |* 3" or "price {{")
+		if end, ok := tmplClosingDelims[delim]; ok && !strings.Contains(p.src[p.pos+i+len(delim):], end) {
+			continue
+		}
+		if index == -1 || p.pos+i < index {
+			next, index = delim, p.pos+i
+		}
+	}
+
+	return next, index
+}
+
+// readAction returns the contents of the {{ action }} starting at p.pos, and applies its trim markers.
+func (p *tmplParser) readAction(nodes []tmplNode) (string, error) {
+	end := indexOutsideQuotes(p.src[p.pos:], '}')
+	for end != -1 && !strings.HasPrefix(p.src[p.pos+end:], tmplRightDelim) {
+		next := indexOutsideQuotes(p.src[p.pos+end+1:], '}')
+		if next == -1 {
+			end = -1
+			break
+		}
+		end += next + 1
+	}
+	if end == -1 {
+		return "", fmt.Errorf("unclosed %s", tmplLeftDelim)
+	}
+
+	action := p.src[p.pos : p.pos+end]
+	p.pos += end + len(tmplRightDelim)
+
+	if strings.HasPrefix(action, tmplTrimMarker+" ") || action == tmplTrimMarker {
+		action = action[1:]
+		if len(nodes) > 0 {
+			if text, ok := nodes[len(nodes)-1].(*tmplTextNode); ok {
+				text.text = strings.TrimRight(text.text, " \t\r\n")
+			}
+		}
+	}
+	if strings.HasSuffix(action, " "+tmplTrimMarker) {
+		action = action[:len(action)-1]
+		p.trimNext = true
+	}
+
+	return strings.TrimSpace(action), nil
+}
+
+// parseAction parses an action, along with the body of an if or range. Terminators are returned instead of a node.
+func (p *tmplParser) parseAction(action string, inFuncIpol bool) (tmplNode, string, error) {
+	keyword, rest, _ := strings.Cut(action, " ")
+	rest = strings.TrimSpace(rest)
+
+	switch keyword {
+	case tmplKeywordElse, tmplKeywordEnd:
+		return nil, action, nil
+
+	case tmplKeywordIf:
+		node := &tmplIfNode{}
+		condStr := rest
+		for {
+			cond, err := parseTmplCond(condStr)
+			if err != nil {
+				return nil, "", err
+			}
+
+			body, term, err := p.parseList(inFuncIpol)
+			if err != nil {
+				return nil, "", err
+			}
+			node.branches = append(node.branches, tmplBranch{cond: cond, body: body})
+
+			switch {
+			case term == tmplKeywordEnd:
+				return node, "", nil
+			case term == tmplKeywordElse:
+				if node.elseBody, err = p.parseEnd(inFuncIpol, tmplKeywordIf); err != nil {
+					return nil, "", err
+				}
+				return node, "", nil
+			case strings.HasPrefix(term, tmplKeywordElse+" "+tmplKeywordIf+" "):
+				condStr = strings.TrimSpace(strings.TrimPrefix(term, tmplKeywordElse+" "+tmplKeywordIf))
+			default:
+				return nil, "", unclosedErr(tmplKeywordIf, term)
+			}
+		}
+
+	case tmplKeywordRange:
+		pipe, err := parseTmplPipeline(rest)
+		if err != nil {
+			return nil, "", err
+		}
+		node := &tmplRangeNode{pipe: pipe}
+
+		body, term, err := p.parseList(inFuncIpol)
+		if err != nil {
+			return nil, "", err
+		}
+		node.body = body
+
+		switch term {
+		case tmplKeywordEnd:
+			return node, "", nil
+		case tmplKeywordElse:
+			if node.elseBody, err = p.parseEnd(inFuncIpol, tmplKeywordRange); err != nil {
+				return nil, "", err
+			}
+			return node, "", nil
+		}
+		return nil, "", unclosedErr(tmplKeywordRange, term)
+	}
+
+	pipe, err := parseTmplPipeline(action)
+	if err != nil {
+		return nil, "", err
+	}
+	return &tmplOutputNode{pipe: pipe}, "", nil
+}
+
+// parseEnd parses the body of an {{ else }}, which must be followed by {{ end }}.
+func (p *tmplParser) parseEnd(inFuncIpol bool, keyword string) ([]tmplNode, error) {
+	body, term, err := p.parseList(inFuncIpol)
+	if err != nil {
+		return nil, err
+	}
+	if term != tmplKeywordEnd {
+		return nil, unclosedErr(keyword, term)
+	}
+	return body, nil
+}
+
+func unclosedErr(keyword, term string) error {
+	if term == "" || term == funcIpolRightDelim {
+		return fmt.Errorf("{{ %s }} is missing its {{ end }}", keyword)
+	}
+	return fmt.Errorf("unexpected {{ %s }} inside of {{ %s }}", term, keyword)
+}
+
+// tokenizeTmplAction splits an action into words, quoted strings, pipes, and comparison operators.
+// Brackets in paths (ex: posts[?status == "published"]) are kept in the same word.
+func tokenizeTmplAction(s string) ([]string, error) {
+	tokens := []string{}
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '|':
+			tokens = append(tokens, tmplPipeSep)
+			i++
+		case c == '"':
+			end := closingQuote(s, i)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string in (%s)", s)
+			}
+			tokens = append(tokens, s[i:end+1])
+			i = end + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			op := ""
+			for _, o := range jsonPathOps {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected (%c) in (%s)", c, s)
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		default:
+			start, depth := i, 0
+			for ; i < len(s); i++ {
+				c := s[i]
+				if c == '"' && depth > 0 {
+					if i = closingQuote(s, i); i == -1 {
+						return nil, fmt.Errorf("unterminated string in (%s)", s)
+					}
+					continue
+				}
+				if c == '[' {
+					depth++
+				} else if c == ']' {
+					depth--
+				} else if depth == 0 && strings.ContainsRune(" \t\r\n|=!<>\"", rune(c)) {
+					break
+				}
+			}
+			tokens = append(tokens, s[start:i])
+		}
+	}
+
+	return tokens, nil
+}
+
+// closingQuote returns the index of the quote closing the string that starts at s[start], or -1.
+func closingQuote(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseTmplCond(s string) (*tmplCond, error) {
+	tokens, err := tokenizeTmplAction(s)
+	if err != nil {
+		return nil, err
+	}
+
+	cond := &tmplCond{}
+	if len(tokens) > 0 && tokens[0] == tmplKeywordNot {
+		cond.not = true
+		tokens = tokens[1:]
+	}
+
+	for i, token := range tokens {
+		if isTmplOp(token) {
+			cond.op = token
+			if cond.right, err = newTmplPipeline(tokens[i+1:]); err != nil {
+				return nil, err
+			}
+			tokens = tokens[:i]
+			break
+		}
+	}
+
+	if cond.left, err = newTmplPipeline(tokens); err != nil {
+		return nil, err
+	}
+	return cond, nil
+}
+
+func isTmplOp(token string) bool {
+	for _, op := range jsonPathOps {
+		if token == op {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTmplPipeline(s string) (*tmplPipeline, error) {
+	tokens, err := tokenizeTmplAction(s)
+	if err != nil {
+		return nil, err
+	}
+	return newTmplPipeline(tokens)
+}
+
+func newTmplPipeline(tokens []string) (*tmplPipeline, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("missing value in action")
+	}
+
+	groups := [][]string{{}}
+	for _, token := range tokens {
+		if isTmplOp(token) {
+			return nil, fmt.Errorf("unexpected (%s)", token)
+		}
+		if token == tmplPipeSep {
+			groups = append(groups, []string{})
+			continue
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], token)
+	}
+
+	if len(groups[0]) != 1 {
+		return nil, fmt.Errorf("expected a single value before the first (|), but got (%s)", strings.Join(groups[0], " "))
+	}
+
+	head, err := parseTmplOperand(groups[0][0])
+	if err != nil {
+		return nil, err
+	}
+	pipe := &tmplPipeline{head: head}
+
+	for _, group := range groups[1:] {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("missing function name after (|)")
+		}
+
+		call := &tmplCall{name: group[0]}
+		for _, token := range group[1:] {
+			arg, err := parseTmplOperand(token)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		pipe.calls = append(pipe.calls, call)
+	}
+
+	return pipe, nil
+}
+
+func parseTmplOperand(token string) (*tmplOperand, error) {
+	switch {
+	case token == tmplIndexRef:
+		return &tmplOperand{kind: tmplOperandIndex}, nil
+	case token == tmplItemRef:
+		return &tmplOperand{kind: tmplOperandItemPath, path: &jsonPath{raw: token}}, nil
+	case token == tmplRootRef:
+		return &tmplOperand{kind: tmplOperandRootPath, path: &jsonPath{raw: token}}, nil
+	case token == tmplVarsRef:
+		return &tmplOperand{kind: tmplOperandVarsPath, path: &jsonPath{raw: token}}, nil
+	case strings.HasPrefix(token, `"`), token == "true", token == "false", token == "null":
+		literal, err := parseJsonPathLiteral(token)
+		if err != nil {
+			return nil, err
+		}
+		return &tmplOperand{kind: tmplOperandLiteral, literal: literal}, nil
+	}
+
+	// Numbers keep their text, so they're passed to functions as written (ex: truncate 100)
+	if _, err := strconv.ParseFloat(token, 64); err == nil {
+		return &tmplOperand{kind: tmplOperandLiteral, literal: json.Number(token)}, nil
+	}
+
+	kind := tmplOperandPath
+	pathStr := token
+	if s, ok := strings.CutPrefix(token, tmplVarsRef+"."); ok {
+		kind, pathStr = tmplOperandVarsPath, s
+	} else if s, ok := strings.CutPrefix(token, tmplRootRef); ok {
+		kind, pathStr = tmplOperandRootPath, strings.TrimPrefix(s, ".")
+	} else if s, ok := strings.CutPrefix(token, tmplItemRef); ok {
+		kind, pathStr = tmplOperandItemPath, strings.TrimPrefix(s, ".")
+	}
+
+	path, err := parseJsonPath(pathStr)
+	if err != nil {
+		return nil, err
+	}
+	path.raw = token
+
+	return &tmplOperand{kind: kind, path: path}, nil
+}
+
+// tmplScope holds the root of the json, the variables of a named template, and the current item while in a range.
+type tmplScope struct {
+	root    interface{}
+	vars    interface{}
+	item    interface{}
+	index   int
+	inRange bool
+}
+
+// tmplValue is the result of an operand or pipeline. A value is missing if its path could not be resolved.
+type tmplValue struct {
+	value    interface{}
+	selected bool
+	sep      string
+	err      error
+}
+
+func (v tmplValue) missing() bool {
+	return v.err != nil
+}
+
+func (v tmplValue) string() (string, error) {
+	if v.missing() {
+		return "", v.err
+	}
+	if !v.selected {
+		return formatJsonValue(v.value)
+	}
+
+	items := v.value.([]interface{})
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		s, err := formatJsonValue(item)
+		if err != nil {
+			return "", err
+		}
+		strs = append(strs, s)
+	}
+	return strings.Join(strs, v.sep), nil
+}
+
+func (v tmplValue) empty() bool {
+	if v.missing() || v.value == nil || v.value == "" {
+		return true
+	}
+	items, ok := v.value.([]interface{})
+	return ok && v.selected && len(items) == 0
+}
+
+func (v tmplValue) truthy() bool {
+	if v.missing() {
+		return false
+	}
+	if v.selected {
+		return len(v.value.([]interface{})) > 0
+	}
+	return isTruthy(v.value)
+}
+
+func (t *tmpl) render(scope tmplScope, f *FuncIpol) (string, error) {
+	sb := &tmplWriter{}
+	if err := renderTmplNodes(sb, t.nodes, scope, f); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// tmplWriter collects the rendered text. In the body of a |* fn(args) *| call, rendered values
+// are written as references instead, so they are passed to the function as written, and never parsed as its arguments.
+type tmplWriter struct {
+	strings.Builder
+	inFuncIpol bool
+	values     []string
+}
+
+func (w *tmplWriter) writeValue(s string) {
+	if !w.inFuncIpol {
+		w.WriteString(s)
+		return
+	}
+	w.WriteString(funcIpolValueRef(len(w.values)))
+	w.values = append(w.values, s)
+}
+
+func renderTmplNodes(sb *tmplWriter, nodes []tmplNode, scope tmplScope, f *FuncIpol) error {
+	for _, node := range nodes {
+		switch n := node.(type) {
+		case *tmplTextNode:
+			sb.WriteString(n.text)
+
+		case *tmplOutputNode:
+			v, err := n.pipe.eval(scope, f)
+			if err != nil {
+				return err
+			}
+			s, err := v.string()
+			if err != nil {
+				return err
+			}
+			sb.writeValue(s)
+
+		case *tmplFuncIpolNode:
+			body := &tmplWriter{inFuncIpol: true}
+			if err := renderTmplNodes(body, n.body, scope, f); err != nil {
+				return err
+			}
+			s, err := f.EvalValues(f.leftDelim+body.String()+f.rightDelim, body.values)
+			if err != nil {
+				return err
+			}
+			sb.writeValue(s)
+
+		case *tmplIfNode:
+			body := n.elseBody
+			for _, branch := range n.branches {
+				ok, err := branch.cond.eval(scope, f)
+				if err != nil {
+					return err
+				}
+				if ok {
+					body = branch.body
+					break
+				}
+			}
+			if err := renderTmplNodes(sb, body, scope, f); err != nil {
+				return err
+			}
+
+		case *tmplRangeNode:
+			v, err := n.pipe.eval(scope, f)
+			if err != nil {
+				return err
+			}
+
+			var items []interface{}
+			if !v.missing() && v.value != nil {
+				arr, ok := v.value.([]interface{})
+				if !ok {
+					return newValidationErr("cannot range over (%s), which is not an array", n.pipe.head.raw())
+				}
+				items = arr
+			}
+			if len(items) == 0 {
+				if err := renderTmplNodes(sb, n.elseBody, scope, f); err != nil {
+					return err
+				}
+				continue
+			}
+
+			for i, item := range items {
+				itemScope := tmplScope{root: scope.root, vars: scope.vars, item: item, index: i, inRange: true}
+				if err := renderTmplNodes(sb, n.body, itemScope, f); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (o *tmplOperand) raw() string {
+	switch o.kind {
+	case tmplOperandLiteral:
+		return fmt.Sprintf("%v", o.literal)
+	case tmplOperandIndex:
+		return tmplIndexRef
+	}
+	return o.path.raw
+}
+
+func (o *tmplOperand) eval(scope tmplScope) tmplValue {
+	var base interface{}
+
+	switch o.kind {
+	case tmplOperandLiteral:
+		return tmplValue{value: o.literal}
+	case tmplOperandIndex:
+		if !scope.inRange {
+			return tmplValue{err: newValidationErr("%s can only be used inside of {{ range }}", tmplIndexRef)}
+		}
+		return tmplValue{value: json.Number(strconv.Itoa(scope.index))}
+	case tmplOperandItemPath:
+		if !scope.inRange {
+			return tmplValue{err: newValidationErr("%s can only be used inside of {{ range }}", o.path.raw)}
+		}
+		base = scope.item
+	case tmplOperandPath:
+		base = scope.root
+		if scope.inRange {
+			base = scope.item
+		}
+	case tmplOperandRootPath:
+		base = scope.root
+	case tmplOperandVarsPath:
+		base = scope.vars
+	}
+
+	value, selected, err := o.path.get(base)
+	return tmplValue{value: value, selected: selected, sep: o.path.sep, err: err}
+}
+
+func (p *tmplPipeline) eval(scope tmplScope, f *FuncIpol) (tmplValue, error) {
+	v := p.head.eval(scope)
+
+	for _, call := range p.calls {
+		if call.name == tmplDefaultFn {
+			if len(call.args) != 1 {
+				return v, newValidationErr("%s requires 1 argument, but got (%d) arguments instead", tmplDefaultFn, len(call.args))
+			}
+			if v.empty() {
+				if v = call.args[0].eval(scope); v.missing() {
+					return v, v.err
+				}
+			}
+			continue
+		}
+
+		if call.name == tmplJoinFn {
+			if len(call.args) != 1 {
+				return v, newValidationErr("%s requires 1 argument, but got (%d) arguments instead", tmplJoinFn, len(call.args))
+			}
+			if v.missing() {
+				return v, v.err
+			}
+			sep, err := call.args[0].eval(scope).string()
+			if err != nil {
+				return v, err
+			}
+			if _, ok := v.value.([]interface{}); !ok {
+				return v, newValidationErr("cannot join (%s), which is not an array", p.head.raw())
+			}
+			v.selected, v.sep = true, sep
+			continue
+		}
+
+		fn, ok := f.Fn(call.name)
+		if !ok {
+			return v, newValidationErr("unknown function (%s)", call.name)
+		}
+
+		s, err := v.string()
+		if err != nil {
+			return v, err
+		}
+		args := []string{s}
+		for _, arg := range call.args {
+			s, err := arg.eval(scope).string()
+			if err != nil {
+				return v, err
+			}
+			args = append(args, s)
+		}
+
+		result, err := fn(args...)
+		if err != nil {
+			return v, newValidationErr("error calling %s: %s", call.name, err.Error())
+		}
+		v = tmplValue{value: result}
+	}
+
+	return v, nil
+}
+
+func (c *tmplCond) eval(scope tmplScope, f *FuncIpol) (bool, error) {
+	left, err := c.left.evalOptional(scope, f)
+	if err != nil {
+		return false, err
+	}
+
+	result := left.truthy()
+	if c.op != "" {
+		right, err := c.right.evalOptional(scope, f)
+		if err != nil {
+			return false, err
+		}
+		result = !left.missing() && !right.missing() && !left.selected && !right.selected &&
+			compareJsonValues(left.value, c.op, right.value)
+	}
+
+	if c.not {
+		return !result, nil
+	}
+	return result, nil
+}
+
+// evalOptional evaluates a pipeline whose head may be missing, such as the condition of an if.
+func (p *tmplPipeline) evalOptional(scope tmplScope, f *FuncIpol) (tmplValue, error) {
+	if len(p.calls) == 0 {
+		return p.head.eval(scope), nil
+	}
+	if v := p.head.eval(scope); v.missing() && p.calls[0].name != tmplDefaultFn {
+		return v, nil
+	}
+	return p.eval(scope, f)
+}
+
+// paths returns the paths of the template that are resolved against the root of the json,
+// which excludes the paths relative to the items of a range.
+func (t *tmpl) paths() []*jsonPath {
+	var (
+		paths = []*jsonPath{}
+		seen  = map[string]bool{}
+	)
+
+	addOperand := func(o *tmplOperand, inRange bool) {
+		if o.path == nil || len(o.path.segments) == 0 || seen[o.path.raw] {
+			return
+		}
+		if o.kind == tmplOperandRootPath || (o.kind == tmplOperandPath && !inRange) {
+			seen[o.path.raw] = true
+			paths = append(paths, o.path)
+		}
+	}
+	addPipe := func(pipe *tmplPipeline, inRange bool) {
+		if pipe == nil {
+			return
+		}
+		addOperand(pipe.head, inRange)
+		for _, call := range pipe.calls {
+			for _, arg := range call.args {
+				addOperand(arg, inRange)
+			}
+		}
+	}
+
+	var walk func(nodes []tmplNode, inRange bool)
+	walk = func(nodes []tmplNode, inRange bool) {
+		for _, node := range nodes {
+			switch n := node.(type) {
+			case *tmplOutputNode:
+				addPipe(n.pipe, inRange)
+			case *tmplFuncIpolNode:
+				walk(n.body, inRange)
+			case *tmplIfNode:
+				for _, branch := range n.branches {
+					addPipe(branch.cond.left, inRange)
+					addPipe(branch.cond.right, inRange)
+					walk(branch.body, inRange)
+				}
+				walk(n.elseBody, inRange)
+			case *tmplRangeNode:
+				addPipe(n.pipe, inRange)
+				walk(n.body, true)
+				walk(n.elseBody, inRange)
+			}
+		}
+	}
+	walk(t.nodes, false)
+
+	return paths
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	type RenderTemplateTest struct {
+		text      string
+		expected  string
+		shouldErr bool
+	}
+
+	var data interface{}
+	d := json.NewDecoder(strings.NewReader(`{
+		"title": "Go 1.24 is released",
+		"subtitle": "",
+		"draftTitle": "Hello, \"world\" (draft)",
+		"url": "https://example.com/go 1.24",
+		"views": 1500,
+		"draft": false,
+		"author": {
+			"name": "Jim"
+		},
+		"tags": ["go", "release"],
+		"posts": [
+			{ "title": "First", "status": "draft" },
+			{ "title": "Second", "status": "published", "tags": ["a", "b"] }
+		]
+	}`))
+	d.UseNumber()
+	assert.Nil(t, d.Decode(&data))
+
+	vars := map[string]string{"repo": "go", "code": "{{ title }} |* upper(x) *|"}
+
+	tests := []RenderTemplateTest{
+		// No actions
+		{text: "", expected: ""},
+		{text: "some text", expected: "some text"},
+
+		// Variables
+		{text: "{{ title }}", expected: "Go 1.24 is released"},
+		{text: "{{title}} by {{ author.name }}", expected: "Go 1.24 is released by Jim"},
+		{text: "{{ views }} views", expected: "1500 views"},
+		{text: "{{ tags[-1] }}", expected: "release"},
+		{text: "{{ tags[*] }}", expected: "go, release"},
+		{text: `{{ posts[?status == "published"][0].title }}`, expected: "Second"},
+		{text: "{{ missing }}", shouldErr: true},
+		{text: "{{ author.missing }}", shouldErr: true},
+
+		// Literals
+		{text: `{{ "quoted \"text\"" }}`, expected: `quoted "text"`},
+		{text: "{{ 42 }}", expected: "42"},
+
+		// Pipelines
+		{text: "{{ title | upper }}", expected: "GO 1.24 IS RELEASED"},
+		{text: "{{ title | truncate 10 | upper }}", expected: "GO 1.24 I…"},
+		{text: "{{ url | pathEscape }}", expected: "https:%2F%2Fexample.com%2Fgo%201.24"},
+		{text: `{{ tags | join " #" }}`, expected: "go #release"},
+		{text: `{{ posts[*].title | join " / " | lower }}`, expected: "first / second"},
+		{text: `{{ title | join " " }}`, shouldErr: true},
+		{text: "{{ title | unknown }}", shouldErr: true},
+		{text: "{{ title | truncate }}", shouldErr: true},
+		{text: "{{ missing | upper }}", shouldErr: true},
+
+		// Defaults
+		{text: `{{ subtitle | default "none" }}`, expected: "none"},
+		{text: `{{ missing | default "none" | upper }}`, expected: "NONE"},
+		{text: `{{ missing | default author.name }}`, expected: "Jim"},
+		{text: `{{ title | default "none" }}`, expected: "Go 1.24 is released"},
+		{text: `{{ draft | default "none" }}`, expected: "false"},
+		{text: `{{ missing | default other }}`, shouldErr: true},
+
+		// Conditionals
+		{text: "{{ if author }}by {{ author.name }}{{ end }}", expected: "by Jim"},
+		{text: "{{ if missing }}by {{ missing }}{{ end }}", expected: ""},
+		{text: "{{ if subtitle }}{{ subtitle }}{{ else }}no subtitle{{ end }}", expected: "no subtitle"},
+		{text: "{{ if draft }}draft{{ else if views > 1000 }}popular{{ else }}new{{ end }}", expected: "popular"},
+		{text: "{{ if not draft }}live{{ end }}", expected: "live"},
+		{text: `{{ if author.name == "Jim" }}yes{{ end }}`, expected: "yes"},
+		{text: `{{ if author.name | lower != "jim" }}yes{{ else }}no{{ end }}`, expected: "no"},
+		{text: "{{ if missing > 1 }}yes{{ else }}no{{ end }}", expected: "no"},
+		{text: "{{ if author == author }}yes{{ else }}no{{ end }}", expected: "no"},
+		{text: "{{ if tags != posts }}yes{{ else }}no{{ end }}", expected: "no"},
+		{text: `{{ if author == "Jim" }}yes{{ else }}no{{ end }}`, expected: "no"},
+		{text: `{{ if posts[?tags == "a"] }}yes{{ else }}no{{ end }}`, expected: "no"},
+		{text: "{{ if title }}unclosed", shouldErr: true},
+		{text: "{{ if title }}a{{ else }}b{{ else }}c{{ end }}", shouldErr: true},
+		{text: "{{ end }}", shouldErr: true},
+		{text: "{{ else }}", shouldErr: true},
+
+		// Loops
+		{text: "{{ range tags }}#{{ @ }} {{ end }}", expected: "#go #release "},
+		{text: "{{ range posts }}{{ @index }}. {{ title }} {{ end }}", expected: "0. First 1. Second "},
+		{text: "{{ range posts }}{{ title }} ({{ $.author.name }}) {{ end }}", expected: "First (Jim) Second (Jim) "},
+		{text: `{{ range posts[?status == "published"] }}{{ @.title }}{{ end }}`, expected: "Second"},
+		{text: "{{ range posts }}{{ range tags }}{{ @ }}{{ else }}-{{ end }}{{ end }}", expected: "-ab"},
+		{text: "{{ range missing }}a{{ else }}empty{{ end }}", expected: "empty"},
+		{text: "{{ range title }}a{{ end }}", shouldErr: true},
+		{text: "{{ range tags }}a", shouldErr: true},
+		{text: "{{ @index }}", shouldErr: true},
+
+		// Trim markers
+		{text: "a  {{- title | lower -}}  b", expected: "ago 1.24 is releasedb"},
+		{text: "{{ range tags -}}\n  {{ @ }}\n{{- end }}", expected: "gorelease"},
+
+		// Old syntaxes
+		{text: "{*{ title }*}", expected: "Go 1.24 is released"},
+		{text: "{*{ missing }*}", shouldErr: true},
+		{text: "{*{ tags[*] | join(\" #\") }*}", expected: "go #release"},
+		{text: "{*{ tags | join(\" #\") }*}", expected: "go #release"},
+		{text: "{*{ title | join(\" #\") }*}", shouldErr: true},
+		{text: "|* pathEscape({*{ url }*}) *|", expected: "https:%2F%2Fexample.com%2Fgo%201.24"},
+		{text: "|*upper({{ author.name }})*| and {{ title }}", expected: "JIM and Go 1.24 is released"},
+		{text: "{{ range posts }}{*{ author.name }*}{{ end }}", expected: "JimJim"},
+		{text: "5 |* 3", expected: "5 |* 3"},
+
+		// Values are passed to functions as written
+		{text: "|* truncate({*{ draftTitle }*}, 8) *|", expected: "Hello,…"},
+		{text: "|* upper('{{ draftTitle }}') *|", expected: "HELLO, \"WORLD\" (DRAFT)"},
+		{text: "|* upper(by {{ author.name }}: {{ draftTitle }}) *|", expected: "BY JIM: HELLO, \"WORLD\" (DRAFT)"},
+
+		// Variables are data, so their values are never parsed
+		{text: "{{ $vars.repo }}: {{ title }}", expected: "go: Go 1.24 is released"},
+		{text: "{{ $vars.code }}", expected: "{{ title }} |* upper(x) *|"},
+		{text: "|* upper({{ $vars.code }}) *|", expected: "{{ TITLE }} |* UPPER(X) *|"},
+		{text: "{{ range tags }}{{ $vars.repo }}{{ end }}", expected: "gogo"},
+		{text: "{{ $vars.missing | default \"none\" }}", expected: "none"},
+		{text: "{{ $vars.missing }}", shouldErr: true},
+
+		// Unclosed delimiters are text
+		{text: "price {{", expected: "price {{"},
+		{text: "{{ title", expected: "{{ title"},
+		{text: "{*{ title", expected: "{*{ title"},
+		{text: "{{ title }} {{", expected: "Go 1.24 is released {{"},
+
+		// Invalid actions
+		{text: "{{ }}", shouldErr: true},
+		{text: "{{ title author }}", shouldErr: true},
+		{text: "{{ title | }}", shouldErr: true},
+		{text: `{{ "unterminated }}`, shouldErr: true},
+	}
+
+	// Calls that can't be evaluated are published as written, unless the template is strict
+	for text, expected := range map[string]string{
+		"|* unknown(x) *|":                  "|* unknown(x) *|",
+		"|* truncate({{ title }}, many) *|": "|* truncate(Go 1.24 is released, many) *|",
+		"|* upper({{ title }} *| and more":  "|* upper(Go 1.24 is released *| and more",
+	} {
+		s, err := renderTemplate(text, data, vars, false)
+		assert.Nil(t, err, text)
+		assert.Equal(t, expected, s, text)
+
+		_, err = renderTemplate(text, data, vars, true)
+		assert.IsType(t, &FuncIpolError{}, err, text)
+	}
+
+	for _, test := range tests {
+		s, err := renderTemplate(test.text, data, vars, true)
+		if test.shouldErr {
+			assert.NotNil(t, err, test.text)
+			assert.IsType(t, &ValidationError{}, err, test.text)
+		} else {
+			assert.Nil(t, err, test.text)
+			assert.Equal(t, test.expected, s, test.text)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/michimani/gotwi"
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+)
+
+func validateThreadTexts(texts []string) error {
+	if len(texts) == 0 {
+		return newValidationErr("texts must contain at least (1) tweet")
+	}
+
+	for i, text := range texts {
+		if err := validateTweetText(text); err != nil {
+			return fmt.Errorf("thread part (%d): %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// publishThread publishes each text as a reply to the one before it, starting with a reply to replyToTweetID if it isn't empty.
+// Every part after the first is published from the same account as the first, and media is only attached to the first part.
+// Only the first part is checked against contentHash, which identifies the content of the whole thread.
+// If a part fails after at least one was published, the partial result is returned alongside a *ThreadPartialError.
+func (c *TwitterClient) publishThread(username string, texts []string, replyToTweetID string, media []*MediaOpts, contentHash string) (*PublishTweetResult, error) {
+	result := &PublishTweetResult{
+		Username: username,
+		Thread:   []*managetweetTypes.CreateOutput{},
+	}
+
+	for i, text := range texts {
+		p := &managetweetTypes.CreateInput{
+			Text: gotwi.String(text),
+		}
+		if replyToTweetID != "" {
+			p.Reply = &managetweetTypes.CreateInputReply{
+				InReplyToTweetID: replyToTweetID,
+			}
+		}
+
+		var (
+			partMedia []*MediaOpts
+			partHash  string
+		)
+		if i == 0 {
+			partMedia = media
+			partHash = contentHash
+		}
+
+		output, usedUsername, err := c.doCreate(result.Username, p, partMedia, partHash)
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			return result, &ThreadPartialError{
+				Published: i,
+				Total:     len(texts),
+				Err:       err,
+			}
+		}
+
+		if i == 0 {
+			result.CreateOutput = output
+			result.Username = usedUsername
+		}
+		result.Thread = append(result.Thread, output)
+		replyToTweetID = *output.Data.ID
+	}
+
+	return result, nil
+}
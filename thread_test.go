@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishThread(t *testing.T) {
+	type createdTweet struct {
+		username  string
+		text      string
+		inReplyTo string
+	}
+
+	var newHandler = func(created *[]createdTweet, failAt int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var in managetweetTypes.CreateInput
+			json.NewDecoder(r.Body).Decode(&in)
+
+			if len(*created) == failAt {
+				writeJSON(w, http.StatusForbidden, map[string]string{"title": "Forbidden", "detail": "duplicate content"})
+				return
+			}
+
+			tweet := createdTweet{
+				username: r.Header.Get("X-Test-Username"),
+				text:     *in.Text,
+			}
+			if in.Reply != nil {
+				tweet.inReplyTo = in.Reply.InReplyToTweetID
+			}
+			*created = append(*created, tweet)
+
+			writeJSON(w, http.StatusCreated, map[string]any{
+				"data": map[string]string{
+					"id":   fmt.Sprintf("100000000000000000%d", len(*created)),
+					"text": *in.Text,
+				},
+			})
+		}
+	}
+
+	t.Run("Test reply chain", func(t *testing.T) {
+		created := []createdTweet{}
+		c := newTestTwitterClient(t, newHandler(&created, -1), "alpha", "bravo")
+
+		result, err := c.publishThread("", []string{"one", "two", "three"}, "", nil, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "alpha", result.Username)
+		assert.Equal(t, []string{"1000000000000000001", "1000000000000000002", "1000000000000000003"}, result.TweetIDs())
+		assert.Equal(t, []createdTweet{
+			{username: "alpha", text: "one", inReplyTo: ""},
+			{username: "alpha", text: "two", inReplyTo: "1000000000000000001"},
+			{username: "alpha", text: "three", inReplyTo: "1000000000000000002"},
+		}, created)
+	})
+
+	t.Run("Test partial failure", func(t *testing.T) {
+		created := []createdTweet{}
+		c := newTestTwitterClient(t, newHandler(&created, 2), "alpha")
+
+		result, err := c.publishThread("alpha", []string{"one", "two", "three"}, "1234567890123456789", nil, "")
+		var partialErr *ThreadPartialError
+		assert.True(t, errors.As(err, &partialErr))
+		assert.Equal(t, 2, partialErr.Published)
+		assert.Equal(t, 3, partialErr.Total)
+		assert.Equal(t, []string{"1000000000000000001", "1000000000000000002"}, result.TweetIDs())
+		assert.Equal(t, "1234567890123456789", created[0].inReplyTo)
+	})
+
+	t.Run("Test validateThreadTexts()", func(t *testing.T) {
+		assert.NotNil(t, validateThreadTexts(nil))
+		assert.NotNil(t, validateThreadTexts([]string{"one", " "}))
+		assert.Nil(t, validateThreadTexts([]string{"one", "two"}))
+	})
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Template names are used in urls, so they're limited to characters that don't need escaping
+var tweetTemplateNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// The fields of the fetch request can reference variables as ${name}. Secret references (${secret:NAME}) don't match,
+// so they are left to be resolved when the url is fetched. Texts reference variables as {{ $vars.name }} instead.
+var (
+	templateVarRegexp     = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+	templateVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// The number of versions kept in the history of each template
+const maxTweetTemplateVersions = 50
+
+// TweetTemplateOpts is the definition of a tweet template, as sent to the create and update endpoints.
+// The name can only be set when the template is created.
+type TweetTemplateOpts struct {
+	Name      string            `json:"name"`
+	Opts      PublishTweetOpts  `json:"opts"`
+	Variables map[string]string `json:"variables"`
+}
+
+// TweetTemplate is a named PublishTweetOpts that is stored server-side, so callers can publish it
+// by name. Its opts can reference variables, which default to Variables and can be overridden when publishing.
+type TweetTemplate struct {
+	Name      string            `json:"name"`
+	Opts      PublishTweetOpts  `json:"opts"`
+	Variables map[string]string `json:"variables"`
+	// Version is incremented every time the template is updated, and earlier versions are kept as TweetTemplateVersions
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TweetTemplateVersion is the definition of a template as it was at one of its versions.
+type TweetTemplateVersion struct {
+	Name      string            `json:"name"`
+	Version   int               `json:"version"`
+	Opts      PublishTweetOpts  `json:"opts"`
+	Variables map[string]string `json:"variables"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+func templateVersionID(name string, version int) string {
+	return fmt.Sprintf("%s@%d", name, version)
+}
+
+// TweetTemplatePublishOpts is the body of a request to publish a template.
+// Version publishes an earlier version of the template instead of its current one.
+type TweetTemplatePublishOpts struct {
+	Variables   map[string]string `json:"variables"`
+	Username    string            `json:"username"`
+	PublishAt   *time.Time        `json:"publishAt,omitempty"`
+	CallbackUrl string            `json:"callbackUrl"`
+	Version     int               `json:"version,omitempty"`
+}
+
+// templateTexts returns the texts of opts that are rendered as templates.
+func templateTexts(opts PublishTweetOpts) []string {
+	texts := []string{}
+	if opts.Text != "" {
+		texts = append(texts, opts.Text)
+	}
+	texts = append(texts, opts.Texts...)
+	if opts.Poll != nil {
+		texts = append(texts, opts.Poll.Options...)
+	}
+	return texts
+}
+
+// render returns the opts of the template with the per-call overrides applied. Variables are data of the texts,
+// which a fetch_json tweet renders once the json is fetched, and other tweets render here. The fields of the fetch
+// request have their ${name} references replaced, and the values of those in the url are escaped.
+func (t TweetTemplate) render(publishOpts TweetTemplatePublishOpts) (PublishTweetOpts, error) {
+	vars := map[string]string{}
+	for name, value := range t.Variables {
+		vars[name] = value
+	}
+	for name, value := range publishOpts.Variables {
+		vars[name] = value
+	}
+
+	var err error
+	expandFunc := func(s string, escape func(string) string) string {
+		return templateVarRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+			name := templateVarRegexp.FindStringSubmatch(ref)[1]
+			value, ok := vars[name]
+			if !ok && err == nil {
+				err = newValidationErr("template (%s) references an undefined variable (%s)", t.Name, name)
+			}
+			return escape(value)
+		})
+	}
+	expand := func(s string) string {
+		return expandFunc(s, func(value string) string { return value })
+	}
+	renderText := func(s string) string {
+		if err != nil {
+			return s
+		}
+		var rendered string
+		if rendered, err = renderTemplate(s, nil, vars, t.Opts.Strict); err != nil {
+			err = fmt.Errorf("template (%s): %w", t.Name, err)
+		}
+		return rendered
+	}
+
+	opts := t.Opts
+	opts.Url = expandFunc(opts.Url, func(value string) string {
+		// Spaces are escaped as %20, which is valid in both the path and the query
+		return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+	})
+	opts.ReplyTo = expand(opts.ReplyTo)
+	opts.TargetTweet = expand(opts.TargetTweet)
+	opts.DedupeKey = expand(opts.DedupeKey)
+
+	if opts.PublishTweetType == PublishTweetTypeFetchJson {
+		opts.Vars = vars
+	} else {
+		opts.Text = renderText(opts.Text)
+		if opts.Texts != nil {
+			opts.Texts = make([]string, len(t.Opts.Texts))
+			for i, text := range t.Opts.Texts {
+				opts.Texts[i] = renderText(text)
+			}
+		}
+		if t.Opts.Poll != nil {
+			poll := *t.Opts.Poll
+			poll.Options = make([]string, len(t.Opts.Poll.Options))
+			for i, option := range t.Opts.Poll.Options {
+				poll.Options[i] = renderText(option)
+			}
+			opts.Poll = &poll
+		}
+	}
+
+	if t.Opts.Fetch != nil {
+		fetch := *t.Opts.Fetch
+		fetch.Body = expand(fetch.Body)
+		if t.Opts.Fetch.Headers != nil {
+			fetch.Headers = make(map[string]string, len(t.Opts.Fetch.Headers))
+			for name, value := range t.Opts.Fetch.Headers {
+				fetch.Headers[name] = expand(value)
+			}
+		}
+		opts.Fetch = &fetch
+	}
+
+	if err != nil {
+		return PublishTweetOpts{}, err
+	}
+
+	if publishOpts.Username != "" {
+		opts.Username = publishOpts.Username
+	}
+	if publishOpts.CallbackUrl != "" {
+		opts.CallbackUrl = publishOpts.CallbackUrl
+	}
+	opts.PublishAt = publishOpts.PublishAt
+
+	return opts, nil
+}
+
+// TweetTemplates manages the tweet templates, which are persisted in its store by name,
+// along with the history of their versions.
+type TweetTemplates struct {
+	client    *TwitterClient
+	templates *Store[TweetTemplate]
+	versions  *Store[TweetTemplateVersion]
+	media     *MediaStore
+	// mu serializes changes, so two templates can't be created with the same name
+	mu sync.Mutex
+}
+
+func newTweetTemplates(client *TwitterClient, templates *Store[TweetTemplate], versions *Store[TweetTemplateVersion], media *MediaStore) *TweetTemplates {
+	return &TweetTemplates{
+		client:    client,
+		templates: templates,
+		versions:  versions,
+		media:     media,
+	}
+}
+
+// newTemplate validates the definition of a template, and applies it to t as its next version.
+func (tt *TweetTemplates) newTemplate(t TweetTemplate, templateOpts TweetTemplateOpts, now time.Time) (TweetTemplate, error) {
+	opts := templateOpts.Opts
+
+	switch opts.PublishTweetType {
+	case PublishTweetTypeText, PublishTweetTypeThread, PublishTweetTypeQuote, PublishTweetTypeRetweet, PublishTweetTypeUnretweet, PublishTweetTypeFetchJson:
+	default:
+		return t, newValidationErr("invalid publishTweetType: %s", opts.PublishTweetType)
+	}
+
+	for _, text := range templateTexts(opts) {
+		if match := templateVarRegexp.FindStringSubmatch(text); match != nil {
+			return t, newValidationErr("texts reference variables as {{ %s.%s }}, not as %s", tmplVarsRef, match[1], match[0])
+		}
+		if _, err := parseTemplate(text); err != nil {
+			return t, err
+		}
+	}
+
+	if opts.PublishAt != nil {
+		return t, newValidationErr("publishAt cannot be used in a template")
+	}
+
+	for name := range templateOpts.Variables {
+		if !templateVarNameRegexp.MatchString(name) {
+			return t, newValidationErr("invalid variable name (%s)", name)
+		}
+	}
+
+	if opts.Username != "" {
+		if _, ok := tt.client.pool.getByUsername(opts.Username); !ok {
+			return t, &NotFoundInPoolError{Username: opts.Username}
+		}
+	}
+
+	media, err := tt.media.persist(opts.Media)
+	if err != nil {
+		return t, err
+	}
+
+	t.Opts = opts
+	t.Opts.Media = media
+	t.Opts.Vars = nil
+	t.Variables = templateOpts.Variables
+	t.Version++
+	t.UpdatedAt = now
+
+	return t, nil
+}
+
+// recordVersion stores the current definition of the template in its history,
+// and removes the oldest versions beyond maxTweetTemplateVersions.
+func (tt *TweetTemplates) recordVersion(t TweetTemplate) error {
+	if err := tt.versions.Set(templateVersionID(t.Name, t.Version), TweetTemplateVersion{
+		Name:      t.Name,
+		Version:   t.Version,
+		Opts:      t.Opts,
+		Variables: t.Variables,
+		CreatedAt: t.UpdatedAt,
+	}); err != nil {
+		return err
+	}
+
+	versions := tt.listVersions(t.Name)
+	if len(versions) <= maxTweetTemplateVersions {
+		return nil
+	}
+
+	stale := map[string]bool{}
+	for _, old := range versions[maxTweetTemplateVersions:] {
+		stale[templateVersionID(old.Name, old.Version)] = true
+	}
+	return tt.versions.DeleteFunc(func(id string, _ TweetTemplateVersion) bool {
+		return stale[id]
+	})
+}
+
+func (tt *TweetTemplates) create(templateOpts TweetTemplateOpts) (TweetTemplate, error) {
+	if !tweetTemplateNameRegexp.MatchString(templateOpts.Name) {
+		return TweetTemplate{}, newValidationErr("invalid template name (%s): must be 1 to 64 letters, numbers, dashes, or underscores", templateOpts.Name)
+	}
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	if _, ok := tt.templates.Get(templateOpts.Name); ok {
+		return TweetTemplate{}, newConflictErr("template (%s) already exists", templateOpts.Name)
+	}
+
+	now := time.Now()
+	t, err := tt.newTemplate(TweetTemplate{Name: templateOpts.Name, CreatedAt: now}, templateOpts, now)
+	if err != nil {
+		return TweetTemplate{}, err
+	}
+
+	// The versions of a deleted template with the same name are replaced, rather than becoming its history
+	if err := tt.deleteVersions(t.Name); err != nil {
+		return TweetTemplate{}, err
+	}
+	if err := tt.recordVersion(t); err != nil {
+		return TweetTemplate{}, err
+	}
+	if err := tt.templates.Set(t.Name, t); err != nil {
+		return TweetTemplate{}, err
+	}
+	return t, nil
+}
+
+func (tt *TweetTemplates) update(name string, templateOpts TweetTemplateOpts) (TweetTemplate, error) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	var updated TweetTemplate
+	ok, err := tt.templates.Update(name, func(t TweetTemplate) (TweetTemplate, error) {
+		if templateOpts.Name != "" && templateOpts.Name != name {
+			return t, newValidationErr("a template cannot be renamed")
+		}
+
+		var err error
+		updated, err = tt.newTemplate(t, templateOpts, time.Now())
+		if err != nil {
+			return t, err
+		}
+		// Recorded first, so that a version that can't be recorded isn't applied either
+		if err := tt.recordVersion(updated); err != nil {
+			return t, err
+		}
+		return updated, nil
+	})
+	if !ok {
+		return TweetTemplate{}, &NotFoundError{Resource: "template", ID: name}
+	}
+	if err != nil {
+		return TweetTemplate{}, err
+	}
+
+	return updated, nil
+}
+
+// restore updates the template to the definition of one of its earlier versions, as a new version,
+// so that the versions after it are kept in the history.
+func (tt *TweetTemplates) restore(name string, version int) (TweetTemplate, error) {
+	v, err := tt.getVersion(name, version)
+	if err != nil {
+		return TweetTemplate{}, err
+	}
+
+	return tt.update(name, TweetTemplateOpts{Opts: v.Opts, Variables: v.Variables})
+}
+
+// delete removes the template and its version history.
+func (tt *TweetTemplates) delete(name string) error {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	ok, err := tt.templates.Delete(name)
+	if !ok {
+		return &NotFoundError{Resource: "template", ID: name}
+	}
+	if err != nil {
+		return err
+	}
+	return tt.deleteVersions(name)
+}
+
+func (tt *TweetTemplates) deleteVersions(name string) error {
+	return tt.versions.DeleteFunc(func(_ string, v TweetTemplateVersion) bool {
+		return v.Name == name
+	})
+}
+
+func (tt *TweetTemplates) get(name string) (TweetTemplate, error) {
+	t, ok := tt.templates.Get(name)
+	if !ok {
+		return TweetTemplate{}, &NotFoundError{Resource: "template", ID: name}
+	}
+	return t, nil
+}
+
+// list returns every template, sorted by name.
+func (tt *TweetTemplates) list() []TweetTemplate {
+	return tt.templates.List()
+}
+
+func (tt *TweetTemplates) getVersion(name string, version int) (TweetTemplateVersion, error) {
+	v, ok := tt.versions.Get(templateVersionID(name, version))
+	if !ok {
+		return TweetTemplateVersion{}, &NotFoundError{Resource: "template version", ID: templateVersionID(name, version)}
+	}
+	return v, nil
+}
+
+// listVersions returns the version history of a template, most recent first.
+func (tt *TweetTemplates) listVersions(name string) []TweetTemplateVersion {
+	versions := []TweetTemplateVersion{}
+	for _, v := range tt.versions.List() {
+		if v.Name == name {
+			versions = append(versions, v)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Version > versions[j].Version
+	})
+	return versions
+}
+
+// render returns the opts to publish the named template with, at its current version unless another is requested.
+// Its stored media is loaded into a copy, so every publish gets its own.
+func (tt *TweetTemplates) render(name string, publishOpts TweetTemplatePublishOpts) (PublishTweetOpts, error) {
+	t, err := tt.get(name)
+	if err != nil {
+		return PublishTweetOpts{}, err
+	}
+
+	if publishOpts.Version != 0 && publishOpts.Version != t.Version {
+		v, err := tt.getVersion(name, publishOpts.Version)
+		if err != nil {
+			return PublishTweetOpts{}, err
+		}
+		t.Opts, t.Variables = v.Opts, v.Variables
+	}
+
+	opts, err := t.render(publishOpts)
+	if err != nil {
+		return PublishTweetOpts{}, err
+	}
+	return tt.media.resolve(opts)
+}
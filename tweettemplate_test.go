@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTweetTemplateRender(t *testing.T) {
+	tmpl := TweetTemplate{
+		Name: "release",
+		Opts: PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              "https://example.com/${repo}/releases?token=${secret:TOKEN}",
+			Text:             "{{ name }} of {{ $vars.repo }} is out",
+			Username:         "alpha",
+			Poll:             &PollOpts{Options: []string{"{{ $vars.repo }}", "other"}, DurationMinutes: 60},
+			Fetch:            &FetchOpts{Headers: map[string]string{"X-Repo": "${repo}"}},
+		},
+		Variables: map[string]string{"repo": "go"},
+	}
+
+	opts, err := tmpl.render(TweetTemplatePublishOpts{})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/go/releases?token=${secret:TOKEN}", opts.Url)
+	assert.Equal(t, "go", opts.Fetch.Headers["X-Repo"])
+	assert.Equal(t, "alpha", opts.Username)
+
+	// The texts of a fetch_json tweet are rendered with the variables once the json is fetched
+	assert.Equal(t, "{{ name }} of {{ $vars.repo }} is out", opts.Text)
+	assert.Equal(t, []string{"{{ $vars.repo }}", "other"}, opts.Poll.Options)
+	assert.Equal(t, map[string]string{"repo": "go"}, opts.Vars)
+
+	opts, err = tmpl.render(TweetTemplatePublishOpts{
+		Variables: map[string]string{"repo": "rust & c++"},
+		Username:  "bravo",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.com/rust%20%26%20c%2B%2B/releases?token=${secret:TOKEN}", opts.Url)
+	assert.Equal(t, "rust & c++", opts.Fetch.Headers["X-Repo"])
+	assert.Equal(t, map[string]string{"repo": "rust & c++"}, opts.Vars)
+	assert.Equal(t, "bravo", opts.Username)
+
+	// Rendering doesn't change the stored template
+	assert.Equal(t, "${repo}", tmpl.Opts.Fetch.Headers["X-Repo"])
+	assert.Nil(t, tmpl.Opts.Vars)
+
+	tmpl.Variables = nil
+	_, err = tmpl.render(TweetTemplatePublishOpts{})
+	assert.IsType(t, &ValidationError{}, err)
+
+	t.Run("Test texts of other tweets", func(t *testing.T) {
+		tmpl := TweetTemplate{
+			Name: "poll",
+			Opts: PublishTweetOpts{
+				PublishTweetType: PublishTweetTypeText,
+				Text:             "Which {{ $vars.thing }}?",
+				Poll:             &PollOpts{Options: []string{"{{ $vars.thing }} A", "{{ $vars.thing }} B"}, DurationMinutes: 60},
+			},
+			Variables: map[string]string{"thing": "{{ secret }}"},
+		}
+
+		opts, err := tmpl.render(TweetTemplatePublishOpts{})
+		assert.Nil(t, err)
+		assert.Equal(t, "Which {{ secret }}?", opts.Text)
+		assert.Equal(t, []string{"{{ secret }} A", "{{ secret }} B"}, opts.Poll.Options)
+		assert.Nil(t, opts.Vars)
+
+		tmpl.Variables = nil
+		_, err = tmpl.render(TweetTemplatePublishOpts{})
+		assert.IsType(t, &ValidationError{}, errors.Unwrap(err))
+	})
+}
+
+func TestTweetTemplates(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"name": "v1.2.0", "repo": r.URL.Query().Get("repo")})
+	}))
+	defer feed.Close()
+
+	published := map[string]string{}
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2/tweets" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.String())
+			return
+		}
+
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		published[*in.Text] = r.Header.Get("X-Test-Username")
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+
+	c := newTestTwitterClient(t, handler, "alpha", "bravo")
+	allowPrivateFetches(c)
+	api := newTestAPI(c)
+
+	templateOpts := TweetTemplateOpts{
+		Name: "release",
+		Opts: PublishTweetOpts{
+			PublishTweetType: PublishTweetTypeFetchJson,
+			Url:              feed.URL + "?repo=${repo}",
+			Text:             "{{ repo }} {{ name }} is out{{ $vars.suffix }}",
+			Username:         "alpha",
+		},
+		Variables: map[string]string{"repo": "go", "suffix": ""},
+	}
+
+	t.Run("Test create", func(t *testing.T) {
+		invalid := []TweetTemplateOpts{
+			{Name: "", Opts: templateOpts.Opts},
+			{Name: "has spaces", Opts: templateOpts.Opts},
+			{Name: "unknown-type", Opts: PublishTweetOpts{PublishTweetType: "unknown"}},
+			{Name: "bad-text", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeFetchJson, Url: feed.URL, Text: "{{ name | }}"}},
+			{Name: "bad-username", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hi", Username: "charlie"}},
+			{Name: "bad-variable", Opts: templateOpts.Opts, Variables: map[string]string{"has-dash": ""}},
+			{Name: "spliced-variable", Opts: PublishTweetOpts{PublishTweetType: PublishTweetTypeText, Text: "hi ${name}"}},
+		}
+		for _, opts := range invalid {
+			w := doTestRequest(api, http.MethodPost, "/api/templates", opts)
+			assert.NotEqual(t, http.StatusOK, w.Code, opts.Name)
+		}
+
+		w := doTestRequest(api, http.MethodPost, "/api/templates", templateOpts)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates", templateOpts)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		tmpl, err := api.templates.get("release")
+		assert.Nil(t, err)
+		assert.Equal(t, 1, tmpl.Version)
+		assert.Len(t, api.templates.list(), 1)
+	})
+
+	t.Run("Test publish", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodPost, "/api/templates/release/publish", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alpha", published["go v1.2.0 is out"])
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/publish", TweetTemplatePublishOpts{
+			Variables: map[string]string{"repo": "rust", "suffix": " #release"},
+			Username:  "bravo",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "bravo", published["rust v1.2.0 is out #release"])
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates/missing/publish", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test update", func(t *testing.T) {
+		updated := templateOpts
+		updated.Opts.Text = "New release: {{ name }} {{ $vars.missing }}"
+
+		w := doTestRequest(api, http.MethodPut, "/api/templates/release", updated)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		tmpl, err := api.templates.get("release")
+		assert.Nil(t, err)
+		assert.Equal(t, 2, tmpl.Version)
+		assert.Equal(t, updated.Opts.Text, tmpl.Opts.Text)
+
+		// The updated text references a variable without a default
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/publish", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/publish", TweetTemplatePublishOpts{
+			Variables: map[string]string{"missing": "(found)"},
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alpha", published["New release: v1.2.0 (found)"])
+
+		updated.Name = "renamed"
+		w = doTestRequest(api, http.MethodPut, "/api/templates/release", updated)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = doTestRequest(api, http.MethodPut, "/api/templates/missing", templateOpts)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test versions", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodGet, "/api/templates/release/versions", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Data []TweetTemplateVersion `json:"data"`
+		}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&resp))
+		assert.Len(t, resp.Data, 2)
+		assert.Equal(t, 2, resp.Data[0].Version)
+		assert.Equal(t, templateOpts.Opts.Text, resp.Data[1].Opts.Text)
+
+		// An earlier version can be published without changing the template
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/publish", TweetTemplatePublishOpts{
+			Variables: map[string]string{"repo": "zig"},
+			Version:   1,
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alpha", published["zig v1.2.0 is out"])
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/publish", TweetTemplatePublishOpts{Version: 5})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// Restoring a version makes it the next version
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/versions/1/restore", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		tmpl, err := api.templates.get("release")
+		assert.Nil(t, err)
+		assert.Equal(t, 3, tmpl.Version)
+		assert.Equal(t, templateOpts.Opts.Text, tmpl.Opts.Text)
+		assert.Len(t, api.templates.listVersions("release"), 3)
+
+		w = doTestRequest(api, http.MethodPost, "/api/templates/release/versions/9/restore", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Test delete", func(t *testing.T) {
+		w := doTestRequest(api, http.MethodDelete, "/api/templates/release", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, api.templates.listVersions("release"))
+
+		w = doTestRequest(api, http.MethodGet, "/api/templates/release", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = doTestRequest(api, http.MethodDelete, "/api/templates/release", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Weighted length configuration, matching version 3 of Twitter's twitter-text library.
+// Every code point has a weight of 2, except for those in the ranges below,
+// which have a weight of 1. URLs always count as the length of a t.co link,
+// and emoji sequences count as 2 no matter how many code points they contain.
+const (
+	maxWeightedTweetLength = 280
+	tcoUrlLength           = 23
+	defaultCharWeight      = 2
+	emojiWeight            = 2
+)
+
+var lightCharRanges = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{Lo: 0x0000, Hi: 0x10FF, Stride: 1},
+		{Lo: 0x2000, Hi: 0x200D, Stride: 1},
+		{Lo: 0x2010, Hi: 0x201F, Stride: 1},
+		{Lo: 0x2032, Hi: 0x2037, Stride: 1},
+	},
+}
+
+var urlRegex = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+[^\s<>".,:;!?)\]'}]`)
+
+// TweetSegment is a run of text that is counted as a single unit,
+// such as a character, a URL, or an emoji sequence.
+// Start and End are rune offsets into the original text.
+type TweetSegment struct {
+	Text   string
+	Start  int
+	End    int
+	Weight int
+}
+
+func isEmojiRune(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) ||
+		(r >= 0x2600 && r <= 0x27BF) ||
+		(r >= 0x1F1E6 && r <= 0x1F1FF)
+}
+
+// isEmojiModifier reports whether r joins onto, or modifies, the emoji before it.
+func isEmojiModifier(r rune) bool {
+	return r == 0x200D || // zero width joiner
+		r == 0xFE0F || // variation selector-16
+		r == 0x20E3 || // combining enclosing keycap
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // skin tones
+		(r >= 0xE0020 && r <= 0xE007F) // tags
+}
+
+func charWeight(r rune) int {
+	if unicode.Is(lightCharRanges, r) {
+		return 1
+	}
+	return defaultCharWeight
+}
+
+// segmentTweetText splits text into the segments used for weighted length counting.
+func segmentTweetText(text string) []TweetSegment {
+	var (
+		runes    = []rune(text)
+		segments = []TweetSegment{}
+		urlSpans = map[int]int{}
+	)
+
+	// Convert the byte offsets of each URL to rune offsets
+	for _, loc := range urlRegex.FindAllStringIndex(text, -1) {
+		start := len([]rune(text[:loc[0]]))
+		end := start + len([]rune(text[loc[0]:loc[1]]))
+		urlSpans[start] = end
+	}
+
+	for i := 0; i < len(runes); {
+		if end, ok := urlSpans[i]; ok {
+			segments = append(segments, TweetSegment{
+				Text:   string(runes[i:end]),
+				Start:  i,
+				End:    end,
+				Weight: tcoUrlLength,
+			})
+			i = end
+			continue
+		}
+
+		r := runes[i]
+		if isEmojiRune(r) {
+			end := i + 1
+			for end < len(runes) {
+				next := runes[end]
+				if isEmojiModifier(next) {
+					end++
+					// A zero width joiner pulls the following emoji into the same sequence
+					if next == 0x200D && end < len(runes) && isEmojiRune(runes[end]) {
+						end++
+					}
+					continue
+				}
+				// Regional indicators come in pairs to form a flag
+				if r >= 0x1F1E6 && r <= 0x1F1FF && end == i+1 && next >= 0x1F1E6 && next <= 0x1F1FF {
+					end++
+					continue
+				}
+				break
+			}
+
+			segments = append(segments, TweetSegment{
+				Text:   string(runes[i:end]),
+				Start:  i,
+				End:    end,
+				Weight: emojiWeight,
+			})
+			i = end
+			continue
+		}
+
+		segments = append(segments, TweetSegment{
+			Text:   string(r),
+			Start:  i,
+			End:    i + 1,
+			Weight: charWeight(r),
+		})
+		i++
+	}
+
+	return segments
+}
+
+// weightedTweetLength returns the length of text as counted by Twitter.
+func weightedTweetLength(text string) int {
+	length := 0
+	for _, segment := range segmentTweetText(text) {
+		length += segment.Weight
+	}
+	return length
+}
+
+func isOverLength(text string) bool {
+	return weightedTweetLength(text) > maxWeightedTweetLength
+}
+
+var sentenceEndRegex = regexp.MustCompile(`[.!?]+["')\]]*\s+`)
+
+// splitSentences splits text after each sentence-ending punctuation mark that is followed by whitespace.
+// Each sentence keeps the whitespace that follows it, so the text can be rejoined as it was written.
+func splitSentences(text string) []string {
+	var (
+		sentences = []string{}
+		last      = 0
+	)
+
+	for _, loc := range sentenceEndRegex.FindAllStringIndex(text, -1) {
+		sentences = append(sentences, text[last:loc[1]])
+		last = loc[1]
+	}
+	if last < len(text) {
+		sentences = append(sentences, text[last:])
+	}
+
+	return sentences
+}
+
+var wordRegex = regexp.MustCompile(`\s*\S+\s*`)
+
+// splitWords splits text into words, each keeping the whitespace around it.
+func splitWords(text string) []string {
+	return wordRegex.FindAllString(text, -1)
+}
+
+// hardSplit splits a single word that is too long to fit in a tweet on its own.
+func hardSplit(word string, budget int) []string {
+	var (
+		parts   = []string{}
+		current = ""
+		length  = 0
+	)
+
+	for _, segment := range segmentTweetText(word) {
+		if length+segment.Weight > budget && current != "" {
+			parts = append(parts, current)
+			current, length = "", 0
+		}
+		current += segment.Text
+		length += segment.Weight
+	}
+	if current != "" {
+		parts = append(parts, current)
+	}
+
+	return parts
+}
+
+// packTweetParts greedily packs units into parts no longer than budget. Units are joined as they are,
+// so the whitespace between them (including line breaks) is kept, and only trimmed at the ends of a part.
+func packTweetParts(units []string, budget int) []string {
+	var (
+		parts   = []string{}
+		current = ""
+	)
+
+	flush := func() {
+		if part := strings.TrimSpace(current); part != "" {
+			parts = append(parts, part)
+		}
+		current = ""
+	}
+
+	for _, unit := range units {
+		if weightedTweetLength(strings.TrimSpace(current+unit)) <= budget {
+			current += unit
+			continue
+		}
+
+		flush()
+
+		if weightedTweetLength(strings.TrimSpace(unit)) <= budget {
+			current = unit
+			continue
+		}
+
+		// The unit doesn't fit in a part on its own, so it is split at smaller boundaries
+		var subParts []string
+		if words := splitWords(unit); len(words) > 1 {
+			subParts = packTweetParts(words, budget)
+		} else {
+			subParts = hardSplit(strings.TrimSpace(unit), budget)
+		}
+		parts = append(parts, subParts[:len(subParts)-1]...)
+		current = subParts[len(subParts)-1]
+	}
+
+	flush()
+
+	return parts
+}
+
+func threadSuffix(i, total int) string {
+	return fmt.Sprintf(" %d/%d", i, total)
+}
+
+// splitTweetText splits text that is too long for a single tweet into a numbered thread,
+// preferring to split between sentences, then between words, and keeping the line breaks of the text.
+// Each part ends with a " i/n" suffix, and fits within the weighted length limit.
+func splitTweetText(text string) []string {
+	text = strings.TrimSpace(text)
+	if !isOverLength(text) {
+		return []string{text}
+	}
+
+	var (
+		sentences = splitSentences(text)
+		total     = 1
+		parts     []string
+	)
+
+	// The length of the suffix depends on the number of parts, so the text is re-split with the budget
+	// of a longer suffix until it fits. The number of parts only grows as the budget shrinks, so once
+	// there are no more parts than the suffix was sized for, every part (and its suffix) fits.
+	for {
+		budget := maxWeightedTweetLength - weightedTweetLength(threadSuffix(total, total))
+		parts = packTweetParts(sentences, budget)
+		if len(parts) <= total {
+			break
+		}
+		total = len(parts)
+	}
+
+	for i := range parts {
+		parts[i] += threadSuffix(i+1, len(parts))
+	}
+
+	return parts
+}
+
+// Local limits on the number of entities in a tweet.
+// Tweets with more than this are very likely to be flagged as spam.
+const (
+	maxTweetMentions = 10
+	maxTweetHashtags = 10
+)
+
+var (
+	mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@＠])([@＠][A-Za-z0-9_]{1,15})`)
+	hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#＃])([#＃][\p{L}\p{N}_]*[\p{L}_][\p{L}\p{N}_]*)`)
+)
+
+// isDisallowedRune reports whether r is a control character or
+// one of the characters that Twitter rejects in tweet text.
+func isDisallowedRune(r rune) bool {
+	switch r {
+	case '\t', '\n', '\r':
+		return false
+	case 0xFFFE, 0xFEFF, 0xFFFF:
+		return true
+	}
+	return unicode.IsControl(r) || (r >= 0x202A && r <= 0x202E)
+}
+
+// TweetTextInfo describes the text of a tweet that failed validation.
+// Range holds the rune offsets [start, end) of the offending part of the text.
+type TweetTextInfo struct {
+	WeightedLength int    `json:"weightedLength"`
+	MaxLength      int    `json:"maxLength"`
+	Range          [2]int `json:"range"`
+}
+
+type TweetTextError struct {
+	Msg string
+	TweetTextInfo
+}
+
+func (e *TweetTextError) Error() string {
+	return fmt.Sprintf("invalid tweet text: %s", e.Msg)
+}
+
+// runeRange converts a byte range of text to a rune range.
+func runeRange(text string, start, end int) [2]int {
+	runeStart := len([]rune(text[:start]))
+	return [2]int{runeStart, runeStart + len([]rune(text[start:end]))}
+}
+
+// validateTweetText checks text against Twitter's rules before it is sent to the Twitter API.
+func validateTweetText(text string) error {
+	var (
+		segments = segmentTweetText(text)
+		length   = 0
+		info     = TweetTextInfo{MaxLength: maxWeightedTweetLength}
+	)
+
+	for _, segment := range segments {
+		length += segment.Weight
+	}
+	info.WeightedLength = length
+
+	if strings.TrimSpace(text) == "" {
+		return newValidationErr("tweet text cannot be an empty string")
+	}
+
+	for i, r := range []rune(text) {
+		if isDisallowedRune(r) {
+			info.Range = [2]int{i, i + 1}
+			return &TweetTextError{
+				Msg:           fmt.Sprintf("disallowed character (%U) at position (%d)", r, i),
+				TweetTextInfo: info,
+			}
+		}
+	}
+
+	if length > maxWeightedTweetLength {
+		total := 0
+		for _, segment := range segments {
+			total += segment.Weight
+			if total > maxWeightedTweetLength {
+				info.Range = [2]int{segment.Start, segments[len(segments)-1].End}
+				break
+			}
+		}
+		return &TweetTextError{
+			Msg:           fmt.Sprintf("weighted length (%d) exceeds the maximum of (%d)", length, maxWeightedTweetLength),
+			TweetTextInfo: info,
+		}
+	}
+
+	if locs := mentionRegex.FindAllStringSubmatchIndex(text, -1); len(locs) > maxTweetMentions {
+		loc := locs[maxTweetMentions]
+		info.Range = runeRange(text, loc[2], loc[3])
+		return &TweetTextError{
+			Msg:           fmt.Sprintf("(%d) mentions exceeds the maximum of (%d)", len(locs), maxTweetMentions),
+			TweetTextInfo: info,
+		}
+	}
+
+	if locs := hashtagRegex.FindAllStringSubmatchIndex(text, -1); len(locs) > maxTweetHashtags {
+		loc := locs[maxTweetHashtags]
+		info.Range = runeRange(text, loc[2], loc[3])
+		return &TweetTextError{
+			Msg:           fmt.Sprintf("(%d) hashtags exceeds the maximum of (%d)", len(locs), maxTweetHashtags),
+			TweetTextInfo: info,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightedTweetLength(t *testing.T) {
+	type WeightedTweetLengthTest struct {
+		text     string
+		expected int
+	}
+
+	tests := []WeightedTweetLengthTest{
+		// Empty string
+		{
+			text:     "",
+			expected: 0,
+		},
+
+		// Latin characters
+		{
+			text:     "hello world",
+			expected: 11,
+		},
+		{
+			text:     "café – “quoted”",
+			expected: 15,
+		},
+
+		// CJK characters
+		{
+			text:     "こんにちは",
+			expected: 10,
+		},
+
+		// URLs
+		{
+			text:     "https://example.com/a/very/long/path/that/is/longer/than/a/tco/link",
+			expected: 23,
+		},
+		{
+			text:     "read this: https://example.com.",
+			expected: 11 + 23 + 1,
+		},
+
+		// Emoji
+		{
+			text:     "😀",
+			expected: 2,
+		},
+		{
+			text:     "👍🏽",
+			expected: 2,
+		},
+		{
+			text:     "👨‍👩‍👧",
+			expected: 2,
+		},
+		{
+			text:     "🇺🇸🇯🇵",
+			expected: 4,
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, weightedTweetLength(test.text), test.text)
+	}
+}
+
+func TestSplitTweetText(t *testing.T) {
+	t.Run("Test short text", func(t *testing.T) {
+		assert.Equal(t, []string{"short text"}, splitTweetText(" short text "))
+	})
+
+	t.Run("Test sentence boundaries", func(t *testing.T) {
+		sentence := strings.Repeat("word ", 20) + "end."
+		text := strings.Repeat(sentence+" ", 5)
+
+		parts := splitTweetText(text)
+		assert.Equal(t, 3, len(parts))
+		for i, part := range parts {
+			assert.LessOrEqual(t, weightedTweetLength(part), maxWeightedTweetLength)
+			assert.True(t, strings.HasSuffix(part, threadSuffix(i+1, len(parts))))
+			assert.True(t, strings.HasSuffix(strings.TrimSuffix(part, threadSuffix(i+1, len(parts))), "end."))
+		}
+	})
+
+	t.Run("Test word boundaries", func(t *testing.T) {
+		text := strings.Repeat("lorem ipsum ", 100)
+
+		parts := splitTweetText(text)
+		rejoined := []string{}
+		for i, part := range parts {
+			assert.LessOrEqual(t, weightedTweetLength(part), maxWeightedTweetLength)
+			rejoined = append(rejoined, strings.TrimSuffix(part, threadSuffix(i+1, len(parts))))
+		}
+		assert.Equal(t, strings.TrimSpace(text), strings.Join(rejoined, " "))
+	})
+
+	t.Run("Test line breaks", func(t *testing.T) {
+		paragraph := strings.Repeat("word ", 20) + "end.\n\n- first item\n- second item"
+		text := strings.Repeat(paragraph+"\n\n", 4)
+
+		parts := splitTweetText(text)
+		assert.Greater(t, len(parts), 1)
+		for i, part := range parts {
+			assert.LessOrEqual(t, weightedTweetLength(part), maxWeightedTweetLength)
+			part = strings.TrimSuffix(part, threadSuffix(i+1, len(parts)))
+			assert.Contains(t, text, part)
+			assert.Contains(t, part, "- first item\n- second item")
+		}
+	})
+
+	t.Run("Test parts fit when the suffix grows", func(t *testing.T) {
+		// Enough parts that the suffix grows from " i/n" to " i/nn"
+		text := strings.Repeat("abcdefghi ", 27*9+5)
+
+		parts := splitTweetText(text)
+		assert.GreaterOrEqual(t, len(parts), 10)
+		for _, part := range parts {
+			assert.LessOrEqual(t, weightedTweetLength(part), maxWeightedTweetLength)
+		}
+	})
+
+	t.Run("Test long words", func(t *testing.T) {
+		text := strings.Repeat("x", 700)
+
+		parts := splitTweetText(text)
+		assert.Equal(t, 3, len(parts))
+		for _, part := range parts {
+			assert.LessOrEqual(t, weightedTweetLength(part), maxWeightedTweetLength)
+		}
+	})
+}
+
+func TestValidateTweetText(t *testing.T) {
+	type ValidateTweetTextTest struct {
+		text          string
+		shouldErr     bool
+		expectedRange [2]int
+	}
+
+	var repeatEntity = func(sigil string, n int) string {
+		entities := []string{}
+		for i := 0; i < n; i++ {
+			entities = append(entities, sigil+string(rune('a'+i)))
+		}
+		return strings.Join(entities, " ")
+	}
+
+	tests := []ValidateTweetTextTest{
+		// Valid text
+		{
+			text:      "hello world #golang @someone",
+			shouldErr: false,
+		},
+		{
+			text:      "line one\nline two\ttabbed",
+			shouldErr: false,
+		},
+		{
+			text:      strings.Repeat("a", maxWeightedTweetLength),
+			shouldErr: false,
+		},
+
+		// Empty text
+		{
+			text:      " ",
+			shouldErr: true,
+		},
+
+		// Over-length text
+		{
+			text:          strings.Repeat("a", maxWeightedTweetLength+5),
+			shouldErr:     true,
+			expectedRange: [2]int{maxWeightedTweetLength, maxWeightedTweetLength + 5},
+		},
+		{
+			text:          strings.Repeat("あ", 145),
+			shouldErr:     true,
+			expectedRange: [2]int{140, 145},
+		},
+
+		// Disallowed characters
+		{
+			text:          "bad\x00char",
+			shouldErr:     true,
+			expectedRange: [2]int{3, 4},
+		},
+		{
+			text:          "bidi ‮override",
+			shouldErr:     true,
+			expectedRange: [2]int{5, 6},
+		},
+
+		// Too many entities
+		{
+			text:      repeatEntity("@", maxTweetMentions),
+			shouldErr: false,
+		},
+		{
+			text:          repeatEntity("@", maxTweetMentions+1),
+			shouldErr:     true,
+			expectedRange: [2]int{30, 32},
+		},
+		{
+			text:          repeatEntity("#", maxTweetHashtags+1),
+			shouldErr:     true,
+			expectedRange: [2]int{30, 32},
+		},
+	}
+
+	for _, test := range tests {
+		err := validateTweetText(test.text)
+		if !test.shouldErr {
+			assert.Nil(t, err, test.text)
+			continue
+		}
+
+		assert.NotNil(t, err, test.text)
+
+		var textErr *TweetTextError
+		if errors.As(err, &textErr) {
+			assert.Equal(t, test.expectedRange, textErr.Range, test.text)
+			assert.Equal(t, weightedTweetLength(test.text), textErr.WeightedLength)
+		}
+	}
+}
@@ -9,10 +9,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"time"
 
-	"github.com/EricFrancis12/stripol"
 	"github.com/michimani/gotwi"
 	"github.com/michimani/gotwi/fields"
 	"github.com/michimani/gotwi/tweet/managetweet"
@@ -29,6 +28,7 @@ type TwitterAPICreds struct {
 	APIKeySecret     string
 	OAuthToken       string
 	OAuthTokenSecret string
+	Weight           int
 }
 
 func (tac TwitterAPICreds) isValid() bool {
@@ -48,95 +48,85 @@ func (tac TwitterAPICreds) String() string {
 type PublishTweetOpts struct {
 	PublishTweetType PublishTweetType `json:"publishTweetType"`
 	Text             string           `json:"text"`
+	Texts            []string         `json:"texts"`
 	ReplyTo          string           `json:"replyTo"`
 	Url              string           `json:"url"`
 	Username         string           `json:"username"`
+	AutoThread       bool             `json:"autoThread"`
+	Media            []*MediaOpts     `json:"media"`
+	Poll             *PollOpts        `json:"poll"`
+	TargetTweet      string           `json:"targetTweet"`
+	PublishAt        *time.Time       `json:"publishAt,omitempty"`
+	DedupeKey        string           `json:"dedupeKey"`
+	CallbackUrl      string           `json:"callbackUrl"`
+	Fetch            *FetchOpts       `json:"fetch"`
+	// Strict makes a |* fn(args) *| call that can't be evaluated an error, instead of publishing it as written
+	Strict bool `json:"strict,omitempty"`
+	// Vars are the variables of a named template, which the text and poll options of a fetch_json tweet
+	// reference as {{ $vars.name }}
+	Vars map[string]string `json:"vars,omitempty"`
 }
 
 func (o PublishTweetOpts) handleFetchJsonResp(resp *http.Response) (string, error) {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return "", &FetchError{Url: o.Url, Err: err}
 	}
 
+	var data interface{}
+	if o.Text != "" {
+		if data, err = o.decodeFetchJsonBody(body); err != nil {
+			return "", err
+		}
+	}
+
+	return o.renderFetchJsonText(body, data)
+}
+
+// renderFetchJsonText renders the text of a fetch_json tweet against the data decoded from the fetched body,
+// or returns the body as-is if the tweet has no text.
+func (o PublishTweetOpts) renderFetchJsonText(body []byte, data interface{}) (string, error) {
 	if o.Text == "" {
 		return string(body), nil
 	}
 
+	return renderTemplate(o.Text, data, o.Vars, o.Strict)
+}
+
+func (o PublishTweetOpts) decodeFetchJsonBody(body []byte) (interface{}, error) {
 	var data interface{}
 	d := json.NewDecoder(bytes.NewReader(body))
 	d.UseNumber()
 	if err := d.Decode(&data); err != nil {
-		return "", err
-	}
-
-	var (
-		level = data
-		text  = o.Text
-		ipol  = stripol.New("{*{", "}*}")
-	)
-
-	for _, jsonFmt := range o.JsonFmts() {
-		keys := strings.Split(jsonFmt, ".")
-		for _, key := range keys {
-			m, ok := level.(map[string]interface{})
-			if !ok {
-				return "", errors.New("invalid jsonFmt A")
-			}
-
-			if level, ok = m[key]; !ok {
-				return "", errors.New("invalid jsonFmt B")
-			}
-		}
-
-		var s string
-
-		switch d := level.(type) {
-		case string:
-			s = d
-		case int64:
-			s = fmt.Sprintf("%d", d)
-		case float64:
-			s = fmt.Sprintf("%f", d)
-		case bool:
-			s = strconv.FormatBool(d)
-		default:
-			b, err := json.Marshal(level)
-			if err != nil {
-				return "", err
-			}
-			s = string(b)
-		}
-
-		ipol.RegisterVar(jsonFmt, s)
-		level = data
+		return nil, &FetchError{Url: o.Url, Err: fmt.Errorf("response body is not valid json: %w", err)}
 	}
-
-	f := newFuncIpol("|*", "*|")
-	f.RegisterFn("pathEscape", func(args ...string) (string, error) {
-		if len(args) != 1 {
-			return "", fmt.Errorf("pathEscape requires 1 argument, but got (%d) arguments instead", len(args))
-		}
-
-		return url.PathEscape(args[0]), nil
-	})
-
-	return f.Eval(ipol.Eval(text))
+	return data, nil
 }
 
 func (o PublishTweetOpts) getReplyToTweetID() (string, error) {
 	if o.ReplyTo == "" {
-		return "", errors.New("replyTo is an empty string")
+		return "", newValidationErr("replyTo is an empty string")
 	}
+	return parseTweetID(o.ReplyTo)
+}
 
-	tweetID := o.ReplyTo
+func (o PublishTweetOpts) getTargetTweetID() (string, error) {
+	if o.TargetTweet == "" {
+		return "", newValidationErr("targetTweet is required for publishTweetType (%s)", o.PublishTweetType)
+	}
+	return parseTweetID(o.TargetTweet)
+}
+
+// parseTweetID returns the tweet ID from either a tweet ID, or a tweet url.
+func parseTweetID(s string) (string, error) {
+	tweetID := s
 
-	parsedURL, err := url.Parse(o.ReplyTo)
+	parsedURL, err := url.Parse(s)
 	if err == nil {
 		path := remSuffixIfExists(parsedURL.Path, "/")
 		parts := strings.Split(path, "/")
 		if len(parts) < 1 {
-			return "", fmt.Errorf("expected length of at least 1, but got: %d", len(parts))
+			return "", newValidationErr("expected length of at least 1, but got: %d", len(parts))
 		}
 		tweetID = parts[len(parts)-1]
 	}
@@ -158,7 +148,11 @@ func (o PublishTweetOpts) validUrl() bool {
 }
 
 func (o PublishTweetOpts) JsonFmts() []string {
-	partsA := strings.Split(o.Text, "{*{")
+	return jsonFmts(o.Text)
+}
+
+func jsonFmts(text string) []string {
+	partsA := strings.Split(text, "{*{")
 	if len(partsA) == 0 {
 		return []string{}
 	}
@@ -180,24 +174,44 @@ func (o PublishTweetOpts) JsonFmts() []string {
 
 func (o PublishTweetOpts) String() string {
 	return fmt.Sprintf(
-		"PublishTweetOpts{ PublishTweetType: %s, Text: %s, ReplyTo: %s, Url: %s }",
+		"PublishTweetOpts{ PublishTweetType: %s, Text: %s, Texts: %q, ReplyTo: %s, Url: %s, AutoThread: %t, Media: %v, Poll: %v, TargetTweet: %s, PublishAt: %v, DedupeKey: %s, CallbackUrl: %s, Fetch: %s }",
 		o.PublishTweetType,
 		o.Text,
+		o.Texts,
 		o.ReplyTo,
 		o.Url,
+		o.AutoThread,
+		o.Media,
+		o.Poll,
+		o.TargetTweet,
+		o.PublishAt,
+		o.DedupeKey,
+		o.CallbackUrl,
+		o.Fetch.String(),
 	)
 }
 
 type TwitterClient struct {
-	clients map[TwitterAPICreds]*gotwi.Client
+	pool          *ClientPool
+	published     *Store[PublishedTweet]
+	contentHashes *Store[ContentHash]
+	dedupeWindow  time.Duration
+	webhooks      *Webhooks
+	// fetcher makes every request to a caller-provided url
+	fetcher *Fetcher
+	*Logger
 }
 
-func newTwitterClient(creds []TwitterAPICreds) (*TwitterClient, error) {
+func newTwitterClient(creds []TwitterAPICreds, strategy ClientSelectionStrategy) (*TwitterClient, error) {
 	if len(creds) == 0 {
 		return nil, errors.New("at least (1) Twitter API Cred is required")
 	}
 
-	var clients = make(map[TwitterAPICreds]*gotwi.Client)
+	if !strategy.isValid() {
+		return nil, fmt.Errorf("invalid client selection strategy: %s", strategy)
+	}
+
+	var clients = []*PoolClient{}
 	for _, cred := range creds {
 		if !cred.isValid() {
 			return nil, fmt.Errorf("invalid Twitter API cred: %s", cred.String())
@@ -215,173 +229,499 @@ func newTwitterClient(creds []TwitterAPICreds) (*TwitterClient, error) {
 			return nil, err
 		}
 
-		clients[cred] = client
+		clients = append(clients, &PoolClient{
+			creds:  cred,
+			client: client,
+		})
 	}
 
 	return &TwitterClient{
-		clients: clients,
+		pool:    newClientPool(clients, strategy),
+		fetcher: newFetcher(defaultFetchConfig()),
+		Logger:  newLogger(),
 	}, nil
 }
 
-func (c *TwitterClient) getClientByUsername(username string) (*gotwi.Client, bool) {
-	if username == "" {
-		return nil, false
+// doWithPool calls fn with the client belonging to username, or if username is empty,
+// with each client in the pool (in the order chosen by the selection strategy) until one isn't rate-limited.
+// Clients that are cooling down from a previous rate limit on the endpoint are skipped.
+// fn can call doWithPool for another endpoint with the same client (ex: to upload media before creating a tweet),
+// in which case a rate limit is recorded against that endpoint only.
+func doWithPool[T any](c *TwitterClient, endpoint TwitterEndpoint, username string, fn func(pc *PoolClient) (T, error)) (T, error) {
+	var zero T
+
+	if username != "" {
+		pc, ok := c.pool.getByUsername(username)
+		if !ok {
+			return zero, &NotFoundInPoolError{Username: username}
+		}
+
+		if resetAt, ok := c.pool.cooldownUntil(pc, endpoint, time.Now()); ok {
+			return zero, &RateLimitedError{Endpoint: endpoint, Clients: 1, ResetAt: resetAt}
+		}
+
+		c.pool.markUsed(pc)
+		output, err := fn(pc)
+		if rateLimitedErr, ok := c.recordPoolRateLimit(pc, endpoint, err); ok {
+			return zero, rateLimitedErr
+		}
+		return output, err
 	}
 
-	for cred, client := range c.clients {
-		if cred.Username == username {
-			return client, true
+	var (
+		earliestReset    time.Time
+		earliestEndpoint = endpoint
+	)
+	var updateEarliestReset = func(endpoint TwitterEndpoint, resetAt time.Time) {
+		if earliestReset.IsZero() || resetAt.Before(earliestReset) {
+			earliestReset = resetAt
+			earliestEndpoint = endpoint
+		}
+	}
+
+	for _, pc := range c.pool.ordered() {
+		if resetAt, ok := c.pool.cooldownUntil(pc, endpoint, time.Now()); ok {
+			updateEarliestReset(endpoint, resetAt)
+			continue
+		}
+
+		c.pool.markUsed(pc)
+		output, err := fn(pc)
+		if err == nil {
+			return output, nil
+		}
+
+		rateLimitedErr, ok := c.recordPoolRateLimit(pc, endpoint, err)
+		if !ok {
+			return zero, err
 		}
+		updateEarliestReset(rateLimitedErr.Endpoint, rateLimitedErr.ResetAt)
 	}
 
-	return nil, false
+	return zero, &RateLimitedError{
+		Endpoint: earliestEndpoint,
+		Clients:  c.pool.len(),
+		ResetAt:  earliestReset,
+	}
 }
 
-func (c *TwitterClient) doCreate(username string, p *managetweetTypes.CreateInput) (*managetweetTypes.CreateOutput, error) {
-	if username != "" {
-		if client, ok := c.getClientByUsername(username); ok {
-			return managetweet.Create(context.Background(), client, p)
+// recordPoolRateLimit records the rate limit of the client on the endpoint, if err was caused by one,
+// and returns it as a *RateLimitedError. A *RateLimitedError returned by a nested doWithPool call
+// was already recorded against its own endpoint, so it is returned as-is.
+func (c *TwitterClient) recordPoolRateLimit(pc *PoolClient, endpoint TwitterEndpoint, err error) (*RateLimitedError, bool) {
+	var rateLimitedErr *RateLimitedError
+	if errors.As(err, &rateLimitedErr) {
+		return rateLimitedErr, true
+	}
+
+	state, ok := c.pool.recordRateLimit(pc, endpoint, err, time.Now())
+	if !ok {
+		return nil, false
+	}
+	return &RateLimitedError{Endpoint: endpoint, Clients: 1, ResetAt: state.ResetAt}, true
+}
+
+// PublishTweetResult is the output of publishing one or more tweets.
+// The embedded CreateOutput holds the first tweet published, so a single tweet
+// is reported in the same shape as the Twitter API's own response.
+type PublishTweetResult struct {
+	*managetweetTypes.CreateOutput
+	Username  string                           `json:"username,omitempty"`
+	Thread    []*managetweetTypes.CreateOutput `json:"thread,omitempty"`
+	Retweeted *bool                            `json:"retweeted,omitempty"`
+	TweetID   string                           `json:"tweetID,omitempty"`
+	// Skipped is the reason nothing was published (ex: "duplicate"),
+	// and DuplicateOf is the ID of the tweet that already published the same content
+	Skipped     string `json:"skipped,omitempty"`
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+func (r *PublishTweetResult) TweetIDs() []string {
+	if len(r.Thread) > 0 {
+		ids := []string{}
+		for _, output := range r.Thread {
+			ids = append(ids, *output.Data.ID)
 		}
-		return nil, fmt.Errorf("username (%s) not found in client pool", username)
+		return ids
 	}
 
-	for _, client := range c.clients {
-		output, err := managetweet.Create(context.Background(), client, p)
-		if err == nil {
-			return output, nil
-		} else if !isRateLimitErr(err) {
-			return nil, fmt.Errorf("error publishing tweet ( %s ): %s", *p.Text, err.Error())
+	if r.CreateOutput != nil {
+		return []string{*r.Data.ID}
+	}
+
+	return []string{}
+}
+
+func (r *PublishTweetResult) String() string {
+	switch {
+	case r.Skipped != "":
+		return fmt.Sprintf("Skipped publishing from (%s): %s of Tweet (%s)", r.Username, r.Skipped, r.DuplicateOf)
+	case r.Retweeted != nil && *r.Retweeted:
+		return fmt.Sprintf("Retweeted Tweet (%s) from (%s)", r.TweetID, r.Username)
+	case r.Retweeted != nil:
+		return fmt.Sprintf("Unretweeted Tweet (%s) from (%s)", r.TweetID, r.Username)
+	case len(r.Thread) > 0:
+		return fmt.Sprintf("Published new thread of (%d) Tweets (%s) from (%s)", len(r.Thread), strings.Join(r.TweetIDs(), ", "), r.Username)
+	case r.CreateOutput != nil:
+		return fmt.Sprintf("Published new Tweet (%s) from (%s): %s", gotwi.StringValue(r.Data.ID), r.Username, gotwi.StringValue(r.Data.Text))
+	}
+	return "PublishTweetResult{}"
+}
+
+// doCreate publishes the tweet, and returns the username of the client that published it.
+// Media is uploaded with the same client that publishes the tweet, because media IDs belong to a single account.
+// If contentHash isn't empty, a *DuplicateContentError is returned when the client already published the same content.
+func (c *TwitterClient) doCreate(username string, p *managetweetTypes.CreateInput, media []*MediaOpts, contentHash string) (*managetweetTypes.CreateOutput, string, error) {
+	var usedUsername string
+	output, err := doWithPool(c, TwitterEndpointCreateTweet, username, func(pc *PoolClient) (*managetweetTypes.CreateOutput, error) {
+		usedUsername = pc.creds.Username
+
+		if dupErr, ok := c.findDuplicate(pc.creds.Username, contentHash, time.Now()); ok {
+			return nil, dupErr
+		}
+
+		if len(media) > 0 {
+			// Uploads are rate-limited separately from creating tweets
+			mediaIDs, err := doWithPool(c, TwitterEndpointMediaUpload, pc.creds.Username, func(pc *PoolClient) ([]string, error) {
+				return uploadAllMedia(pc.client, c.fetcher, media)
+			})
+			if err != nil {
+				return nil, err
+			}
+			p.Media = &managetweetTypes.CreateInputMedia{
+				MediaIDs: mediaIDs,
+			}
 		}
+
+		return managetweet.Create(context.Background(), pc.client, p)
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating tweet ( %s ): %w", gotwi.StringValue(p.Text), err)
 	}
 
-	return nil, fmt.Errorf(
-		"error creating tweet ( %s ): all %d Twitter clients were rate-limited",
-		*p.Text,
-		len(c.clients),
-	)
+	// The tweet is already live, so failing to record it (or its content) is only logged.
+	// Returning an error would make the caller retry, and publish the tweet a second time.
+	if err := c.recordPublished(output, usedUsername); err != nil {
+		c.LogErr(fmt.Errorf("error recording published tweet (%s): %w", gotwi.StringValue(output.Data.ID), err))
+	}
+
+	if err := c.recordContentHash(usedUsername, contentHash, gotwi.StringValue(output.Data.ID), time.Now()); err != nil {
+		c.LogErr(fmt.Errorf("error recording published content of tweet (%s): %w", gotwi.StringValue(output.Data.ID), err))
+	}
+
+	return output, usedUsername, nil
+}
+
+func (c *TwitterClient) doCreateResult(username string, p *managetweetTypes.CreateInput, media []*MediaOpts, contentHash string) (*PublishTweetResult, error) {
+	output, usedUsername, err := c.doCreate(username, p, media, contentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PublishTweetResult{
+		CreateOutput: output,
+		Username:     usedUsername,
+	}, nil
 }
 
-func (c *TwitterClient) publishTweetSingle(username, text string) (*managetweetTypes.CreateOutput, error) {
-	p := &managetweetTypes.CreateInput{
-		Text: gotwi.String(text),
+// newCreateInput returns the input for creating a tweet, omitting the text if it is empty (ex: a media-only tweet).
+func newCreateInput(text string) *managetweetTypes.CreateInput {
+	p := &managetweetTypes.CreateInput{}
+	if text != "" {
+		p.Text = gotwi.String(text)
 	}
-	return c.doCreate(username, p)
+	return p
 }
 
-func (c *TwitterClient) publishTweetReply(username, text, tweetID string) (*managetweetTypes.CreateOutput, error) {
-	p := &managetweetTypes.CreateInput{
-		Text: gotwi.String(text),
-		Reply: &managetweetTypes.CreateInputReply{
-			InReplyToTweetID: tweetID,
-		},
+// RenderedTweet is the result of resolving PublishTweetOpts into the tweet(s) that will be published.
+// More than one text means the tweets are published as a thread.
+type RenderedTweet struct {
+	PublishTweetType PublishTweetType
+	Texts            []string
+	ReplyToTweetID   string
+	TargetTweetID    string
+	Poll             *PollOpts
+	Media            []*MediaOpts
+	// ContentHash identifies the content for duplicate suppression, and is empty if it shouldn't be checked
+	ContentHash string
+}
+
+// render fetches and renders everything needed to publish the tweet(s) described by opts,
+// and validates the result without calling the Twitter API.
+func (o PublishTweetOpts) render(f *Fetcher) (*RenderedTweet, error) {
+	rendered, _, err := o.build(f)
+	if err != nil {
+		return nil, err
 	}
-	return c.doCreate(username, p)
+
+	if err := rendered.validate(); err != nil {
+		return nil, err
+	}
+	return rendered, nil
 }
 
-func (c *TwitterClient) publishTweet(opts PublishTweetOpts) (*managetweetTypes.CreateOutput, error) {
-	var text = ""
-	switch opts.PublishTweetType {
+// prepare validates the opts of a tweet that is published later (scheduled, queued, or by a recurring job),
+// and returns a copy whose media is moved into the media store, so that it can be saved as json.
+// Tweets that don't depend on fetched data are rendered now, so that invalid tweets are rejected
+// immediately instead of failing when they are published.
+func (o PublishTweetOpts) prepare(f *Fetcher, media *MediaStore) (PublishTweetOpts, error) {
+	if o.PublishTweetType != PublishTweetTypeFetchJson {
+		if _, err := o.render(f); err != nil {
+			return o, err
+		}
+	}
+
+	persisted, err := media.persist(o.Media)
+	if err != nil {
+		return o, err
+	}
+	o.Media = persisted
+	return o, nil
+}
+
+// build fetches and renders the tweet(s) described by opts, without validating the rendered texts.
+// The decoded json of a fetch_json tweet is returned alongside, if it was needed to render the tweet.
+func (o PublishTweetOpts) build(f *Fetcher) (*RenderedTweet, interface{}, error) {
+	if o.CallbackUrl != "" {
+		if err := checkCallbackUrl(f, o.CallbackUrl); err != nil {
+			return nil, nil, newValidationErr("invalid callbackUrl (%s): %s", o.CallbackUrl, err.Error())
+		}
+	}
+
+	if err := loadMedia(f, o.Media); err != nil {
+		return nil, nil, err
+	}
+
+	rendered := &RenderedTweet{
+		PublishTweetType: o.PublishTweetType,
+		Poll:             o.Poll,
+		Media:            o.Media,
+	}
+	dedupeKey := o.DedupeKey
+	var data interface{}
+
+	switch o.PublishTweetType {
 	case PublishTweetTypeText:
-		text = opts.Text
+		rendered.Texts = []string{o.Text}
+	case PublishTweetTypeThread:
+		rendered.Texts = o.Texts
+	case PublishTweetTypeQuote:
+		rendered.Texts = []string{o.Text}
+		tweetID, err := o.getTargetTweetID()
+		if err != nil {
+			return nil, nil, err
+		}
+		rendered.TargetTweetID = tweetID
+	case PublishTweetTypeRetweet, PublishTweetTypeUnretweet:
+		// Only the account that retweeted can undo it, so it can't be left to the client pool to choose
+		if o.PublishTweetType == PublishTweetTypeUnretweet && o.Username == "" {
+			return nil, nil, newValidationErr("username is required to unretweet")
+		}
+
+		tweetID, err := o.getTargetTweetID()
+		if err != nil {
+			return nil, nil, err
+		}
+		rendered.TargetTweetID = tweetID
+		return rendered, nil, nil
 	case PublishTweetTypeFetchJson:
-		if !opts.validUrl() {
-			return nil, fmt.Errorf("invalid url: %s", opts.Url)
+		if !o.validUrl() {
+			return nil, nil, newValidationErr("invalid url: %s", o.Url)
 		}
 
-		resp, err := http.Get(opts.Url)
+		// The dedupe key of a fetch_json tweet is a path of the fetched data (ex: an item id)
+		var dedupePath *jsonPath
+		if o.DedupeKey != "" {
+			p, err := parseJsonPath(o.DedupeKey)
+			if err != nil {
+				return nil, nil, fmt.Errorf("dedupeKey: %w", err)
+			}
+			dedupePath = p
+		}
+
+		body, err := o.fetch(f)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+
+		// The body is decoded once, and only if something is rendered against it
+		if o.Text != "" || o.Poll != nil || o.DedupeKey != "" {
+			if data, err = o.decodeFetchJsonBody(body); err != nil {
+				return nil, nil, err
+			}
 		}
 
-		text, err = opts.handleFetchJsonResp(resp)
+		text, err := o.renderFetchJsonText(body, data)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		defer resp.Body.Close()
-	}
+		rendered.Texts = []string{text}
 
-	if text == "" {
-		return nil, errors.New("tweet text cannot be an empty string")
+		if o.Poll != nil {
+			if rendered.Poll, err = o.Poll.render(data, o.Vars, o.Strict); err != nil {
+				return nil, nil, err
+			}
+		}
+		if dedupePath != nil {
+			value, selected, err := dedupePath.get(data)
+			if err == nil {
+				dedupeKey, err = tmplValue{value: value, selected: selected, sep: dedupePath.sep}.string()
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("dedupeKey: %w", err)
+			}
+		}
+	default:
+		return nil, nil, newValidationErr("invalid publishTweetType: %s", o.PublishTweetType)
 	}
 
-	if opts.validReplyTo() {
-		tweetID, err := opts.getReplyToTweetID()
+	if o.ReplyTo != "" {
+		tweetID, err := o.getReplyToTweetID()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return c.publishTweetReply(opts.Username, text, tweetID)
+		rendered.ReplyToTweetID = tweetID
+	}
+
+	if o.AutoThread && len(rendered.Texts) == 1 && isOverLength(rendered.Texts[0]) {
+		rendered.Texts = splitTweetText(rendered.Texts[0])
 	}
 
-	return c.publishTweetSingle(opts.Username, text)
+	rendered.ContentHash = contentHashOf(rendered, dedupeKey)
+	return rendered, data, nil
 }
 
-func (c *TwitterClient) getUserByUsername(username, targetUsername string) (*userlookupTypes.GetByUsernameOutput, error) {
-	if targetUsername == "" {
-		return nil, errors.New("missing targetUsername")
+func (r *RenderedTweet) isThread() bool {
+	return len(r.Texts) > 1
+}
+
+func (r *RenderedTweet) validate() error {
+	switch r.PublishTweetType {
+	case PublishTweetTypeRetweet, PublishTweetTypeUnretweet:
+		return nil
 	}
 
-	p := &userlookupTypes.GetByUsernameInput{
-		Username: targetUsername,
+	if r.PublishTweetType == PublishTweetTypeQuote && r.isThread() {
+		return newValidationErr("a quote tweet cannot be published as a thread")
 	}
 
-	if username != "" {
-		if client, ok := c.getClientByUsername(username); ok {
-			return userlookup.GetByUsername(context.Background(), client, p)
+	if r.Poll != nil {
+		if err := r.Poll.validate(); err != nil {
+			return err
+		}
+		if len(r.Media) > 0 {
+			return newValidationErr("a tweet cannot have both a poll and media")
+		}
+		if r.isThread() {
+			return newValidationErr("a poll cannot be published as part of a thread")
 		}
-		return nil, fmt.Errorf("username (%s) not found in client pool", username)
 	}
 
-	for _, client := range c.clients {
-		output, err := userlookup.GetByUsername(context.Background(), client, p)
-		if err == nil {
-			return output, nil
-		} else if !isRateLimitErr(err) {
-			return nil, fmt.Errorf("error getting user by username ( %s ): %s", targetUsername, err.Error())
+	if r.isThread() || len(r.Texts) == 0 {
+		return validateThreadTexts(r.Texts)
+	}
+
+	// Tweets with media don't require any text
+	if r.Texts[0] == "" && len(r.Media) > 0 {
+		return nil
+	}
+
+	return validateTweetText(r.Texts[0])
+}
+
+func (c *TwitterClient) publishTweet(opts PublishTweetOpts) (*PublishTweetResult, error) {
+	rendered, err := opts.render(c.fetcher)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.publishRendered(opts.Username, rendered)
+}
+
+// publishRendered publishes the rendered tweet(s). If the account already published the same content,
+// nothing is published and the result is reported as skipped.
+func (c *TwitterClient) publishRendered(username string, rendered *RenderedTweet) (*PublishTweetResult, error) {
+	result, err := c.doPublishRendered(username, rendered)
+
+	var dupErr *DuplicateContentError
+	if errors.As(err, &dupErr) {
+		return &PublishTweetResult{
+			Username:    dupErr.Username,
+			Skipped:     PublishSkippedDuplicate,
+			DuplicateOf: dupErr.TweetID,
+		}, nil
+	}
+
+	return result, err
+}
+
+func (c *TwitterClient) doPublishRendered(username string, rendered *RenderedTweet) (*PublishTweetResult, error) {
+	switch rendered.PublishTweetType {
+	case PublishTweetTypeRetweet:
+		return c.retweet(username, rendered.TargetTweetID)
+	case PublishTweetTypeUnretweet:
+		return c.unretweet(username, rendered.TargetTweetID)
+	}
+
+	if rendered.isThread() {
+		return c.publishThread(username, rendered.Texts, rendered.ReplyToTweetID, rendered.Media, rendered.ContentHash)
+	}
+
+	p := newCreateInput(rendered.Texts[0])
+	p.Poll = rendered.Poll.toCreateInput()
+	if rendered.PublishTweetType == PublishTweetTypeQuote {
+		p.QuoteTweetID = gotwi.String(rendered.TargetTweetID)
+	}
+	if rendered.ReplyToTweetID != "" {
+		p.Reply = &managetweetTypes.CreateInputReply{
+			InReplyToTweetID: rendered.ReplyToTweetID,
 		}
 	}
 
-	return nil, fmt.Errorf(
-		"error getting user by username ( %s ): all (%d) Twitter client(s) were rate-limited",
-		targetUsername,
-		len(c.clients),
-	)
+	return c.doCreateResult(username, p, rendered.Media, rendered.ContentHash)
+}
+
+func (c *TwitterClient) getUserByUsername(username, targetUsername string) (*userlookupTypes.GetByUsernameOutput, error) {
+	if targetUsername == "" {
+		return nil, newValidationErr("missing targetUsername")
+	}
+
+	p := &userlookupTypes.GetByUsernameInput{
+		Username: targetUsername,
+	}
+
+	output, err := doWithPool(c, TwitterEndpointUserByUsername, username, func(pc *PoolClient) (*userlookupTypes.GetByUsernameOutput, error) {
+		return userlookup.GetByUsername(context.Background(), pc.client, p)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by username ( %s ): %w", targetUsername, err)
+	}
+
+	return output, nil
 }
 
 func (c *TwitterClient) getUserByID(username, targetUserID string) (*userlookupTypes.GetOutput, error) {
 	if targetUserID == "" {
-		return nil, errors.New("missing targetUserID")
+		return nil, newValidationErr("missing targetUserID")
 	}
 
 	p := &userlookupTypes.GetInput{
 		ID: targetUserID,
 	}
 
-	if username != "" {
-		if client, ok := c.getClientByUsername(username); ok {
-			return userlookup.Get(context.Background(), client, p)
-		}
-		return nil, fmt.Errorf("username (%s) not found in client pool", username)
-	}
-
-	for _, client := range c.clients {
-		output, err := userlookup.Get(context.Background(), client, p)
-		if err == nil {
-			return output, nil
-		} else if !isRateLimitErr(err) {
-			return nil, fmt.Errorf("error getting user by ID ( %s ): %s", targetUserID, err.Error())
-		}
+	output, err := doWithPool(c, TwitterEndpointUserByID, username, func(pc *PoolClient) (*userlookupTypes.GetOutput, error) {
+		return userlookup.Get(context.Background(), pc.client, p)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting user by ID ( %s ): %w", targetUserID, err)
 	}
 
-	return nil, fmt.Errorf(
-		"error getting user by ID ( %s ): all (%d) Twitter client(s) were rate-limited",
-		targetUserID,
-		len(c.clients),
-	)
+	return output, nil
 }
 
 func (c *TwitterClient) getUserSingleTweets(username, targetUserID string) (*timelineTypes.ListTweetsOutput, error) {
 	if targetUserID == "" {
-		return nil, errors.New("missing targetUserID")
+		return nil, newValidationErr("missing targetUserID")
 	}
 
 	p := &timelineTypes.ListTweetsInput{
@@ -392,25 +732,12 @@ func (c *TwitterClient) getUserSingleTweets(username, targetUserID string) (*tim
 		},
 	}
 
-	if username != "" {
-		if client, ok := c.getClientByUsername(username); ok {
-			return timeline.ListTweets(context.Background(), client, p)
-		}
-		return nil, fmt.Errorf("username (%s) not found in client pool", username)
-	}
-
-	for _, client := range c.clients {
-		output, err := timeline.ListTweets(context.Background(), client, p)
-		if err == nil {
-			return output, nil
-		} else if !isRateLimitErr(err) {
-			return nil, fmt.Errorf("error getting tweets for user ( %s ): %s", targetUserID, err.Error())
-		}
+	output, err := doWithPool(c, TwitterEndpointUserTweets, username, func(pc *PoolClient) (*timelineTypes.ListTweetsOutput, error) {
+		return timeline.ListTweets(context.Background(), pc.client, p)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting tweets for user ( %s ): %w", targetUserID, err)
 	}
 
-	return nil, fmt.Errorf(
-		"error getting tweets for user ( %s ): all (%d) Twitter client(s) were rate-limited",
-		targetUserID,
-		len(c.clients),
-	)
+	return output, nil
 }
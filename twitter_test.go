@@ -2,11 +2,57 @@ package main
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/michimani/gotwi"
 	"github.com/stretchr/testify/assert"
 )
 
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// newTestTwitterClient returns a TwitterClient whose clients send every Twitter API request to handler.
+// The username of the client making the request is sent in the X-Test-Username header.
+func newTestTwitterClient(t *testing.T, handler http.HandlerFunc, usernames ...string) *TwitterClient {
+	clients := []*PoolClient{}
+	for _, username := range usernames {
+		username := username
+		httpClient := &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				r.Header.Set("X-Test-Username", username)
+				w := httptest.NewRecorder()
+				handler(w, r)
+				return w.Result(), nil
+			}),
+		}
+
+		client, err := gotwi.NewClient(&gotwi.NewClientInput{
+			AuthenticationMethod: gotwi.AuthenMethodOAuth1UserContext,
+			HTTPClient:           httpClient,
+			APIKey:               "key",
+			APIKeySecret:         "secret",
+			OAuthToken:           "token",
+			OAuthTokenSecret:     "token-secret",
+		})
+		assert.Nil(t, err)
+
+		clients = append(clients, &PoolClient{
+			creds:  TwitterAPICreds{Username: username},
+			client: client,
+		})
+	}
+
+	return &TwitterClient{
+		pool:    newClientPool(clients, ClientSelectionStrategyPriority),
+		fetcher: newFetcher(defaultFetchConfig()),
+		Logger:  newLogger(),
+	}
+}
+
 func TestPublishTweetOpts(t *testing.T) {
 	t.Run("Test handleFetchJsonResp()", func(t *testing.T) {
 		type PublishTweetOptsTest struct {
@@ -56,7 +102,28 @@ func TestPublishTweetOpts(t *testing.T) {
 							"name": "Bob"
 						}
 					]
-				}
+				},
+				"feed": [
+					{
+						"title": "First",
+						"status": "draft",
+						"views": 250,
+						"meta": {
+							"lang": "en"
+						}
+					},
+					{
+						"title": "Second",
+						"status": "published",
+						"views": 12
+					},
+					{
+						"title": "Third",
+						"status": "published",
+						"views": 100,
+						"pinned": true
+					}
+				]
 			}
 		}`)
 
@@ -87,17 +154,58 @@ func TestPublishTweetOpts(t *testing.T) {
 			newPublishTweetOptsTest("{*{ data.post.stats.more.some }*}", "data", false),
 			newPublishTweetOptsTest("{*{ data.post.stats.items }*}", `["foo","bar","baz"]`, false),
 
-			// Indexing inside of array (TODO: not yet implimented)
-			newPublishTweetOptsTest("{*{ data.post.stats.items[0] }*}", "", true),
-			newPublishTweetOptsTest("{*{ data.post.stats.items[1] }*}", "", true),
-			newPublishTweetOptsTest("{*{ data.post.stats.items[2] }*}", "", true),
+			// Indexing inside of array
+			newPublishTweetOptsTest("{*{ data.post.stats.items[0] }*}", "foo", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items[1] }*}", "bar", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items[2] }*}", "baz", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items.1 }*}", "bar", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items[3] }*}", "", true),
+			newPublishTweetOptsTest("{*{ data.post.stats.more[0] }*}", "", true),
+
+			// Negative indexes
+			newPublishTweetOptsTest("{*{ data.post.stats.items[-1] }*}", "baz", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items[-3] }*}", "foo", false),
+			newPublishTweetOptsTest("{*{ data.post.stats.items[-4] }*}", "", true),
 
 			// Objects inside of array
 			newPublishTweetOptsTest("{*{ data.post.authors }*}", `[{"name":"Jim"},{"name":"Bob"}]`, false),
 
-			// Indexing objects inside of array (TODO: not yet implimented)
-			newPublishTweetOptsTest("{*{ data.post.authors[0] }*}", "", true),
-			newPublishTweetOptsTest("{*{ data.post.authors[1] }*}", "", true),
+			// Indexing objects inside of array
+			newPublishTweetOptsTest("{*{ data.post.authors[0] }*}", `{"name":"Jim"}`, false),
+			newPublishTweetOptsTest("{*{ data.post.authors[1] }*}", `{"name":"Bob"}`, false),
+			newPublishTweetOptsTest("{*{ data.post.authors[1].name }*}", "Bob", false),
+			newPublishTweetOptsTest("{*{ data.post.authors.0.name }*}", "Jim", false),
+			newPublishTweetOptsTest("{*{ data.post.authors[0].age }*}", "", true),
+
+			// Quoted keys
+			newPublishTweetOptsTest(`{*{ data["post"].title }*}`, "My Awesome Title", false),
+
+			// Wildcards
+			newPublishTweetOptsTest("{*{ data.post.tags[*] }*}", "Awesome, Cool", false),
+			newPublishTweetOptsTest(`{*{ data.post.tags[*] | join(" #") }*}`, "Awesome #Cool", false),
+			newPublishTweetOptsTest(`By {*{ data.post.authors[*].name | join(" & ") }*}`, "By Jim & Bob", false),
+			newPublishTweetOptsTest("{*{ data.post.authors[*].name[-1] }*}", "Bob", false),
+			newPublishTweetOptsTest("{*{ data.post.title[*] }*}", "", true),
+			newPublishTweetOptsTest("{*{ data.post.tags | join(\" \") }*}", "Awesome Cool", false),
+			newPublishTweetOptsTest("{*{ data.post.title | join(\" \") }*}", "", true),
+			newPublishTweetOptsTest("{*{ data.post.tags[*] | split(\" \") }*}", "", true),
+
+			// Filters
+			newPublishTweetOptsTest(`{*{ data.feed[?status == "published"][0].title }*}`, "Second", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?status == "published"].title }*}`, "Second, Third", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?status != "published"].title }*}`, "First", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?views >= 100].title }*}`, "First, Third", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?views < 100][-1].title }*}`, "Second", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?pinned].title }*}`, "Third", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?meta.lang == "en"].title }*}`, "First", false),
+			newPublishTweetOptsTest(`{*{ data.post.tags[?@ == "Cool"][0] }*}`, "Cool", false),
+			newPublishTweetOptsTest(`{*{ data.feed[?status == "deleted"][0].title }*}`, "", true),
+			newPublishTweetOptsTest(`{*{ data.feed[?status == published] }*}`, "", true),
+
+			// Invalid paths
+			newPublishTweetOptsTest("{*{ data..post }*}", "", true),
+			newPublishTweetOptsTest("{*{ data.post.tags[0 }*}", "", true),
+			newPublishTweetOptsTest("{*{ data.post.tags[first] }*}", "", true),
 		}
 
 		for _, test := range tests {
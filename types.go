@@ -26,19 +26,43 @@ const (
 )
 
 const (
-	EnvPort                string = "PORT"
-	EnvUsername            string = "USERNAME"
-	EnvAuthToken           string = "AUTH_TOKEN"
-	EnvAPIKey              string = "API_KEY"
-	EnvAPIKeySecret        string = "API_KEY_SECRET"
-	EnvOAuthToken          string = "O_AUTH_TOKEN"
-	EnvOAuthTokenSecret    string = "O_AUTH_TOKEN_SECRET"
-	EnvCatchAllRedirectUrl string = "CATCH_ALL_REDIRECT_URL"
+	EnvPort                 string = "PORT"
+	EnvUsername             string = "USERNAME"
+	EnvAuthToken            string = "AUTH_TOKEN"
+	EnvAPIKey               string = "API_KEY"
+	EnvAPIKeySecret         string = "API_KEY_SECRET"
+	EnvOAuthToken           string = "O_AUTH_TOKEN"
+	EnvOAuthTokenSecret     string = "O_AUTH_TOKEN_SECRET"
+	EnvWeight               string = "WEIGHT"
+	EnvClientStrategy       string = "CLIENT_SELECTION_STRATEGY"
+	EnvCatchAllRedirectUrl  string = "CATCH_ALL_REDIRECT_URL"
+	EnvDataDir              string = "DATA_DIR"
+	EnvDedupeWindow         string = "DEDUPE_WINDOW"
+	EnvIdempotencyTTL       string = "IDEMPOTENCY_TTL"
+	EnvPublishQueueSize     string = "PUBLISH_QUEUE_SIZE"
+	EnvPublishQueueWorkers  string = "PUBLISH_QUEUE_WORKERS"
+	EnvWebhookSecret        string = "WEBHOOK_SECRET"
+	EnvFetchTimeout         string = "FETCH_TIMEOUT"
+	EnvFetchConnectTimeout  string = "FETCH_CONNECT_TIMEOUT"
+	EnvFetchMaxBodyBytes    string = "FETCH_MAX_BODY_BYTES"
+	EnvFetchAllowedSchemes  string = "FETCH_ALLOWED_SCHEMES"
+	EnvFetchAllowedHosts    string = "FETCH_ALLOWED_HOSTS"
+	EnvFetchDeniedHosts     string = "FETCH_DENIED_HOSTS"
+	EnvFetchAllowPrivateIPs string = "FETCH_ALLOW_PRIVATE_IPS"
 )
 
 const (
-	HTTPHeaderAuthorization string = "Authorization"
-	HTTPHeaderContentType   string = "Content-Type"
+	HTTPHeaderAuthorization      string = "Authorization"
+	HTTPHeaderContentType        string = "Content-Type"
+	HTTPHeaderRetryAfter         string = "Retry-After"
+	HTTPHeaderRateLimitLimit     string = "X-Rate-Limit-Limit"
+	HTTPHeaderRateLimitRemaining string = "X-Rate-Limit-Remaining"
+	HTTPHeaderRateLimitReset     string = "X-Rate-Limit-Reset"
+	HTTPHeaderIdempotencyKey     string = "Idempotency-Key"
+	HTTPHeaderIdempotentReplayed string = "Idempotent-Replayed"
+	HTTPHeaderWebhookEvent       string = "X-Webhook-Event"
+	HTTPHeaderWebhookDelivery    string = "X-Webhook-Delivery"
+	HTTPHeaderWebhookSignature   string = "X-Webhook-Signature"
 )
 
 type LogLevel string
@@ -49,8 +73,15 @@ const (
 )
 
 const (
-	MuxVarTargetUserID   string = "targetUserID"
-	MuxVarTargetUsername string = "targetUsername"
+	MuxVarTweetID         string = "tweetID"
+	MuxVarScheduledID     string = "scheduledID"
+	MuxVarRecurringID     string = "recurringID"
+	MuxVarJobID           string = "jobID"
+	MuxVarWebhookID       string = "webhookID"
+	MuxVarTemplateName    string = "templateName"
+	MuxVarTemplateVersion string = "templateVersion"
+	MuxVarTargetUserID    string = "targetUserID"
+	MuxVarTargetUsername  string = "targetUsername"
 )
 
 type PublishTweetType string
@@ -58,8 +89,19 @@ type PublishTweetType string
 const (
 	PublishTweetTypeText      PublishTweetType = "text"
 	PublishTweetTypeFetchJson PublishTweetType = "fetch_json"
+	PublishTweetTypeThread    PublishTweetType = "thread"
+	PublishTweetTypeQuote     PublishTweetType = "quote"
+	PublishTweetTypeRetweet   PublishTweetType = "retweet"
+	PublishTweetTypeUnretweet PublishTweetType = "unretweet"
 )
 
 const (
-	QueryParamUsername string = "username"
+	PublishSkippedDuplicate string = "duplicate"
+)
+
+const (
+	QueryParamUsername  string = "username"
+	QueryParamStatus    string = "status"
+	QueryParamAsync     string = "async"
+	QueryParamWebhookID string = "webhookID"
 )
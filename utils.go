@@ -1,6 +1,8 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net/url"
 	"os"
 	"strconv"
@@ -98,3 +100,12 @@ func containsAnySubstrs(s string, substrs ...string) bool {
 	}
 	return false
 }
+
+// newID returns a random 16 byte hex-encoded ID.
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
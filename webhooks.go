@@ -0,0 +1,473 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxWebhookAttempts = 5
+	// The number of deliveries kept in the delivery log
+	maxWebhookDeliveries = 1000
+	webhookTimeout       = 10 * time.Second
+)
+
+// The delay before the first retry of a failed delivery, which doubles after every attempt
+var webhookBackoff = 2 * time.Second
+
+type WebhookEventType string
+
+const (
+	WebhookEventTweetPublished WebhookEventType = "tweet.published"
+	WebhookEventTweetFailed    WebhookEventType = "tweet.failed"
+	WebhookEventTweetDeleted   WebhookEventType = "tweet.deleted"
+)
+
+func (t WebhookEventType) isValid() bool {
+	switch t {
+	case WebhookEventTweetPublished, WebhookEventTweetFailed, WebhookEventTweetDeleted:
+		return true
+	}
+	return false
+}
+
+// WebhookEvent is the json body sent to webhooks.
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      WebhookEventType `json:"type"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Data      any              `json:"data"`
+}
+
+// TweetFailedEventData is the data of a tweet.failed event. A thread that failed part way through
+// also has the result of the parts that were published.
+type TweetFailedEventData struct {
+	Error  *APIError           `json:"error"`
+	Result *PublishTweetResult `json:"result,omitempty"`
+}
+
+// WebhookSubscriptionOpts is the definition of a webhook subscription, as sent to the create and update endpoints.
+type WebhookSubscriptionOpts struct {
+	Url     string             `json:"url"`
+	Events  []WebhookEventType `json:"events"`
+	Secret  string             `json:"secret"`
+	Enabled *bool              `json:"enabled"`
+}
+
+// WebhookSubscription receives the events it subscribes to, or every event if Events is empty.
+type WebhookSubscription struct {
+	ID        string             `json:"id"`
+	Url       string             `json:"url"`
+	Events    []WebhookEventType `json:"events"`
+	Secret    string             `json:"secret,omitempty"`
+	Enabled   bool               `json:"enabled"`
+	CreatedAt time.Time          `json:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt"`
+}
+
+// redacted returns the subscription without its secret, which is only returned when the subscription is created.
+func (s WebhookSubscription) redacted() WebhookSubscription {
+	s.Secret = ""
+	return s
+}
+
+// WebhookCallbackSecret is the secret that signs the events sent to callback urls.
+type WebhookCallbackSecret struct {
+	Secret string `json:"secret"`
+}
+
+func (s WebhookSubscription) subscribesTo(eventType WebhookEventType) bool {
+	if !s.Enabled {
+		return false
+	}
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, t := range s.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusSucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryStatusFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is the delivery log entry of an event sent to a webhook subscription,
+// or to the callbackUrl of a publish request if WebhookID is empty.
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	WebhookID      string                `json:"webhookID,omitempty"`
+	Url            string                `json:"url"`
+	EventID        string                `json:"eventID"`
+	EventType      WebhookEventType      `json:"eventType"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	LastStatusCode int                   `json:"lastStatusCode,omitempty"`
+	LastError      string                `json:"lastError,omitempty"`
+	CreatedAt      time.Time             `json:"createdAt"`
+	UpdatedAt      time.Time             `json:"updatedAt"`
+}
+
+// signWebhook returns the value of the signature header: the HMAC-SHA256 of the timestamp and body, keyed by secret.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Webhooks sends events to webhook subscriptions and callback urls, and keeps a log of the deliveries.
+// Failed deliveries are retried with exponential backoff. Events are sent by the same Fetcher as
+// fetch urls, since webhook urls are also provided by callers.
+type Webhooks struct {
+	subscriptions *Store[WebhookSubscription]
+	deliveries    *Store[WebhookDelivery]
+	// callbackSecret signs the events sent to callback urls, which have no subscription secret
+	callbackSecret string
+	fetcher        *Fetcher
+	stop           chan struct{}
+	wg             sync.WaitGroup
+	*Logger
+}
+
+// loadWebhookSecret returns secret if it's set, or else the callback secret saved to path,
+// generating and saving one if there isn't one yet. An empty path saves nothing, so the secret is generated by newWebhooks.
+func loadWebhookSecret(secret, path string) (string, error) {
+	if secret != "" || path == "" {
+		return secret, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	secret = newID()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	return secret, os.WriteFile(path, []byte(secret), 0o600)
+}
+
+// newWebhooks creates the Webhooks, generating a callbackSecret if it's empty, so that every event is signed.
+func newWebhooks(subscriptions *Store[WebhookSubscription], deliveries *Store[WebhookDelivery], callbackSecret string, fetcher *Fetcher, logger *Logger) *Webhooks {
+	if callbackSecret == "" {
+		callbackSecret = newID()
+	}
+
+	return &Webhooks{
+		subscriptions:  subscriptions,
+		deliveries:     deliveries,
+		callbackSecret: callbackSecret,
+		fetcher:        fetcher,
+		stop:           make(chan struct{}),
+		Logger:         logger,
+	}
+}
+
+// start fails the deliveries that were still being retried when the service stopped.
+func (wh *Webhooks) start() {
+	for _, d := range wh.deliveries.List() {
+		if d.Status != WebhookDeliveryStatusPending {
+			continue
+		}
+		wh.deliveries.Update(d.ID, func(d WebhookDelivery) (WebhookDelivery, error) {
+			d.Status = WebhookDeliveryStatusFailed
+			d.LastError = "interrupted by a restart"
+			d.UpdatedAt = time.Now()
+			return d, nil
+		})
+	}
+}
+
+// wait blocks until every delivery in progress has succeeded or run out of attempts.
+func (wh *Webhooks) wait() {
+	wh.wg.Wait()
+}
+
+// close stops retrying deliveries, which are failed instead, and waits for the attempts in progress.
+func (wh *Webhooks) close() {
+	close(wh.stop)
+	wh.wait()
+}
+
+// emit sends the event to every subscription of its type, and to callbackUrl if it isn't empty.
+func (wh *Webhooks) emit(eventType WebhookEventType, data any, callbackUrl string) {
+	if wh == nil {
+		return
+	}
+
+	event := WebhookEvent{
+		ID:        newID(),
+		Type:      eventType,
+		CreatedAt: time.Now(),
+		Data:      data,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		wh.LogErr(fmt.Errorf("error encoding webhook event (%s): %w", eventType, err))
+		return
+	}
+
+	for _, s := range wh.subscriptions.List() {
+		if s.subscribesTo(eventType) {
+			wh.send(event, body, s.ID, s.Url, s.Secret)
+		}
+	}
+
+	if callbackUrl != "" {
+		wh.send(event, body, "", callbackUrl, wh.callbackSecret)
+	}
+}
+
+func (wh *Webhooks) send(event WebhookEvent, body []byte, webhookID, url, secret string) {
+	now := time.Now()
+	d := WebhookDelivery{
+		ID:        newID(),
+		WebhookID: webhookID,
+		Url:       url,
+		EventID:   event.ID,
+		EventType: event.Type,
+		Status:    WebhookDeliveryStatusPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := wh.deliveries.Set(d.ID, d); err != nil {
+		wh.LogErr(fmt.Errorf("error recording webhook delivery: %w", err))
+	}
+	wh.pruneDeliveries()
+
+	wh.wg.Add(1)
+	go func() {
+		defer wh.wg.Done()
+		wh.deliver(d, body, secret)
+	}()
+}
+
+func (wh *Webhooks) deliver(d WebhookDelivery, body []byte, secret string) {
+	backoff := webhookBackoff
+	for attempt := 1; attempt <= maxWebhookAttempts; attempt++ {
+		statusCode, err := wh.post(d, body, secret)
+
+		status := WebhookDeliveryStatusPending
+		switch {
+		case err == nil:
+			status = WebhookDeliveryStatusSucceeded
+		case attempt == maxWebhookAttempts:
+			status = WebhookDeliveryStatusFailed
+		}
+
+		wh.deliveries.Update(d.ID, func(d WebhookDelivery) (WebhookDelivery, error) {
+			d.Status = status
+			d.Attempts = attempt
+			d.LastStatusCode = statusCode
+			d.LastError = ""
+			if err != nil {
+				d.LastError = err.Error()
+			}
+			d.UpdatedAt = time.Now()
+			return d, nil
+		})
+
+		if status != WebhookDeliveryStatusPending {
+			if err != nil {
+				wh.Errorf("error delivering webhook event (%s) to %s after (%d) attempts: %s\n", d.EventType, d.Url, attempt, err.Error())
+			}
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-wh.stop:
+			wh.deliveries.Update(d.ID, func(d WebhookDelivery) (WebhookDelivery, error) {
+				d.Status = WebhookDeliveryStatusFailed
+				d.LastError = "interrupted by a shutdown"
+				d.UpdatedAt = time.Now()
+				return d, nil
+			})
+			return
+		}
+	}
+}
+
+// post sends the event once, and returns an error unless the response has a 2XX status.
+func (wh *Webhooks) post(d WebhookDelivery, body []byte, secret string) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set(HTTPHeaderContentType, ContentTypeApplicationJson)
+	req.Header.Set(HTTPHeaderWebhookEvent, string(d.EventType))
+	req.Header.Set(HTTPHeaderWebhookDelivery, d.ID)
+	req.Header.Set(HTTPHeaderWebhookSignature, signWebhook(secret, time.Now().Unix(), body))
+
+	if err := wh.fetcher.config.checkUrl(req.URL); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+
+	resp, err := wh.fetcher.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status (%d)", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// pruneDeliveries removes the oldest deliveries beyond maxWebhookDeliveries.
+func (wh *Webhooks) pruneDeliveries() {
+	deliveries := wh.listDeliveries("")
+	if len(deliveries) <= maxWebhookDeliveries {
+		return
+	}
+
+	stale := map[string]bool{}
+	for _, d := range deliveries[maxWebhookDeliveries:] {
+		stale[d.ID] = true
+	}
+	wh.LogErr(wh.deliveries.DeleteFunc(func(id string, _ WebhookDelivery) bool {
+		return stale[id]
+	}))
+}
+
+// listDeliveries returns the delivery log, most recent first, optionally filtered to a single webhook subscription.
+func (wh *Webhooks) listDeliveries(webhookID string) []WebhookDelivery {
+	deliveries := []WebhookDelivery{}
+	for _, d := range wh.deliveries.List() {
+		if webhookID == "" || d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	return deliveries
+}
+
+func (wh *Webhooks) newSubscription(s WebhookSubscription, opts WebhookSubscriptionOpts, now time.Time) (WebhookSubscription, error) {
+	if err := checkCallbackUrl(wh.fetcher, opts.Url); err != nil {
+		return s, newValidationErr("invalid webhook url (%s): %s", opts.Url, err.Error())
+	}
+	for _, t := range opts.Events {
+		if !t.isValid() {
+			return s, newValidationErr("invalid webhook event: %s", t)
+		}
+	}
+
+	s.Url = opts.Url
+	s.Events = opts.Events
+	s.Enabled = opts.Enabled == nil || *opts.Enabled
+	s.UpdatedAt = now
+	if opts.Secret != "" {
+		s.Secret = opts.Secret
+	}
+	if s.Secret == "" {
+		s.Secret = newID()
+	}
+	return s, nil
+}
+
+func (wh *Webhooks) create(opts WebhookSubscriptionOpts) (WebhookSubscription, error) {
+	now := time.Now()
+	s, err := wh.newSubscription(WebhookSubscription{ID: newID(), CreatedAt: now}, opts, now)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	return s, wh.subscriptions.Set(s.ID, s)
+}
+
+func (wh *Webhooks) update(id string, opts WebhookSubscriptionOpts) (WebhookSubscription, error) {
+	var updated WebhookSubscription
+	ok, err := wh.subscriptions.Update(id, func(s WebhookSubscription) (WebhookSubscription, error) {
+		s, err := wh.newSubscription(s, opts, time.Now())
+		updated = s
+		return s, err
+	})
+	if !ok {
+		return WebhookSubscription{}, &NotFoundError{Resource: "webhook", ID: id}
+	}
+	return updated, err
+}
+
+func (wh *Webhooks) delete(id string) error {
+	ok, err := wh.subscriptions.Delete(id)
+	if !ok {
+		return &NotFoundError{Resource: "webhook", ID: id}
+	}
+	return err
+}
+
+func (wh *Webhooks) get(id string) (WebhookSubscription, error) {
+	s, ok := wh.subscriptions.Get(id)
+	if !ok {
+		return WebhookSubscription{}, &NotFoundError{Resource: "webhook", ID: id}
+	}
+	return s, nil
+}
+
+func (wh *Webhooks) list() []WebhookSubscription {
+	subscriptions := wh.subscriptions.List()
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+	})
+	return subscriptions
+}
+
+// notifyPublished sends the final outcome of a publish request. Retried attempts (ex: of a rate-limited
+// queued job) must only notify once, when they finish. Skipped duplicates don't send an event.
+func (c *TwitterClient) notifyPublished(callbackUrl string, result *PublishTweetResult, err error) {
+	if err != nil {
+		_, apiErr := toAPIError(err)
+		c.webhooks.emit(WebhookEventTweetFailed, TweetFailedEventData{Error: apiErr, Result: result}, callbackUrl)
+		return
+	}
+
+	if result == nil || result.Skipped != "" {
+		return
+	}
+	c.webhooks.emit(WebhookEventTweetPublished, result, callbackUrl)
+}
+
+// checkCallbackUrl returns an error unless s is an absolute http(s) url that the fetch config allows events to be sent to.
+// The address it resolves to is only checked when an event is sent.
+func checkCallbackUrl(f *Fetcher, s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http(s) url")
+	}
+	return f.config.checkUrl(u)
+}
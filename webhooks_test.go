@@ -0,0 +1,341 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	managetweetTypes "github.com/michimani/gotwi/tweet/managetweet/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignWebhook(t *testing.T) {
+	body := []byte(`{"type":"tweet.published"}`)
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("1700000000." + string(body)))
+	expected := "t=1700000000,v1=" + hex.EncodeToString(mac.Sum(nil))
+
+	assert.Equal(t, expected, signWebhook("secret", 1700000000, body))
+	assert.NotEqual(t, expected, signWebhook("other-secret", 1700000000, body))
+}
+
+func TestWebhookSubscribesTo(t *testing.T) {
+	all := WebhookSubscription{Enabled: true}
+	assert.True(t, all.subscribesTo(WebhookEventTweetPublished))
+	assert.True(t, all.subscribesTo(WebhookEventTweetDeleted))
+
+	failed := WebhookSubscription{Enabled: true, Events: []WebhookEventType{WebhookEventTweetFailed}}
+	assert.True(t, failed.subscribesTo(WebhookEventTweetFailed))
+	assert.False(t, failed.subscribesTo(WebhookEventTweetPublished))
+
+	disabled := WebhookSubscription{}
+	assert.False(t, disabled.subscribesTo(WebhookEventTweetPublished))
+}
+
+// webhookReceiver records the events it receives, and fails the first failures requests.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	events   []WebhookEvent
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	if wr.failures > 0 {
+		wr.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	var event WebhookEvent
+	json.Unmarshal(body, &event)
+	wr.events = append(wr.events, event)
+	wr.headers = append(wr.headers, r.Header)
+	wr.bodies = append(wr.bodies, body)
+}
+
+func newTestWebhooks(callbackSecret string) *Webhooks {
+	subscriptions, _ := newStore[WebhookSubscription]("")
+	deliveries, _ := newStore[WebhookDelivery]("")
+	return newWebhooks(subscriptions, deliveries, callbackSecret, newPrivateTestFetcher(), newLogger())
+}
+
+func TestWebhooks(t *testing.T) {
+	defaultBackoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	defer func() { webhookBackoff = defaultBackoff }()
+
+	subscriber := &webhookReceiver{failures: 2}
+	subscriberServer := httptest.NewServer(subscriber)
+	defer subscriberServer.Close()
+
+	callback := &webhookReceiver{}
+	callbackServer := httptest.NewServer(callback)
+	defer callbackServer.Close()
+
+	wh := newTestWebhooks("callback-secret")
+
+	t.Run("Test create() validates the subscription", func(t *testing.T) {
+		_, err := wh.create(WebhookSubscriptionOpts{Url: "ftp://example.com"})
+		assert.IsType(t, &ValidationError{}, err)
+
+		_, err = wh.create(WebhookSubscriptionOpts{Url: subscriberServer.URL, Events: []WebhookEventType{"tweet.liked"}})
+		assert.IsType(t, &ValidationError{}, err)
+	})
+
+	subscription, err := wh.create(WebhookSubscriptionOpts{
+		Url:    subscriberServer.URL,
+		Events: []WebhookEventType{WebhookEventTweetPublished},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, subscription.Secret)
+
+	t.Run("Test emit() with retries", func(t *testing.T) {
+		wh.emit(WebhookEventTweetPublished, map[string]string{"tweetID": "1000000000000000001"}, callbackServer.URL)
+		wh.emit(WebhookEventTweetFailed, map[string]string{"detail": "failed"}, "")
+		wh.wait()
+
+		// The subscription only receives the events it subscribed to, after failing twice
+		assert.Len(t, subscriber.events, 1)
+		assert.Equal(t, WebhookEventTweetPublished, subscriber.events[0].Type)
+		assert.Equal(t, string(WebhookEventTweetPublished), subscriber.headers[0].Get(HTTPHeaderWebhookEvent))
+
+		signature := subscriber.headers[0].Get(HTTPHeaderWebhookSignature)
+		timestamp := strings.TrimPrefix(strings.Split(signature, ",")[0], "t=")
+		mac := hmac.New(sha256.New, []byte(subscription.Secret))
+		mac.Write([]byte(timestamp + "." + string(subscriber.bodies[0])))
+		assert.True(t, strings.HasSuffix(signature, ",v1="+hex.EncodeToString(mac.Sum(nil))))
+
+		// The callback receives the same event, signed with the callback secret
+		assert.Len(t, callback.events, 1)
+		assert.Equal(t, subscriber.events[0].ID, callback.events[0].ID)
+		assert.NotEqual(t, signature, callback.headers[0].Get(HTTPHeaderWebhookSignature))
+
+		deliveries := wh.listDeliveries(subscription.ID)
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, WebhookDeliveryStatusSucceeded, deliveries[0].Status)
+		assert.Equal(t, 3, deliveries[0].Attempts)
+		assert.Len(t, wh.listDeliveries(""), 2)
+	})
+
+	t.Run("Test deliveries fail after the max attempts", func(t *testing.T) {
+		subscriber.failures = maxWebhookAttempts
+		wh.emit(WebhookEventTweetPublished, nil, "")
+		wh.wait()
+
+		d := wh.listDeliveries(subscription.ID)[0]
+		assert.Equal(t, WebhookDeliveryStatusFailed, d.Status)
+		assert.Equal(t, maxWebhookAttempts, d.Attempts)
+		assert.Equal(t, http.StatusInternalServerError, d.LastStatusCode)
+	})
+
+	t.Run("Test update() and delete()", func(t *testing.T) {
+		enabled := false
+		updated, err := wh.update(subscription.ID, WebhookSubscriptionOpts{Url: subscriberServer.URL, Enabled: &enabled})
+		assert.Nil(t, err)
+		assert.False(t, updated.Enabled)
+		assert.Equal(t, subscription.Secret, updated.Secret)
+
+		assert.Nil(t, wh.delete(subscription.ID))
+		assert.IsType(t, &NotFoundError{}, wh.delete(subscription.ID))
+	})
+}
+
+func TestPublishTweetCallbackUrl(t *testing.T) {
+	callback := &webhookReceiver{}
+	callbackServer := httptest.NewServer(callback)
+	defer callbackServer.Close()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		var in managetweetTypes.CreateInput
+		json.NewDecoder(r.Body).Decode(&in)
+		if *in.Text == "fail" {
+			writeJSON(w, http.StatusForbidden, map[string]any{"title": "Forbidden", "detail": "failed on purpose"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]any{
+			"data": map[string]string{"id": "1000000000000000001", "text": *in.Text},
+		})
+	}
+	c := newTestTwitterClient(t, handler, "alpha")
+	c.webhooks = newTestWebhooks("")
+	api := newTestAPI(c)
+
+	w := doTestRequest(api, http.MethodPost, "/api/tweet", PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		Text:             "hello",
+		CallbackUrl:      callbackServer.URL,
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = doTestRequest(api, http.MethodPost, "/api/tweet", PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		Text:             "fail",
+		CallbackUrl:      callbackServer.URL,
+	})
+	assert.NotEqual(t, http.StatusOK, w.Code)
+
+	// A request that is rejected before publishing doesn't send an event
+	w = doTestRequest(api, http.MethodPost, "/api/tweet", PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		CallbackUrl:      callbackServer.URL,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Without a WEBHOOK_SECRET, events sent to callback urls are signed with a generated secret
+	w = doTestRequest(api, http.MethodGet, "/api/webhook-secret", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var secretResp struct {
+		Data WebhookCallbackSecret `json:"data"`
+	}
+	assert.Nil(t, json.NewDecoder(w.Body).Decode(&secretResp))
+	assert.NotEmpty(t, secretResp.Data.Secret)
+
+	c.webhooks.wait()
+	// Deliveries are sent concurrently, so they may arrive in any order
+	eventTypes := []WebhookEventType{}
+	for i, event := range callback.events {
+		eventTypes = append(eventTypes, event.Type)
+
+		signature := callback.headers[i].Get(HTTPHeaderWebhookSignature)
+		var timestamp int64
+		fmt.Sscanf(signature, "t=%d,", &timestamp)
+		assert.Equal(t, signWebhook(secretResp.Data.Secret, timestamp, callback.bodies[i]), signature)
+	}
+	assert.ElementsMatch(t, []WebhookEventType{WebhookEventTweetPublished, WebhookEventTweetFailed}, eventTypes)
+
+	w = doTestRequest(api, http.MethodPost, "/api/tweet", PublishTweetOpts{
+		PublishTweetType: PublishTweetTypeText,
+		Text:             "hello",
+		CallbackUrl:      "not a url",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebhooksFetchRestrictions(t *testing.T) {
+	defaultBackoff := webhookBackoff
+	webhookBackoff = time.Millisecond
+	defer func() { webhookBackoff = defaultBackoff }()
+
+	subscriber := &webhookReceiver{}
+	subscriberServer := httptest.NewServer(subscriber)
+	defer subscriberServer.Close()
+
+	subscriptions, _ := newStore[WebhookSubscription]("")
+	deliveries, _ := newStore[WebhookDelivery]("")
+	config := defaultFetchConfig()
+	config.DeniedHosts = []string{"denied.example.com"}
+	wh := newWebhooks(subscriptions, deliveries, "", newFetcher(config), newLogger())
+
+	_, err := wh.create(WebhookSubscriptionOpts{Url: "https://denied.example.com/hook"})
+	assert.IsType(t, &ValidationError{}, err)
+
+	// The url is allowed, but it resolves to a private address
+	_, err = wh.create(WebhookSubscriptionOpts{Url: subscriberServer.URL})
+	assert.Nil(t, err)
+
+	wh.emit(WebhookEventTweetPublished, nil, "")
+	wh.wait()
+
+	d := wh.listDeliveries("")[0]
+	assert.Equal(t, WebhookDeliveryStatusFailed, d.Status)
+	assert.Contains(t, d.LastError, "private address")
+	assert.Empty(t, subscriber.events)
+}
+
+func TestWebhooksClose(t *testing.T) {
+	defaultBackoff := webhookBackoff
+	webhookBackoff = time.Hour
+	defer func() { webhookBackoff = defaultBackoff }()
+
+	subscriber := &webhookReceiver{failures: 1}
+	subscriberServer := httptest.NewServer(subscriber)
+	defer subscriberServer.Close()
+
+	wh := newTestWebhooks("")
+	_, err := wh.create(WebhookSubscriptionOpts{Url: subscriberServer.URL})
+	assert.Nil(t, err)
+
+	// The retry is waiting for an hour, so close must stop it
+	wh.emit(WebhookEventTweetPublished, nil, "")
+	wh.close()
+
+	d := wh.listDeliveries("")[0]
+	assert.Equal(t, WebhookDeliveryStatusFailed, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, "interrupted by a shutdown", d.LastError)
+}
+
+func TestLoadWebhookSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhook_secret")
+
+	secret, err := loadWebhookSecret("configured", path)
+	assert.Nil(t, err)
+	assert.Equal(t, "configured", secret)
+
+	// A generated secret is saved, so it stays the same across restarts
+	generated, err := loadWebhookSecret("", path)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, generated)
+	secret, err = loadWebhookSecret("", path)
+	assert.Nil(t, err)
+	assert.Equal(t, generated, secret)
+}
+
+func TestWebhookSubscriptionSecret(t *testing.T) {
+	c := newTestTwitterClient(t, nil, "alpha")
+	c.webhooks = newTestWebhooks("")
+	api := newTestAPI(c)
+
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&struct {
+			Data any `json:"data"`
+		}{Data: v}))
+	}
+
+	// The secret is only returned when the subscription is created
+	w := doTestRequest(api, http.MethodPost, "/api/webhooks", WebhookSubscriptionOpts{Url: "https://example.com/hook"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created WebhookSubscription
+	decode(w, &created)
+	assert.NotEmpty(t, created.Secret)
+
+	w = doTestRequest(api, http.MethodGet, "/api/webhooks/"+created.ID, nil)
+	var got WebhookSubscription
+	decode(w, &got)
+	assert.Equal(t, created.ID, got.ID)
+	assert.Empty(t, got.Secret)
+
+	w = doTestRequest(api, http.MethodGet, "/api/webhooks", nil)
+	var listed []WebhookSubscription
+	decode(w, &listed)
+	assert.Len(t, listed, 1)
+	assert.Empty(t, listed[0].Secret)
+
+	w = doTestRequest(api, http.MethodPut, "/api/webhooks/"+created.ID, WebhookSubscriptionOpts{Url: "https://example.com/other"})
+	var updated WebhookSubscription
+	decode(w, &updated)
+	assert.Equal(t, "https://example.com/other", updated.Url)
+	assert.Empty(t, updated.Secret)
+
+	// The secret is kept, and still signs the events
+	s, err := c.webhooks.get(created.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, created.Secret, s.Secret)
+}